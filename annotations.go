@@ -0,0 +1,154 @@
+package sherpago
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/mjl-/sherpadoc"
+)
+
+// Prefix of lines in sherpadoc documentation with annotations for sherpago.
+// These lines are not included in the generated documentation.
+const annotationPrefix = "sherpago:"
+
+// Annotations known for elements of the sherpadoc, with whether a value is
+// required.
+var functionAnnotations = map[string]bool{
+	"get":      false, // Call with a GET request, with the parameters in the query string.
+	"timeout":  true,  // Default timeout for calls, as time.Duration, e.g. "30s".
+	"no-retry": false, // Never send the request more than once, the function is not idempotent.
+	"await":    true,  // Field of the result telling whether an operation is done, for an Await method.
+	"events":   true,  // Path of server-sent events with the types of the results, for a Subscribe method.
+	"pages":    true,  // Parameter, and fields of the result with elements and next parameter, for an iterator method.
+}
+
+// Annotations known for struct fields.
+var fieldAnnotations = map[string]bool{
+	"default":  true, // Default value as JSON, for SetDefaults.
+	"duration": true, // Integer is a duration in this unit: ns, us, ms, s, m or h, a time.Duration in Go.
+	"format":   true, // String has this format: ip for a netip.Addr, mac for a net.HardwareAddr in Go.
+}
+
+// Annotations known for struct and enum types.
+var typeAnnotations = map[string]bool{
+	"bitmask":  false, // Int enum with flags as values, that can be combined.
+	"union":    true,  // Struct with a variant, by the value of this string field in the variants.
+	"variants": true,  // Variants of a union, as comma-separated kind:type.
+	"embeds":   true,  // Struct types embedded in the struct, comma-separated.
+}
+
+// typeAnnotations returns the annotations of type name, a struct or enum type,
+// also checking they apply to the kind of type.
+func (g *generator) typeAnnotations(name string) map[string]string {
+	what := "type " + name
+	var l map[string]string
+	if t, ok := g.structs[name]; ok {
+		l = annotations(what, t.Docs, typeAnnotations)
+	} else if t, ok := g.ints[name]; ok {
+		l = annotations(what, t.Docs, typeAnnotations)
+	} else if t, ok := g.strs[name]; ok {
+		l = annotations(what, t.Docs, typeAnnotations)
+	}
+	if _, ok := l["bitmask"]; ok {
+		if _, ok := g.ints[name]; !ok {
+			panic(genError{fmt.Errorf("sherpago annotation \"bitmask\" for %s is only for int enums", what)})
+		}
+	}
+	return l
+}
+
+// isBitmask returns whether type name is an int enum with the "bitmask"
+// annotation.
+func (g *generator) isBitmask(name string) bool {
+	_, ok := g.typeAnnotations(name)["bitmask"]
+	return ok
+}
+
+// functionCallInfo returns the fields for the callInfo of fn in the generated
+// client, from its annotations and with the names of its parameters, as Go code
+// starting with a comma, or the empty string.
+func functionCallInfo(fn *sherpadoc.Function) string {
+	what := "function " + fn.Name
+	l := annotations(what, fn.Docs, functionAnnotations)
+	var r string
+	_, get := l["get"]
+	_, noRetry := l["no-retry"]
+	if get && noRetry {
+		panic(genError{fmt.Errorf("sherpago annotations \"get\" and \"no-retry\" for %s conflict, GET requests are retried", what)})
+	}
+	if get {
+		r += ", get: true"
+	}
+	if v, ok := l["timeout"]; ok {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			panic(genError{fmt.Errorf("bad timeout %q in sherpago annotation for %s, must be a positive duration", v, what)})
+		}
+		r += ", timeout: " + durationCode(d)
+	}
+	if noRetry {
+		r += ", noRetry: true"
+	}
+	if len(fn.Params) > 0 {
+		var names []string
+		for _, p := range fn.Params {
+			names = append(names, fmt.Sprintf("%q", p.Name))
+		}
+		r += ", params: []string{" + strings.Join(names, ", ") + "}"
+	}
+	return r
+}
+
+// durationCode returns a Go expression for d.
+func durationCode(d time.Duration) string {
+	units := []struct {
+		d    time.Duration
+		name string
+	}{
+		{time.Hour, "time.Hour"},
+		{time.Minute, "time.Minute"},
+		{time.Second, "time.Second"},
+		{time.Millisecond, "time.Millisecond"},
+		{time.Microsecond, "time.Microsecond"},
+	}
+	for _, u := range units {
+		if d%u.d == 0 {
+			return fmt.Sprintf("%d * %s", d/u.d, u.name)
+		}
+	}
+	return fmt.Sprintf("%d", d)
+}
+
+// isAnnotation returns whether line, from documentation, has annotations.
+func isAnnotation(line string) bool {
+	return strings.HasPrefix(strings.TrimSpace(line), annotationPrefix)
+}
+
+// annotations parses the annotation lines in docs of what, of the form
+// "sherpago: key[=value] ...", and returns the values by key. Unknown keys
+// cause a genError.
+func annotations(what, docs string, known map[string]bool) map[string]string {
+	r := map[string]string{}
+	for _, line := range strings.Split(docs, "\n") {
+		if !isAnnotation(line) {
+			continue
+		}
+		line = strings.TrimPrefix(strings.TrimSpace(line), annotationPrefix)
+		for _, word := range strings.Fields(line) {
+			t := strings.SplitN(word, "=", 2)
+			needValue, ok := known[t[0]]
+			if !ok {
+				panic(genError{fmt.Errorf("unknown sherpago annotation %q for %s", t[0], what)})
+			}
+			if needValue != (len(t) == 2) {
+				if needValue {
+					panic(genError{fmt.Errorf("sherpago annotation %q for %s requires a value", t[0], what)})
+				}
+				panic(genError{fmt.Errorf("sherpago annotation %q for %s does not take a value", t[0], what)})
+			}
+			r[t[0]] = strings.TrimPrefix(word, t[0]+"=")
+		}
+	}
+	return r
+}
@@ -0,0 +1,199 @@
+package sherpago
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/mjl-/sherpadoc"
+)
+
+// apiClientCode is the Go code for the client type of an additional API, see
+// Options.APIs, written after its doc comment. It is a format string with the
+// names of the client type, of the function returning a new client, the default
+// base URL, the names of the main client type and its option type, and the
+// name of the FunctionStats type as parameters.
+const apiClientCode = `type %[1]s %[4]s
+
+func %[2]s(opts ...%[5]s) *%[1]s {
+	c := &%[4]s{
+		BaseURL: "%[3]s",
+		Client: http.DefaultClient,
+		closer: &clientCloser{},
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return (*%[1]s)(c)
+}
+
+// With returns a copy of c with opts applied, like %[4]s.With.
+func (c *%[1]s) With(opts ...%[5]s) *%[1]s {
+	return (*%[1]s)((*%[4]s)(c).With(opts...))
+}
+
+func (c *%[1]s) call(ctx context.Context, info callInfo, params requestParams, result interface{}) error {
+	return (*%[4]s)(c).call(ctx, info, params, result)
+}
+
+// CloseIdleConnections closes idle connections, like %[4]s.CloseIdleConnections.
+func (c *%[1]s) CloseIdleConnections() {
+	(*%[4]s)(c).CloseIdleConnections()
+}
+
+// Close releases the resources of c, like %[4]s.Close.
+func (c *%[1]s) Close() error {
+	return (*%[4]s)(c).Close()
+}
+
+// Stats returns the statistics of the calls, like %[4]s.Stats.
+func (c *%[1]s) Stats() map[string]%[6]s {
+	return (*%[4]s)(c).Stats()
+}
+
+func (c *%[1]s) subscribe(ctx context.Context, path string, query url.Values, deliver func(name, id string, data []byte, err error) bool, done func()) error {
+	return (*%[4]s)(c).subscribe(ctx, path, query, deliver, done)
+}
+
+`
+
+// generateAPIClient writes the file for an additional API of Options.APIs,
+// with its client type, and its types that were not generated for another API.
+// Only the packages the code uses are imported.
+func (g *generator) generateAPIClient() {
+	out := g.out
+	var body bytes.Buffer
+	g.out = bufio.NewWriter(&body)
+	g.generateClient()
+	g.out = out
+
+	g.printf("package %s\n\n", g.opts.PackageName)
+	g.printImports(usedImports(g.opts.PackageName, body.Bytes(), append(apiImports, g.formatImports()...)))
+	g.printf("%s", body.Bytes())
+	g.flush()
+}
+
+// Packages the generated code for an additional API can use.
+var apiImports = []string{"bytes", "context", "encoding/json", "fmt", "iter", "math", "net", "net/http", "net/netip", "net/url", "sort", "strconv", "strings", "time", "unicode/utf8"}
+
+// usedImports returns the packages of imports, e.g. apiImports, that code, a Go
+// file without package clause and imports, refers to.
+func usedImports(packageName string, code []byte, imports []string) []string {
+	src := append([]byte("package "+packageName+"\n\n"), code...)
+	f, err := parser.ParseFile(token.NewFileSet(), "", src, 0)
+	if err != nil {
+		panic(genError{fmt.Errorf("parsing generated code: %s", err)})
+	}
+	// Package names are not resolved to objects by the parser.
+	used := map[string]bool{}
+	ast.Inspect(f, func(n ast.Node) bool {
+		if sel, ok := n.(*ast.SelectorExpr); ok {
+			if x, ok := sel.X.(*ast.Ident); ok && x.Obj == nil {
+				used[x.Name] = true
+			}
+		}
+		return true
+	})
+	var l []string
+	for _, imp := range imports {
+		if used[path.Base(imp)] {
+			l = append(l, imp)
+		}
+	}
+	return l
+}
+
+// typeSignatures returns the Go names and structure of the types of the API
+// by their sherpadoc names, for finding types that are the same in multiple
+// APIs. Documentation is ignored.
+func (g *generator) typeSignatures() map[string]string {
+	sigs := map[string]string{}
+	for _, sec := range g.sections() {
+		for _, t := range sec.Structs {
+			sig := "struct " + g.typeName(t.Name)
+			for _, f := range t.Fields {
+				sig += fmt.Sprintf("; %s %s", f.Name, strings.Join(f.Typewords, " "))
+				if c := g.fieldConversion(t, f); c != nil {
+					sig += " " + c.signature
+				}
+			}
+			sigs[t.Name] = sig
+		}
+		for _, t := range sec.Ints {
+			sig := "int " + g.typeName(t.Name)
+			for _, v := range t.Values {
+				sig += fmt.Sprintf("; %s %d", g.typeName(v.Name), v.Value)
+			}
+			sigs[t.Name] = sig
+		}
+		for _, t := range sec.Strings {
+			sig := "string " + g.typeName(t.Name)
+			for _, v := range t.Values {
+				sig += fmt.Sprintf("; %s %s", g.typeName(v.Name), strconv.Quote(v.Value))
+			}
+			sigs[t.Name] = sig
+		}
+	}
+	return sigs
+}
+
+// funcSuffix returns the suffix for the names of the generated types and
+// functions for function name, e.g. "UserGet" for paramsUserGet. For an
+// additional API, it starts with the name of its client type, so the names do
+// not conflict with those of other APIs.
+func (g *generator) funcSuffix(name string) string {
+	if g.mainClient != "" {
+		return g.opts.ClientName + goExportedName(name)
+	}
+	return goExportedName(name)
+}
+
+// generateAPIFiles adds the files for the additional APIs of opts to files,
+// with the types not generated before. Names are those from the generator for
+// the main API, for conflicts.
+func generateAPIFiles(files map[string][]byte, doc *sherpadoc.Section, opts Options, names map[string]struct{}) {
+	if opts.Snippet != "" {
+		panic(genError{fmt.Errorf("cannot generate additional APIs for a snippet")})
+	}
+	mainGen := newGenerator(doc, &bytes.Buffer{}, opts)
+	sigs := mainGen.typeSignatures()
+	clientNames := map[string]bool{mainGen.clientName(): true}
+	for i, api := range opts.APIs {
+		if api.ClientName == "" {
+			panic(genError{fmt.Errorf("missing client name for additional API %d", i)})
+		}
+		aopts := opts
+		aopts.ClientName = api.ClientName
+		aopts.BaseURL = api.BaseURL
+		aopts.APIs = nil
+		adoc := prepareDoc(api.Doc, aopts)
+
+		var buf bytes.Buffer
+		g := newGenerator(adoc, &buf, aopts)
+		if clientNames[g.clientName()] {
+			panic(genError{fmt.Errorf("duplicate client name %q", api.ClientName)})
+		}
+		clientNames[g.clientName()] = true
+		g.mainClient = mainGen.clientName()
+		g.mainOption = mainGen.clientIdent("ClientOption")
+		g.pkgNames = names
+		g.sharedTypes = map[string]bool{}
+		for name, sig := range g.typeSignatures() {
+			if other, ok := sigs[name]; !ok {
+				sigs[name] = sig
+			} else if other != sig {
+				panic(genError{fmt.Errorf("type %q of API for %s differs from the type with the same name of another API", name, api.ClientName)})
+			} else {
+				g.sharedTypes[name] = true
+			}
+		}
+		g.generateAPIClient()
+		files[opts.PackageName+"_"+strings.ToLower(api.ClientName)+".go"] = buf.Bytes()
+	}
+}
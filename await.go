@@ -0,0 +1,143 @@
+package sherpago
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/mjl-/sherpadoc"
+)
+
+// pollCode is the Go code for the Await methods of functions with the "await"
+// annotation. It is a format string with the name of the PollOptions type as
+// parameter.
+const pollCode = `// %[1]s configures how an Await method calls its function until an
+// operation is done. Zero values are replaced by defaults.
+type %[1]s struct {
+	Interval    time.Duration // Wait after the first call, 1 second by default.
+	MaxInterval time.Duration // Maximum wait between calls, 1 minute by default.
+	Multiplier  float64       // Factor for the wait after each call, 2 if < 1. Use 1 for calls at a fixed interval.
+	Timeout     time.Duration // If > 0, give up after this time.
+}
+
+// awaitPoll calls poll until it returns true or an error, waiting between calls
+// as configured by opts. It returns the error of the last call, or of the
+// context when it is done, or when its deadline is before the next call.
+func awaitPoll(ctx context.Context, opts %[1]s, poll func(ctx context.Context) (bool, error)) error {
+	if opts.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, opts.Timeout)
+		defer cancel()
+	}
+	interval := opts.Interval
+	if interval <= 0 {
+		interval = time.Second
+	}
+	maxInterval := opts.MaxInterval
+	if maxInterval <= 0 {
+		maxInterval = time.Minute
+	}
+	multiplier := opts.Multiplier
+	if multiplier < 1 {
+		multiplier = 2
+	}
+	for {
+		if done, err := poll(ctx); done || err != nil {
+			return err
+		}
+		if interval > maxInterval {
+			interval = maxInterval
+		}
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < interval {
+			return context.DeadlineExceeded
+		}
+		t := time.NewTimer(interval)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return ctx.Err()
+		case <-t.C:
+		}
+		interval = time.Duration(float64(interval) * multiplier)
+	}
+}
+
+`
+
+// await returns the Go expression for whether the operation is done for the
+// result r0 of fn, for a function with the "await" annotation, or the empty
+// string if fn has no such annotation. The annotation names a bool field of
+// the struct type of the result, true when done, or a string field followed
+// by the values for done, e.g. "state:done,failed".
+func (g *generator) await(fn *sherpadoc.Function) string {
+	what := "function " + fn.Name
+	v, ok := annotations(what, fn.Docs, functionAnnotations)["await"]
+	if !ok {
+		return ""
+	}
+	t := strings.SplitN(v, ":", 2)
+	if len(fn.Returns) != 1 {
+		panic(genError{fmt.Errorf("sherpago annotation \"await\" for %s requires a single result", what)})
+	}
+	tw := fn.Returns[0].Typewords
+	x := "r0"
+	var cond string
+	if len(tw) == 2 && tw[0] == "nullable" {
+		cond = "r0 != nil && "
+		tw = tw[1:]
+	}
+	var st sherpadoc.Struct
+	if len(tw) == 1 {
+		st = g.structs[tw[0]]
+	}
+	if st.Name == "" || g.union(st.Name) != nil {
+		panic(genError{fmt.Errorf("sherpago annotation \"await\" for %s requires a struct type as result", what)})
+	}
+	var ftw []string
+	for _, f := range st.Fields {
+		if f.Name == t[0] {
+			ftw = f.Typewords
+			x += "." + g.fieldName(f.Name)
+		}
+	}
+	if len(t) == 1 {
+		if len(ftw) != 1 || ftw[0] != "bool" {
+			panic(genError{fmt.Errorf("result of %s has no bool field %q for sherpago annotation \"await\"", what, t[0])})
+		}
+		return cond + x
+	}
+	if len(ftw) != 1 || ftw[0] != "string" && g.strs[ftw[0]].Name == "" {
+		panic(genError{fmt.Errorf("result of %s has no string field %q for sherpago annotation \"await\"", what, t[0])})
+	}
+	var l []string
+	for _, s := range strings.Split(t[1], ",") {
+		l = append(l, x+" == "+strconv.Quote(s))
+	}
+	if len(l) > 1 && cond != "" {
+		return cond + "(" + strings.Join(l, " || ") + ")"
+	}
+	return cond + strings.Join(l, " || ")
+}
+
+// awaitName returns the name of the Await method for fn.
+func (g *generator) awaitName(fn *sherpadoc.Function) string {
+	return "Await" + g.goName(fn.Name)
+}
+
+// generateAwait writes the Await method for fn, with done the expression for
+// whether the operation is done, see await.
+func (g *generator) generateAwait(fn *sherpadoc.Function, done string) {
+	whatParam := "parameter for " + fn.Name
+	name := g.goName(fn.Name)
+	params := []string{"ctx context.Context"}
+	args := []string{"ctx"}
+	for i, local := range g.goParamNames(fn) {
+		params = append(params, fmt.Sprintf("%s %s", local, g.goTypewords(whatParam, fn.Params[i].Typewords)))
+		args = append(args, local)
+	}
+	params = append(params, "pollOpts "+g.clientIdent("PollOptions"))
+	result := g.goTypewords(whatParam, fn.Returns[0].Typewords)
+	g.printf("// %s calls %s until the operation is done, waiting\n// between calls as configured by pollOpts. It returns the last result, and the\n// error of the last call, or of the context when it is done.\n", g.awaitName(fn), name)
+	g.printf("func (c *%s) %s(%s) (r0 %s, err error) {\n", g.clientName(), g.awaitName(fn), strings.Join(params, ", "), result)
+	g.printf("\terr = awaitPoll(ctx, pollOpts, func(ctx context.Context) (bool, error) {\n\t\tr0, err = c.%s(%s)\n\t\treturn %s, err\n\t})\n\treturn r0, err\n}\n\n", name, strings.Join(args, ", "), done)
+}
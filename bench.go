@@ -0,0 +1,135 @@
+package sherpago
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// GenerateBenchmarks reads sherpadoc from in and writes a Go test file to out
+// with benchmarks for encoding the parameters and decoding the results of each
+// function, using sample values, and a test calling all functions concurrently,
+// for the race detector. The file must be placed in the package generated by
+// Generate, with the same packageName.
+func GenerateBenchmarks(in io.Reader, out io.Writer, packageName string) (retErr error) {
+	defer recoverGenError(&retErr)
+
+	g := newGenerator(readDoc(in), out, Options{PackageName: packageName})
+	g.generateBenchmarks()
+	return nil
+}
+
+func (g *generator) generateBenchmarks() {
+	g.printf("package %s\n\n", g.opts.PackageName)
+	g.printImports(append([]string{"bytes", "context", "encoding/json", "net/http", "net/http/httptest", "strings", "sync", "testing", "time"}, g.formatImports()...))
+	g.printf(`var _ time.Time // in case "timestamp" is used
+var _ = json.Marshal
+var _ = bytes.NewReader
+
+`)
+
+	// Sample results by function name for the server of the concurrency test, and
+	// the calls it makes.
+	var results, calls string
+
+	for _, sec := range g.sections() {
+		for _, fn := range sec.Functions {
+			whatParam := "parameter for " + fn.Name
+			params := []string{}
+			for _, p := range fn.Params {
+				params = append(params, g.goSample(parseType(whatParam, p.Typewords), 0))
+			}
+			name := goExportedName(fn.Name)
+
+			vars := []string{}
+			for range fn.Returns {
+				vars = append(vars, "_")
+			}
+			args := append([]string{"ctx"}, params...)
+			calls += fmt.Sprintf("\t\t\t\tif %s := c.%s(%s); err != nil {\n\t\t\t\t\tt.Errorf(\"calling %s: %%v\", err)\n\t\t\t\t}\n", strings.Join(append(vars, "err"), ", "), g.goName(fn.Name), strings.Join(args, ", "), fn.Name)
+
+			g.printf(`func Benchmark%sEncode(b *testing.B) {
+	params := &params%[1]s{%[2]s}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		rb, err := encodeRequest(params)
+		if err != nil {
+			b.Fatal(err)
+		}
+		rb.release()
+	}
+}
+
+`, name, strings.Join(params, ", "))
+
+			if len(fn.Returns) == 0 {
+				continue
+			}
+			samples := []string{}
+			for _, t := range fn.Returns {
+				typ := parseType(whatParam, t.Typewords)
+				samples = append(samples, jsonValue(typ, g.goSample(typ, 0)))
+			}
+			// A single value is returned as is, multiple values as an array.
+			result := samples[0]
+			resultVar := "var r0 " + g.goTypewords(whatParam, fn.Returns[0].Typewords)
+			resultRef := jsonRef(parseType(whatParam, fn.Returns[0].Typewords), "r0")
+			if len(samples) > 1 {
+				result = fmt.Sprintf("[]interface{}{%s}", strings.Join(samples, ", "))
+				resultVar = "var result result" + name
+				resultRef = "&result"
+			}
+			results += fmt.Sprintf("\t\t%q: %s,\n", fn.Name, result)
+			g.printf(`func Benchmark%sDecode(b *testing.B) {
+	body, err := json.Marshal(map[string]interface{}{"result": %s})
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		%s
+		err := decodeResult(bytes.NewReader(body), %s)
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+`, name, result, resultVar, resultRef)
+		}
+	}
+
+	// A client is used from multiple goroutines at the same time, which must not
+	// cause data races, as reported by "go test -race". Also a copy with the
+	// options that share state between calls, and send requests concurrently.
+	g.printf(`func TestConcurrentCalls(t *testing.T) {
+	results := map[string]interface{}{
+%s	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name := r.URL.Path[strings.LastIndex(r.URL.Path, "/")+1:]
+		if err := json.NewEncoder(w).Encode(map[string]interface{}{"result": results[name]}); err != nil {
+			t.Errorf("writing response: %%v", err)
+		}
+	}))
+	defer srv.Close()
+
+	c := %s()
+	c.BaseURL = srv.URL + "/"
+	clients := []*%s{c, c.With(%s(), %s(time.Microsecond), %s())}
+	ctx := context.Background()
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for _, c := range clients {
+%s			}
+		}()
+	}
+	wg.Wait()
+}
+`, results, g.newClientName(), g.clientName(), g.clientIdent("WithSingleFlight"), g.clientIdent("WithHedging"), g.clientIdent("WithStats"), calls)
+
+	g.flush()
+}
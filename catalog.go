@@ -0,0 +1,122 @@
+package sherpago
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/mjl-/sherpadoc"
+)
+
+// catalogCode is the Go code with the types describing functions of the API,
+// and calling them by name, see Options.Catalog. It is a format string with the
+// names of the FunctionInfo and ParamInfo types as parameters.
+const catalogCode = `// %[1]s describes a function of the API, for generic user interfaces,
+// command-line programs and bridges over the client.
+type %[1]s struct {
+	Name    string      // Name in the sherpadoc, e.g. "userGet".
+	Method  string      // Name of the client method, e.g. "UserGet".
+	Section string      // Name of the section with the function.
+	Docs    string      // Documentation from the sherpadoc.
+	Params  []%[2]s
+	Returns []%[2]s
+
+	call callInfo // For DynamicCall.
+}
+
+// %[2]s describes a parameter or return value of a function.
+type %[2]s struct {
+	Name      string
+	Typewords []string // Type in the sherpadoc, e.g. ["nullable", "User"].
+	GoType    string   // Type in the client method, e.g. "*User".
+}
+
+// dynamicParams are the parameters of a call through DynamicCall.
+type dynamicParams []interface{}
+
+func (p dynamicParams) writeJSON(enc *json.Encoder, buf *bytes.Buffer) error {
+	buf.WriteByte('[')
+	for i, v := range p {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		if err := enc.Encode(v); err != nil {
+			return err
+		}
+	}
+	buf.WriteByte(']')
+	return nil
+}
+
+// dynamicCall calls function name of functions with call, for DynamicCall.
+func dynamicCall(ctx context.Context, call func(context.Context, callInfo, requestParams, interface{}) error, functions map[string]%[1]s, name string, params []interface{}) ([]json.RawMessage, error) {
+	fn, ok := functions[name]
+	if !ok {
+		return nil, &sherpa.Error{Code: sherpa.SherpaBadFunction, Message: fmt.Sprintf("function %%q does not exist", name)}
+	}
+	if len(params) != len(fn.Params) {
+		return nil, &sherpa.Error{Code: sherpa.SherpaBadParams, Message: fmt.Sprintf("function %%q takes %%d parameters, got %%d", name, len(fn.Params), len(params))}
+	}
+	var result json.RawMessage
+	if err := call(ctx, fn.call, dynamicParams(params), &result); err != nil {
+		return nil, err
+	}
+	switch len(fn.Returns) {
+	case 0:
+		return nil, nil
+	case 1:
+		return []json.RawMessage{result}, nil
+	}
+	// Multiple results are a JSON array.
+	var results []json.RawMessage
+	if err := json.Unmarshal(result, &results); err != nil || len(results) != len(fn.Returns) {
+		return nil, &sherpa.Error{Code: sherpa.SherpaBadResponse, Message: fmt.Sprintf("function %%q: result is not an array with %%d values", name, len(fn.Returns))}
+	}
+	return results, nil
+}
+
+`
+
+// catalogVar returns the name of the variable with the function catalog of the
+// client, e.g. "clientFunctions".
+func (g *generator) catalogVar() string {
+	return unexportedName(g.clientName()) + "Functions"
+}
+
+// generateCatalog writes the Functions method of the client, returning the
+// descriptions of its functions, the variable holding them, and the
+// DynamicCall method.
+func (g *generator) generateCatalog() {
+	info := g.clientIdent("FunctionInfo")
+	param := g.clientIdent("ParamInfo")
+
+	params := func(fn *sherpadoc.Function, l []sherpadoc.Arg) string {
+		if len(l) == 0 {
+			return "nil"
+		}
+		what := "parameter for " + fn.Name
+		var s []string
+		for _, a := range l {
+			s = append(s, fmt.Sprintf("{%q, %s, %q}", a.Name, typewordsLiteral(a.Typewords), g.goTypewords(what, a.Typewords)))
+		}
+		return fmt.Sprintf("[]%s{%s}", param, strings.Join(s, ", "))
+	}
+
+	g.printf("// Functions returns descriptions of the functions of the API, by their name in\n// the sherpadoc. The map is shared and must not be modified.\n")
+	g.printf("func (c *%s) Functions() map[string]%s {\n\treturn %s\n}\n\n", g.clientName(), info, g.catalogVar())
+	g.printf("// DynamicCall calls the function with name as in the sherpadoc, with params encoded as\n// JSON, returning the results as JSON, for scripting. It fails without sending a\n// request if the function does not exist, or params does not have a value for\n// each parameter, see Functions.\n")
+	g.printf("func (c *%s) DynamicCall(ctx context.Context, name string, params []interface{}) ([]json.RawMessage, error) {\n\treturn dynamicCall(ctx, c.call, %s, name, params)\n}\n\n", g.clientName(), g.catalogVar())
+
+	g.printf("var %s = map[string]%s{\n", g.catalogVar(), info)
+	var section func(sec *sherpadoc.Section)
+	section = func(sec *sherpadoc.Section) {
+		for _, fn := range sec.Functions {
+			call := fmt.Sprintf("callInfo{name: %q%s}", fn.Name, functionCallInfo(fn))
+			g.printf("\t%q: {%q, %q, %q, %q, %s, %s, %s},\n", fn.Name, fn.Name, g.goName(fn.Name), sec.Name, fn.Docs, params(fn, fn.Params), params(fn, fn.Returns), call)
+		}
+		for _, subsec := range sec.Sections {
+			section(subsec)
+		}
+	}
+	section(g.doc)
+	g.printf("}\n\n")
+}
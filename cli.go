@@ -0,0 +1,203 @@
+package sherpago
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// GenerateCLI reads sherpadoc from in and writes the Go source of a command-line
+// program to out. The program has a subcommand for each function, a flag for each
+// parameter, and prints the results as JSON. It uses the client package generated
+// by Generate, which it imports from clientImportPath. The baseURL is the default
+// for the -baseurl flag of the program.
+func GenerateCLI(in io.Reader, out io.Writer, clientImportPath, baseURL string) (retErr error) {
+	defer recoverGenError(&retErr)
+
+	g := newGenerator(readDoc(in), out, Options{BaseURL: baseURL, CLIImportPath: clientImportPath})
+	g.generateCLI()
+	return nil
+}
+
+func (g *generator) generateCLI() {
+	// The credential files are not available with TinyGo.
+	var credentials string
+	if !g.opts.TinyGo {
+		credentials = fmt.Sprintf("\tif path, err := api.%s(); err == nil {\n\t\tif _, err := os.Stat(path); err == nil {\n\t\t\tclient = client.With(api.%s(api.%s(path)))\n\t\t}\n\t}\n", g.clientIdent("DefaultCredentialFile"), g.clientIdent("WithCredentials"), g.clientIdent("CredentialFile"))
+	}
+	g.printf("// Command-line client for the %s sherpa API.\n", g.doc.Name)
+	g.printf(`//
+// Usage:
+//
+// 	%s [-baseurl URL] function [flags]
+//
+// Each function has its own flags for its parameters. String and bool parameters
+// are set directly, all others as JSON. Results are printed as JSON. The client
+// can be configured with environment variables, see the client package.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"log"
+	"os"
+	"time"
+
+	api %s
+)
+
+var _ time.Time // in case "timestamp" is used
+
+var baseURL = flag.String("baseurl", %s, "base URL of the API")
+
+// jsonValue is a flag.Value that parses its argument as JSON into v.
+type jsonValue struct {
+	v interface{}
+}
+
+func (j jsonValue) String() string {
+	if j.v == nil {
+		return ""
+	}
+	buf, _ := json.Marshal(j.v)
+	return string(buf)
+}
+
+func (j jsonValue) Set(s string) error {
+	return json.Unmarshal([]byte(s), j.v)
+}
+
+func output(results ...interface{}) {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "\t")
+	for _, r := range results {
+		err := enc.Encode(r)
+		if err != nil {
+			log.Fatalf("writing result: %%s", err)
+		}
+	}
+}
+
+func parseFlags(fs *flag.FlagSet, args []string) {
+	fs.Parse(args)
+	if fs.NArg() != 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+}
+
+func newClient() *api.%[4]s {
+	client, err := api.%[5]sFromEnv()
+	if err != nil {
+		log.Fatalf("%%s", err)
+	}
+	// The flag overrides the environment if set.
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == "baseurl" {
+			client.BaseURL = *baseURL
+		}
+	})
+%[6]s	return client
+}
+
+`, strings.ToLower(g.doc.Name), strconv.Quote(g.opts.CLIImportPath), strconv.Quote(g.opts.BaseURL), g.clientName(), g.newClientName(), credentials)
+
+	type command struct {
+		name, docs string
+	}
+	var commands []command
+
+	for _, sec := range g.sections() {
+		for _, fn := range sec.Functions {
+			lines := docLines(sanitizeDoc(fn.Docs))
+			summary := ""
+			if len(lines) > 0 {
+				summary = lines[0]
+			}
+			commands = append(commands, command{fn.Name, summary})
+
+			whatParam := "parameter for " + fn.Name
+			g.printf(`func cmd%s(args []string) {
+	fs := flag.NewFlagSet(%s, flag.ExitOnError)
+	fs.Usage = func() {
+		log.Printf("usage: %%s [flags] %s [flags]", os.Args[0])
+		log.Print(%s)
+		fs.PrintDefaults()
+	}
+`, goExportedName(fn.Name), strconv.Quote(fn.Name), fn.Name, strconv.Quote(strings.Join(docLines(sanitizeDoc(fn.Docs)), "\n")+"\n\n"))
+			if len(fn.Params) > 0 {
+				g.printf("\tvar params struct {\n")
+				for _, p := range fn.Params {
+					g.printf("\t\t%s %s\n", goExportedName(p.Name), g.qualifiedGoType(parseType(whatParam, p.Typewords), "api"))
+				}
+				g.printf("\t}\n")
+			}
+
+			args := []string{"context.Background()"}
+			for _, p := range fn.Params {
+				field := "params." + goExportedName(p.Name)
+				args = append(args, field)
+				usage := strconv.Quote(strings.Join(p.Typewords, " "))
+				switch strings.Join(p.Typewords, " ") {
+				case "string":
+					g.printf("\tfs.StringVar(&%s, %s, \"\", %s)\n", field, strconv.Quote(p.Name), usage)
+				case "bool":
+					g.printf("\tfs.BoolVar(&%s, %s, false, %s)\n", field, strconv.Quote(p.Name), usage)
+				default:
+					usage = strconv.Quote("JSON " + strings.Join(p.Typewords, " "))
+					g.printf("\tfs.Var(jsonValue{&%s}, %s, %s)\n", field, strconv.Quote(p.Name), usage)
+				}
+			}
+			g.printf("\tparseFlags(fs, args)\n")
+
+			results := []string{}
+			for i := range fn.Returns {
+				results = append(results, fmt.Sprintf("r%d", i))
+			}
+			g.printf("\t%s := newClient().%s(%s)\n", strings.Join(append(results, "err"), ", "), g.goName(fn.Name), strings.Join(args, ", "))
+			g.printf("\tif err != nil {\n\t\tlog.Fatalf(\"%s: %%s\", err)\n\t}\n", fn.Name)
+			if len(results) > 0 {
+				g.printf("\toutput(%s)\n", strings.Join(results, ", "))
+			}
+			g.printf("}\n\n")
+		}
+	}
+
+	g.printf(`func usage() {
+	log.Printf("usage: %%s [flags] function [flags]", os.Args[0])
+	flag.PrintDefaults()
+	log.Println("")
+	log.Println("functions:")
+`)
+	for _, c := range commands {
+		g.printf("\tlog.Println(%s)\n", strconv.Quote("\t"+c.name+"\t"+c.docs))
+	}
+	g.printf(`}
+
+func main() {
+	log.SetFlags(0)
+	flag.Usage = usage
+	flag.Parse()
+	args := flag.Args()
+	if len(args) == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	switch args[0] {
+`)
+	for _, c := range commands {
+		g.printf("\tcase %s:\n\t\tcmd%s(args[1:])\n", strconv.Quote(c.name), goExportedName(c.name))
+	}
+	g.printf(`	default:
+		log.Printf("unknown function %%q", args[0])
+		flag.Usage()
+		os.Exit(2)
+	}
+}
+`)
+
+	g.flush()
+}
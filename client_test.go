@@ -0,0 +1,2264 @@
+package sherpago
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// testDoc is the sherpadoc for the clients generated by testGenerated.
+const testDoc = `{
+	"Name": "Test",
+	"Docs": "",
+	"Functions": [
+		{"Name": "echo", "Docs": "", "Params": [{"Name": "s", "Typewords": ["string"]}], "Returns": [{"Name": "r", "Typewords": ["string"]}]},
+		{"Name": "whoami", "Docs": "sherpago: get", "Params": [], "Returns": [{"Name": "r", "Typewords": ["string"]}]},
+		{"Name": "login", "Docs": "", "Params": [{"Name": "username", "Typewords": ["string"]}, {"Name": "password", "Typewords": ["string"]}], "Returns": [{"Name": "token", "Typewords": ["string"]}]}
+	],
+	"Sections": [],
+	"Structs": [],
+	"Ints": [],
+	"Strings": [],
+	"SherpaVersion": 0,
+	"SherpadocVersion": 1
+}`
+
+// testServerCode is a test file for the package generated by testGenerated,
+// with a server for the functions of testDoc, and a server for any sherpadoc
+// returning results as JSON.
+const testServerCode = `package example
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// newServer returns a server with newHandler for handle.
+func newServer(t *testing.T, handle func(r *http.Request, function string, params []string) (string, error)) *httptest.Server {
+	srv := httptest.NewServer(newHandler(t, handle))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// newHandler returns a handler calling handle for calls, with the name of the
+// function and its parameters. The result or error of handle is the response.
+func newHandler(t *testing.T, handle func(r *http.Request, function string, params []string) (string, error)) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body := r.URL.Query().Get("body")
+		if r.Method == "POST" {
+			buf, err := io.ReadAll(r.Body)
+			if err != nil {
+				t.Errorf("reading request: %v", err)
+			}
+			body = string(buf)
+		}
+		var req struct{ Params []string }
+		if err := json.Unmarshal([]byte(body), &req); err != nil {
+			http.Error(w, "bad request: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		result, err := handle(r, r.URL.Path[strings.LastIndex(r.URL.Path, "/")+1:], req.Params)
+		resp := map[string]interface{}{"result": result}
+		if serr, ok := err.(*Error); ok {
+			resp = map[string]interface{}{"error": serr}
+		} else if err != nil {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+		if err := json.NewEncoder(w).Encode(resp); err != nil {
+			t.Errorf("writing response: %v", err)
+		}
+	})
+}
+
+// newRawServer returns a server calling handle for calls with POST requests,
+// with the name of the function and its parameters as compact JSON array.
+// Handle returns the JSON of the result.
+func newRawServer(t *testing.T, handle func(function string, params json.RawMessage) string) *httptest.Server {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct{ Params json.RawMessage }
+		var params bytes.Buffer
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "bad request: "+err.Error(), http.StatusBadRequest)
+			return
+		} else if err := json.Compact(&params, req.Params); err != nil {
+			http.Error(w, "bad request: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		result := handle(r.URL.Path[strings.LastIndex(r.URL.Path, "/")+1:], params.Bytes())
+		w.Header().Set("Content-Type", "application/json")
+		if _, err := io.WriteString(w, "{\"result\":"+result+"}"); err != nil {
+			t.Errorf("writing response: %v", err)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+`
+
+// testGenerated generates the client for testDoc with opts, without the sherpa
+// dependency, in a module in a temporary directory, with testServerCode and
+// test as test files, and runs its tests with the race detector if available.
+// Test is the code of a test file, starting with its imports.
+func testGenerated(t *testing.T, opts Options, test string) {
+	t.Helper()
+	testGeneratedDoc(t, testDoc, opts, test)
+}
+
+// testGeneratedDoc is like testGenerated, but generates the client for
+// sherpadoc doc.
+func testGeneratedDoc(t *testing.T, doc string, opts Options, test string) {
+	t.Helper()
+	if testing.Short() {
+		t.Skip("not building generated code in short mode")
+	}
+	gobin, err := exec.LookPath("go")
+	if err != nil {
+		t.Skipf("looking for go command: %v", err)
+	}
+
+	opts.PackageName = "example"
+	opts.BaseURL = "http://localhost/example/"
+	opts.ModulePath = "example.org/example"
+	opts.NoSherpaDep = true
+	files, err := GenerateFiles(strings.NewReader(doc), opts)
+	if err != nil {
+		t.Fatalf("generating client: %v", err)
+	}
+	files["server_test.go"] = []byte(testServerCode)
+	files["example_test.go"] = []byte("package example\n\n" + test)
+	dir := t.TempDir()
+	for name, buf := range files {
+		p := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, buf, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	args := []string{"test", "-count=1"}
+	if out, err := exec.Command(gobin, "env", "CGO_ENABLED").Output(); err == nil && strings.TrimSpace(string(out)) == "1" {
+		args = append(args, "-race")
+	}
+	cmd := exec.Command(gobin, append(args, ".")...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "GOFLAGS=-mod=mod", "GOWORK=off", "GOPROXY=off", "GOTOOLCHAIN=local")
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("testing generated client: %v\n%s", err, out)
+	}
+}
+
+func TestSingleFlightHeaders(t *testing.T) {
+	// Concurrent calls of copies of a client with other credentials must not
+	// share a request.
+	testGenerated(t, Options{}, `import (
+	"context"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+)
+
+type tokenProvider string
+
+func (p tokenProvider) Credentials(ctx context.Context) (http.Header, error) {
+	return http.Header{"Authorization": {"Bearer " + string(p)}}, nil
+}
+
+func TestSingleFlight(t *testing.T) {
+	srv := newServer(t, func(r *http.Request, function string, params []string) (string, error) {
+		// Long enough for the calls to be in progress at the same time.
+		time.Sleep(100 * time.Millisecond)
+		return r.Header.Get("Authorization"), nil
+	})
+	c := NewClient(WithSingleFlight())
+	c.BaseURL = srv.URL + "/"
+
+	clients := map[string]*Client{
+		"Basic alice":  c.With(WithHeaders(http.Header{"Authorization": {"Basic alice"}})),
+		"Basic bob":    c.With(WithHeaders(http.Header{"Authorization": {"Basic bob"}})),
+		"Bearer carol": c.With(WithCredentials(tokenProvider("carol"))),
+		"Bearer dave":  c.With(WithCredentials(tokenProvider("dave"))),
+	}
+	var wg sync.WaitGroup
+	for auth, client := range clients {
+		for i := 0; i < 2; i++ {
+			wg.Add(1)
+			go func(auth string, client *Client) {
+				defer wg.Done()
+				r, err := client.Whoami(context.Background())
+				if err != nil {
+					t.Errorf("calling whoami: %v", err)
+				} else if r != auth {
+					t.Errorf("whoami for %q returned %q", auth, r)
+				}
+			}(auth, client)
+		}
+	}
+	wg.Wait()
+}
+`)
+}
+
+func TestSingleFlightCancel(t *testing.T) {
+	// A waiting call gets the result of the shared request, also when the context
+	// of the call that started it is done. The request is canceled when no call
+	// waits for it anymore.
+	testGenerated(t, Options{}, `import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestSingleFlightCancel(t *testing.T) {
+	requests := make(chan struct{}, 10)
+	release := make(chan struct{})
+	canceled := make(chan struct{}, 10)
+	srv := newServer(t, func(r *http.Request, function string, params []string) (string, error) {
+		requests <- struct{}{}
+		select {
+		case <-release:
+			return "ok", nil
+		case <-r.Context().Done():
+			canceled <- struct{}{}
+			return "", r.Context().Err()
+		}
+	})
+	c := NewClient(WithSingleFlight())
+	c.BaseURL = srv.URL + "/"
+
+	ctx, cancel := context.WithCancel(context.Background())
+	first := make(chan error, 1)
+	go func() {
+		_, err := c.Whoami(ctx)
+		first <- err
+	}()
+	<-requests
+	second := make(chan error, 1)
+	go func() {
+		r, err := c.Whoami(context.Background())
+		if err == nil && r != "ok" {
+			t.Errorf("whoami returned %q", r)
+		}
+		second <- err
+	}()
+	// Give the second call time to join the request of the first.
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+	if err := <-first; err == nil {
+		t.Fatalf("first call did not fail after cancel")
+	}
+	close(release)
+	if err := <-second; err != nil {
+		t.Fatalf("second call: %v", err)
+	}
+	if len(requests) != 0 {
+		t.Fatalf("calls did not share a request")
+	}
+
+	release = make(chan struct{})
+	ctx, cancel = context.WithCancel(context.Background())
+	go func() {
+		_, err := c.Whoami(ctx)
+		first <- err
+	}()
+	<-requests
+	cancel()
+	<-first
+	select {
+	case <-canceled:
+	case <-time.After(10 * time.Second):
+		t.Fatalf("request not canceled after its only call was canceled")
+	}
+}
+`)
+}
+
+func TestRequestBodyReuse(t *testing.T) {
+	// A transport can read and close the request body after returning the
+	// response. The buffer with the body must not be reused for other calls
+	// before.
+	testGenerated(t, Options{}, `import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// lateTransport responds before it reads the request body.
+type lateTransport struct {
+	t       *testing.T
+	handler http.Handler
+	wg      sync.WaitGroup
+}
+
+func (lt *lateTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	id := r.Header.Get("X-Call")
+	lt.wg.Add(1)
+	go func() {
+		defer lt.wg.Done()
+		defer r.Body.Close()
+		time.Sleep(10 * time.Millisecond)
+		buf, err := io.ReadAll(r.Body)
+		if err != nil {
+			lt.t.Errorf("reading request body: %v", err)
+		} else if exp := fmt.Sprintf("{\"params\":[%q\n]}\n", strings.Repeat(id, 1000)); string(buf) != exp {
+			lt.t.Errorf("request body for %s was changed", id)
+		}
+	}()
+	rec := httptest.NewRecorder()
+	lt.handler.ServeHTTP(rec, httptest.NewRequest("POST", r.URL.String(), strings.NewReader(fmt.Sprintf("{\"params\":[%q]}", id))))
+	return rec.Result(), nil
+}
+
+func TestRequestBodyReuse(t *testing.T) {
+	lt := &lateTransport{t: t}
+	lt.handler = newHandler(t, func(r *http.Request, function string, params []string) (string, error) {
+		return params[0], nil
+	})
+	c := NewClient()
+	c.Client = &http.Client{Transport: lt}
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 10; j++ {
+				id := fmt.Sprintf("%04d%04d", i, j)
+				ctx := HeaderContext(context.Background(), http.Header{"X-Call": {id}})
+				if r, err := c.Echo(ctx, strings.Repeat(id, 1000)); err != nil {
+					t.Errorf("calling echo: %v", err)
+				} else if r != id {
+					t.Errorf("echo returned %q, expected %q", r, id)
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+	lt.wg.Wait()
+}
+`)
+}
+
+func TestHedgingBody(t *testing.T) {
+	// The first request of a hedged call loses, and its body is read only after
+	// the call returned, as a transport may do. The buffer with the body must not
+	// be reused for other calls before.
+	testGenerated(t, Options{}, `import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// hedgeTransport does not respond to the first request of a call, and reads
+// its body after the request was canceled.
+type hedgeTransport struct {
+	t       *testing.T
+	handler http.Handler
+	wg      sync.WaitGroup
+
+	sync.Mutex
+	seen map[string]bool
+}
+
+func (ht *hedgeTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	id := r.Header.Get("X-Call")
+	ht.Lock()
+	first := !ht.seen[id]
+	ht.seen[id] = true
+	ht.Unlock()
+	if !first {
+		defer r.Body.Close()
+		rec := httptest.NewRecorder()
+		ht.handler.ServeHTTP(rec, r)
+		return rec.Result(), nil
+	}
+
+	<-r.Context().Done()
+	ht.wg.Add(1)
+	go func() {
+		defer ht.wg.Done()
+		defer r.Body.Close()
+		time.Sleep(10 * time.Millisecond)
+		buf, err := io.ReadAll(r.Body)
+		if err != nil {
+			ht.t.Errorf("reading request body: %v", err)
+		} else if exp := fmt.Sprintf("{\"params\":[%q\n]}\n", strings.Repeat(id, 1000)); string(buf) != exp {
+			ht.t.Errorf("request body for %s was changed", id)
+		}
+	}()
+	return nil, r.Context().Err()
+}
+
+func TestHedgingBody(t *testing.T) {
+	ht := &hedgeTransport{t: t, seen: map[string]bool{}}
+	ht.handler = newHandler(t, func(r *http.Request, function string, params []string) (string, error) {
+		return params[0][:8], nil
+	})
+	c := NewClient(WithHedging(time.Millisecond))
+	c.Client = &http.Client{Transport: ht}
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 10; j++ {
+				id := fmt.Sprintf("%04d%04d", i, j)
+				ctx := HeaderContext(context.Background(), http.Header{"X-Call": {id}})
+				if r, err := c.Echo(ctx, strings.Repeat(id, 1000)); err != nil {
+					t.Errorf("calling echo: %v", err)
+				} else if r != id {
+					t.Errorf("echo returned %q, expected %q", r, id)
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+	ht.wg.Wait()
+}
+`)
+}
+
+func TestRedaction(t *testing.T) {
+	// Parameters are an array in the request, they are redacted by their names.
+	testGenerated(t, Options{}, `import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestRedaction(t *testing.T) {
+	srv := newServer(t, func(r *http.Request, function string, params []string) (string, error) {
+		return "token-" + params[0], nil
+	})
+	var log strings.Builder
+	logf := func(format string, args ...interface{}) {
+		fmt.Fprintf(&log, format+"\n", args...)
+	}
+	c := NewClient(WithDebugLog(logf), WithRedaction("password"))
+	c.BaseURL = srv.URL + "/"
+	if _, err := c.Login(context.Background(), "alice", "secret"); err != nil {
+		t.Fatalf("calling login: %v", err)
+	}
+	if s := log.String(); strings.Contains(s, "secret") || !strings.Contains(s, "alice") || !strings.Contains(s, "token-alice") {
+		t.Fatalf("password not redacted, or other values missing in log:\n%s", s)
+	}
+}
+`)
+}
+
+func TestCredentialFile(t *testing.T) {
+	// Credentials are written to a new temporary file that is renamed, and
+	// only readable by the user.
+	testGenerated(t, Options{}, `import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCredentialFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "example", "credentials.json")
+	os.MkdirAll(filepath.Dir(path), 0700)
+	if err := os.WriteFile(path+".tmp", []byte("other"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	for _, token := range []string{"a", "b"} {
+		if err := WriteCredentialFile(path, Credentials{Token: token}); err != nil {
+			t.Fatalf("writing credentials: %v", err)
+		}
+		h, err := CredentialFile(path).Credentials(context.Background())
+		if err != nil {
+			t.Fatalf("reading credentials: %v", err)
+		} else if auth := h.Get("Authorization"); auth != "Bearer "+token {
+			t.Fatalf("got authorization %q, expected token %q", auth, token)
+		}
+	}
+	if fi, err := os.Stat(path); err != nil {
+		t.Fatal(err)
+	} else if fi.Mode().Perm() != 0600 {
+		t.Fatalf("credential file has mode %v, expected 0600", fi.Mode().Perm())
+	}
+	if buf, err := os.ReadFile(path + ".tmp"); err != nil || string(buf) != "other" {
+		t.Fatalf("file with .tmp suffix was changed")
+	}
+	if l, err := filepath.Glob(filepath.Join(filepath.Dir(path), "*")); err != nil || len(l) != 2 {
+		t.Fatalf("files in directory of credentials: %v %v", l, err)
+	}
+}
+`)
+}
+
+func TestCloseIdleConnections(t *testing.T) {
+	// Only the idle connections of a transport created by the client are closed,
+	// not those of transports that may be shared.
+	testGenerated(t, Options{}, `import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestCloseIdleConnections(t *testing.T) {
+	var mu sync.Mutex
+	var closed int
+	srv := httptest.NewUnstartedServer(newHandler(t, func(r *http.Request, function string, params []string) (string, error) {
+		return "", nil
+	}))
+	srv.Config.ConnState = func(conn net.Conn, state http.ConnState) {
+		if state == http.StateClosed {
+			mu.Lock()
+			closed++
+			mu.Unlock()
+		}
+	}
+	srv.Start()
+	defer srv.Close()
+	waitClosed := func(exp int) {
+		t.Helper()
+		for i := 0; ; i++ {
+			mu.Lock()
+			n := closed
+			mu.Unlock()
+			if n == exp && i >= 10 {
+				return
+			} else if n > exp || i >= 100 {
+				t.Fatalf("%d connections closed, expected %d", n, exp)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+
+	tr := &http.Transport{}
+	defer tr.CloseIdleConnections()
+	shared := NewClient()
+	shared.BaseURL = srv.URL + "/"
+	shared.Client = &http.Client{Transport: tr}
+	if _, err := shared.Whoami(context.Background()); err != nil {
+		t.Fatalf("calling whoami: %v", err)
+	}
+	shared.CloseIdleConnections()
+	waitClosed(0)
+
+	own := shared.With(WithTransportTuning(TransportTuning{MaxIdleConns: 10}))
+	if _, err := own.Whoami(context.Background()); err != nil {
+		t.Fatalf("calling whoami: %v", err)
+	}
+	own.CloseIdleConnections()
+	waitClosed(1)
+}
+`)
+}
+
+func TestUnauthorizedRetry(t *testing.T) {
+	// After a 401, the call is sent again with the refreshed headers, replacing
+	// those of the credentials and context, on the connection of the first
+	// response.
+	testGenerated(t, Options{}, `import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+type tokenProvider string
+
+func (p tokenProvider) Credentials(ctx context.Context) (http.Header, error) {
+	return http.Header{"Authorization": {"Bearer " + string(p)}}, nil
+}
+
+func TestUnauthorizedRetry(t *testing.T) {
+	var mu sync.Mutex
+	var conns int
+	srv := httptest.NewUnstartedServer(newHandler(t, func(r *http.Request, function string, params []string) (string, error) {
+		if auth := r.Header.Get("Authorization"); auth != "Bearer new" {
+			return "", errors.New("bad token " + auth)
+		}
+		return "ok", nil
+	}))
+	srv.Config.ConnState = func(conn net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			mu.Lock()
+			conns++
+			mu.Unlock()
+		}
+	}
+	srv.Start()
+	defer srv.Close()
+
+	var refreshes int
+	refresh := func(ctx context.Context, function string) (http.Header, error) {
+		refreshes++
+		return http.Header{"Authorization": {"Bearer new"}}, nil
+	}
+	c := NewClient(WithCredentials(tokenProvider("old")), WithUnauthorized(refresh))
+	c.BaseURL = srv.URL + "/"
+	c.Client = &http.Client{Transport: &http.Transport{}}
+	defer c.Client.CloseIdleConnections()
+	ctx := HeaderContext(context.Background(), http.Header{"Authorization": {"Bearer context"}})
+	for i := 0; i < 2; i++ {
+		if r, err := c.Whoami(ctx); err != nil {
+			t.Fatalf("calling whoami: %v", err)
+		} else if r != "ok" {
+			t.Fatalf("whoami returned %q", r)
+		}
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if refreshes != 1 || conns != 1 {
+		t.Fatalf("%d refreshes and %d connections, expected 1 of each", refreshes, conns)
+	}
+}
+`)
+}
+
+func TestConcurrentCalls(t *testing.T) {
+	// The generated TestConcurrentCalls of the benchmarks calls all functions from
+	// multiple goroutines, also with hedging and single-flight requests, run with
+	// the race detector.
+	testGenerated(t, Options{Benchmarks: true}, "")
+}
+
+func TestWebSocket(t *testing.T) {
+	// Calls are sent over a single connection, also with a timeout for the
+	// http.Client, and after the context of the call that connected is canceled.
+	testGenerated(t, Options{WebSocket: true}, `import (
+	"context"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// serveWebSocket answers calls of echo on a WebSocket connection.
+func serveWebSocket(t *testing.T, w http.ResponseWriter, r *http.Request) {
+	sum := sha1.Sum([]byte(r.Header.Get("Sec-WebSocket-Key") + "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"))
+	w.Header().Set("Connection", "Upgrade")
+	w.Header().Set("Upgrade", "websocket")
+	w.Header().Set("Sec-WebSocket-Accept", base64.StdEncoding.EncodeToString(sum[:]))
+	w.WriteHeader(http.StatusSwitchingProtocols)
+	conn, brw, err := http.NewResponseController(w).Hijack()
+	if err != nil {
+		t.Errorf("hijacking connection: %v", err)
+		return
+	}
+	defer conn.Close()
+	for {
+		// Frames from the client are small, masked, and not fragmented.
+		var h [6]byte
+		if _, err := io.ReadFull(brw, h[:]); err != nil {
+			return
+		}
+		payload := make([]byte, h[1]&0x7f)
+		if _, err := io.ReadFull(brw, payload); err != nil {
+			return
+		}
+		for i := range payload {
+			payload[i] ^= h[2+i%4]
+		}
+		var call struct {
+			ID       int64
+			Function string
+			Params   []string
+		}
+		if err := json.Unmarshal(payload, &call); err != nil || call.Function != "echo" {
+			t.Errorf("bad call %q: %v", payload, err)
+			return
+		}
+		resp, _ := json.Marshal(map[string]interface{}{"id": call.ID, "result": call.Params[0]})
+		frame := append([]byte{0x81, 126, 0, 0}, resp...)
+		binary.BigEndian.PutUint16(frame[2:], uint16(len(resp)))
+		if _, err := conn.Write(frame); err != nil {
+			return
+		}
+	}
+}
+
+func TestWebSocket(t *testing.T) {
+	var conns int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&conns, 1)
+		serveWebSocket(t, w, r)
+	}))
+	defer srv.Close()
+
+	c := NewClient(WithWebSocket("ws" + srv.URL[len("http"):] + "/ws"))
+	defer c.Close()
+	c.Client = &http.Client{Timeout: time.Minute}
+	ctx, cancel := context.WithCancel(context.Background())
+	if r, err := c.Echo(ctx, "first"); err != nil {
+		t.Fatalf("calling echo: %v", err)
+	} else if r != "first" {
+		t.Fatalf("echo returned %q", r)
+	}
+	cancel()
+	for i := 0; i < 3; i++ {
+		if r, err := c.Echo(context.Background(), "next"); err != nil {
+			t.Fatalf("calling echo: %v", err)
+		} else if r != "next" {
+			t.Fatalf("echo returned %q", r)
+		}
+	}
+	if n := atomic.LoadInt32(&conns); n != 1 {
+		t.Fatalf("%d connections, expected 1", n)
+	}
+}
+`)
+}
+
+// validateDoc has a struct with an enum and an array, for TestValidate.
+const validateDoc = `{
+	"Name": "Test",
+	"Docs": "",
+	"Functions": [
+		{"Name": "getUser", "Docs": "", "Params": [], "Returns": [{"Name": "r", "Typewords": ["User"]}]},
+		{"Name": "setRole", "Docs": "", "Params": [{"Name": "role", "Typewords": ["Role"]}], "Returns": []}
+	],
+	"Sections": [],
+	"Structs": [
+		{"Name": "User", "Docs": "", "Fields": [{"Name": "name", "Docs": "", "Typewords": ["string"]}, {"Name": "role", "Docs": "", "Typewords": ["Role"]}, {"Name": "groups", "Docs": "", "Typewords": ["[]", "string"]}]}
+	],
+	"Ints": [],
+	"Strings": [
+		{"Name": "Role", "Docs": "", "Values": [{"Name": "RoleAdmin", "Value": "admin", "Docs": ""}, {"Name": "RoleUser", "Value": "user", "Docs": ""}]}
+	],
+	"SherpaVersion": 0,
+	"SherpadocVersion": 1
+}`
+
+func TestValidate(t *testing.T) {
+	// Results that do not match the sherpadoc are returned with a ValidationError,
+	// and invalid parameters are not sent.
+	testGeneratedDoc(t, validateDoc, Options{Validate: true}, `import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	var user string
+	var calls int
+	srv := newRawServer(t, func(function string, params json.RawMessage) string {
+		calls++
+		if function == "getUser" {
+			return user
+		}
+		return "null"
+	})
+	c := NewClient()
+	c.BaseURL = srv.URL + "/"
+
+	user = "{\"name\": \"alice\", \"role\": \"admin\", \"groups\": []}"
+	if u, err := c.GetUser(context.Background()); err != nil {
+		t.Fatalf("getting valid user: %v", err)
+	} else if u.Name != "alice" || u.Role != RoleAdmin {
+		t.Fatalf("got user %#v", u)
+	}
+
+	for _, test := range []struct{ user, path string }{
+		{"{\"name\": \"bob\", \"role\": \"other\", \"groups\": []}", "r.role"},
+		{"{\"name\": \"bob\", \"role\": \"user\", \"groups\": null}", "r.groups"},
+	} {
+		user = test.user
+		var verr *ValidationError
+		if _, err := c.GetUser(context.Background()); !errors.As(err, &verr) {
+			t.Fatalf("getting user %s: got error %v, expected validation error", test.user, err)
+		} else if verr.Function != "getUser" || verr.Path != test.path {
+			t.Fatalf("getting user %s: got validation error %#v, expected path %s", test.user, verr, test.path)
+		}
+	}
+
+	calls = 0
+	var verr *ValidationError
+	if err := c.SetRole(context.Background(), Role("other")); !errors.As(err, &verr) || verr.Path != "role" {
+		t.Fatalf("setting invalid role: got error %v, expected validation error for role", err)
+	}
+	if calls != 0 {
+		t.Fatalf("invalid parameter was sent")
+	}
+	if err := c.SetRole(context.Background(), RoleUser); err != nil || calls != 1 {
+		t.Fatalf("setting valid role: %v, %d calls", err, calls)
+	}
+}
+`)
+}
+
+// bitmaskDoc has an int enum with flags, for TestBitmask.
+const bitmaskDoc = `{
+	"Name": "Test",
+	"Docs": "",
+	"Functions": [
+		{"Name": "chmod", "Docs": "", "Params": [{"Name": "p", "Typewords": ["Perm"]}], "Returns": [{"Name": "r", "Typewords": ["Perm"]}]}
+	],
+	"Sections": [],
+	"Structs": [],
+	"Ints": [
+		{"Name": "Perm", "Docs": "sherpago: bitmask", "Values": [{"Name": "PermNone", "Value": 0, "Docs": ""}, {"Name": "PermRead", "Value": 1, "Docs": ""}, {"Name": "PermWrite", "Value": 2, "Docs": ""}, {"Name": "PermExec", "Value": 4, "Docs": ""}]}
+	],
+	"Strings": [],
+	"SherpaVersion": 0,
+	"SherpadocVersion": 1
+}`
+
+func TestBitmask(t *testing.T) {
+	// Combined flags are sent and received as numbers, and are valid values.
+	testGeneratedDoc(t, bitmaskDoc, Options{Validate: true}, `import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+func TestBitmask(t *testing.T) {
+	var result string
+	srv := newRawServer(t, func(function string, params json.RawMessage) string {
+		if string(params) != "[5]" {
+			t.Errorf("got params %s, expected [5]", params)
+		}
+		return result
+	})
+	c := NewClient()
+	c.BaseURL = srv.URL + "/"
+	p := PermNone.Set(PermRead | PermWrite | PermExec).Clear(PermWrite)
+
+	result = "3"
+	if r, err := c.Chmod(context.Background(), p); err != nil {
+		t.Fatalf("calling chmod: %v", err)
+	} else if !r.Has(PermRead|PermWrite) || r.Has(PermExec) || r.String() != "PermRead|PermWrite" {
+		t.Fatalf("got %v, expected PermRead|PermWrite", r)
+	}
+	if s := PermNone.String(); s != "PermNone" {
+		t.Fatalf("got %q for no flags", s)
+	}
+
+	result = "9"
+	var verr *ValidationError
+	if _, err := c.Chmod(context.Background(), p); !errors.As(err, &verr) {
+		t.Fatalf("got error %v for unknown flag, expected validation error", err)
+	}
+}
+`)
+}
+
+// unionDoc has a union with two variants, for TestUnion.
+const unionDoc = `{
+	"Name": "Test",
+	"Docs": "",
+	"Functions": [
+		{"Name": "convert", "Docs": "", "Params": [{"Name": "s", "Typewords": ["Shape"]}], "Returns": [{"Name": "r", "Typewords": ["Shape"]}]}
+	],
+	"Sections": [],
+	"Structs": [
+		{"Name": "Shape", "Docs": "sherpago: union=kind variants=circle:Circle,square:Square", "Fields": []},
+		{"Name": "Circle", "Docs": "", "Fields": [{"Name": "kind", "Docs": "", "Typewords": ["string"]}, {"Name": "radius", "Docs": "", "Typewords": ["int32"]}]},
+		{"Name": "Square", "Docs": "", "Fields": [{"Name": "kind", "Docs": "", "Typewords": ["string"]}, {"Name": "side", "Docs": "", "Typewords": ["int32"]}]}
+	],
+	"Ints": [],
+	"Strings": [],
+	"SherpaVersion": 0,
+	"SherpadocVersion": 1
+}`
+
+func TestUnion(t *testing.T) {
+	// Variants are sent with their kind, and results are decoded into the variant
+	// for their kind.
+	testGeneratedDoc(t, unionDoc, Options{}, `import (
+	"context"
+	"encoding/json"
+	"testing"
+)
+
+func TestUnion(t *testing.T) {
+	var result string
+	srv := newRawServer(t, func(function string, params json.RawMessage) string {
+		if exp := "[{\"kind\":\"circle\",\"radius\":2}]"; string(params) != exp {
+			t.Errorf("got params %s, expected %s", params, exp)
+		}
+		return result
+	})
+	c := NewClient()
+	c.BaseURL = srv.URL + "/"
+
+	result = "{\"kind\": \"square\", \"side\": 4}"
+	if r, err := c.Convert(context.Background(), Shape{Circle{Radius: 2}}); err != nil {
+		t.Fatalf("calling convert: %v", err)
+	} else if sq, ok := r.Value.(Square); !ok || sq.Side != 4 || sq.Kind != "square" {
+		t.Fatalf("got %#v, expected square with side 4", r.Value)
+	}
+
+	result = "{\"kind\": \"triangle\"}"
+	if _, err := c.Convert(context.Background(), Shape{Circle{Radius: 2}}); err == nil {
+		t.Fatalf("no error for unknown kind")
+	}
+}
+`)
+}
+
+// embedDoc has a struct type embedding another, for TestEmbed.
+const embedDoc = `{
+	"Name": "Test",
+	"Docs": "",
+	"Functions": [
+		{"Name": "rename", "Docs": "", "Params": [{"Name": "u", "Typewords": ["User"]}], "Returns": [{"Name": "r", "Typewords": ["User"]}]}
+	],
+	"Sections": [],
+	"Structs": [
+		{"Name": "Base", "Docs": "", "Fields": [{"Name": "id", "Docs": "", "Typewords": ["int64"]}]},
+		{"Name": "User", "Docs": "sherpago: embeds=Base", "Fields": [{"Name": "id", "Docs": "", "Typewords": ["int64"]}, {"Name": "name", "Docs": "", "Typewords": ["string"]}]}
+	],
+	"Ints": [],
+	"Strings": [],
+	"SherpaVersion": 0,
+	"SherpadocVersion": 1
+}`
+
+func TestEmbed(t *testing.T) {
+	// The fields of embedded types are sent and received in the JSON object of the
+	// struct itself.
+	for _, opts := range []Options{{}, {FastJSON: true}} {
+		testGeneratedDoc(t, embedDoc, opts, `import (
+	"context"
+	"encoding/json"
+	"testing"
+)
+
+func TestEmbed(t *testing.T) {
+	srv := newRawServer(t, func(function string, params json.RawMessage) string {
+		if exp := "[{\"id\":1,\"name\":\"alice\"}]"; string(params) != exp {
+			t.Errorf("got params %s, expected %s", params, exp)
+		}
+		return "{\"id\": 2, \"name\": \"bob\"}"
+	})
+	c := NewClient()
+	c.BaseURL = srv.URL + "/"
+	if r, err := c.Rename(context.Background(), User{Base: Base{ID: 1}, Name: "alice"}); err != nil {
+		t.Fatalf("calling rename: %v", err)
+	} else if r.Base.ID != 2 || r.Name != "bob" {
+		t.Fatalf("got %#v, expected id 2 and name bob", r)
+	}
+}
+`)
+	}
+}
+
+// awaitDoc has a function for the state of an operation with an Await method,
+// for TestAwait.
+const awaitDoc = `{
+	"Name": "Test",
+	"Docs": "",
+	"Functions": [
+		{"Name": "job", "Docs": "sherpago: await=state:done,failed", "Params": [{"Name": "id", "Typewords": ["string"]}], "Returns": [{"Name": "r", "Typewords": ["Job"]}]}
+	],
+	"Sections": [],
+	"Structs": [
+		{"Name": "Job", "Docs": "", "Fields": [{"Name": "state", "Docs": "", "Typewords": ["string"]}]}
+	],
+	"Ints": [],
+	"Strings": [],
+	"SherpaVersion": 0,
+	"SherpadocVersion": 1
+}`
+
+func TestAwait(t *testing.T) {
+	// The function is called until the operation is done, or the timeout of the
+	// poll options expires.
+	testGeneratedDoc(t, awaitDoc, Options{}, `import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestAwait(t *testing.T) {
+	var calls int32
+	srv := newRawServer(t, func(function string, params json.RawMessage) string {
+		if string(params) == "[\"stuck\"]" || atomic.AddInt32(&calls, 1) < 3 {
+			return "{\"state\": \"running\"}"
+		}
+		return "{\"state\": \"done\"}"
+	})
+	c := NewClient()
+	c.BaseURL = srv.URL + "/"
+
+	opts := PollOptions{Interval: time.Millisecond, Multiplier: 1}
+	if r, err := c.AwaitJob(context.Background(), "x", opts); err != nil {
+		t.Fatalf("awaiting job: %v", err)
+	} else if r.State != "done" || atomic.LoadInt32(&calls) != 3 {
+		t.Fatalf("got state %q after %d calls, expected done after 3", r.State, calls)
+	}
+
+	// The last call is well before the timeout, it must not be canceled.
+	opts = PollOptions{Interval: 40 * time.Millisecond, Multiplier: 1, Timeout: 100 * time.Millisecond}
+	if r, err := c.AwaitJob(context.Background(), "stuck", opts); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("got error %v for stuck job, expected deadline exceeded", err)
+	} else if r.State != "running" {
+		t.Fatalf("got state %q for last call, expected running", r.State)
+	}
+}
+`)
+}
+
+// eventsDoc has a function with server-sent events of two types, for
+// TestSubscribe.
+const eventsDoc = `{
+	"Name": "Test",
+	"Docs": "",
+	"Functions": [
+		{"Name": "updates", "Docs": "sherpago: events=events/updates", "Params": [], "Returns": [{"Name": "message", "Typewords": ["Message"]}, {"Name": "presence", "Typewords": ["Presence"]}]}
+	],
+	"Sections": [],
+	"Structs": [
+		{"Name": "Message", "Docs": "", "Fields": [{"Name": "text", "Docs": "", "Typewords": ["string"]}]},
+		{"Name": "Presence", "Docs": "", "Fields": [{"Name": "online", "Docs": "", "Typewords": ["bool"]}]}
+	],
+	"Ints": [],
+	"Strings": [],
+	"SherpaVersion": 0,
+	"SherpadocVersion": 1
+}`
+
+func TestSubscribe(t *testing.T) {
+	// Events are decoded by name, the subscription reconnects with the ID of the
+	// last event, and the channel is closed when the context is done.
+	testGeneratedDoc(t, eventsDoc, Options{}, `import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+)
+
+func TestSubscribe(t *testing.T) {
+	var conns int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/events/updates" || r.URL.Query().Get("room") != "lobby" || r.Header.Get("Accept") != "text/event-stream" {
+			t.Errorf("bad request for events %s", r.URL)
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		if atomic.AddInt32(&conns, 1) == 1 {
+			fmt.Fprint(w, "retry: 10\n\nevent: message\nid: 1\ndata: {\"text\":\ndata: \"hi\"}\n\nevent: presence\nid: 2\ndata: {\"online\": true}\n\n")
+			return
+		}
+		if id := r.Header.Get("Last-Event-ID"); id != "2" {
+			t.Errorf("reconnect with last event id %q, expected 2", id)
+		}
+		fmt.Fprint(w, "event: other\nid: 3\ndata: {}\n\nevent: message\nid: 4\ndata: {\"text\": \"again\"}\n\n")
+		w.(http.Flusher).Flush()
+		<-r.Context().Done()
+	}))
+	defer srv.Close()
+	c := NewClient()
+	c.BaseURL = srv.URL + "/"
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	events, err := c.SubscribeUpdates(ctx, url.Values{"room": {"lobby"}})
+	if err != nil {
+		t.Fatalf("subscribing: %v", err)
+	}
+	if e := <-events; e.Err != nil || e.ID != "1" || e.Message == nil || e.Message.Text != "hi" {
+		t.Fatalf("got first event %#v, expected message hi", e)
+	}
+	if e := <-events; e.Err != nil || e.ID != "2" || e.Presence == nil || !e.Presence.Online {
+		t.Fatalf("got second event %#v, expected presence", e)
+	}
+	if e := <-events; e.Err != nil || e.ID != "4" || e.Message == nil || e.Message.Text != "again" {
+		t.Fatalf("got event %#v after reconnect, expected message again", e)
+	}
+	cancel()
+	for e := range events {
+		t.Fatalf("got event %#v after cancel", e)
+	}
+}
+`)
+}
+
+func TestCodec(t *testing.T) {
+	// Requests are sent in the codec, and responses in the codec or in JSON are
+	// read. Values survive conversion to and from the codecs.
+	testGenerated(t, Options{Codec: true}, `import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCodec(t *testing.T) {
+	for _, test := range []struct {
+		codec  Codec
+		prefix byte // Of a map with a single key, of the request.
+	}{
+		{CBORCodec, 0xa1},
+		{MessagePackCodec, 0x81},
+	} {
+		codec := test.codec
+		jsonResponse := false
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if ct := r.Header.Get("Content-Type"); ct != codec.ContentType {
+				t.Errorf("got request content type %q, expected %q", ct, codec.ContentType)
+			}
+			buf, err := io.ReadAll(r.Body)
+			if err != nil || len(buf) == 0 || buf[0] != test.prefix {
+				t.Errorf("got request body %x, %v", buf, err)
+			}
+			buf, err = codec.ToJSON(buf)
+			if err != nil {
+				t.Errorf("decoding request: %v", err)
+			}
+			var req struct{ Params []string }
+			if err := json.Unmarshal(buf, &req); err != nil || len(req.Params) != 1 {
+				t.Errorf("parsing request %s: %v", buf, err)
+				return
+			}
+			resp, _ := json.Marshal(map[string]string{"result": req.Params[0]})
+			if jsonResponse {
+				w.Header().Set("Content-Type", "application/json")
+			} else {
+				resp, err = codec.FromJSON(resp)
+				if err != nil {
+					t.Errorf("encoding response: %v", err)
+				}
+				w.Header().Set("Content-Type", codec.ContentType)
+			}
+			w.Write(resp)
+		}))
+		defer srv.Close()
+		c := NewClient(WithCodec(codec))
+		c.BaseURL = srv.URL + "/"
+		for _, jsonResponse = range []bool{false, true} {
+			if r, err := c.Echo(context.Background(), "héllo"); err != nil {
+				t.Fatalf("calling echo with %s: %v", codec.ContentType, err)
+			} else if r != "héllo" {
+				t.Fatalf("echo with %s returned %q", codec.ContentType, r)
+			}
+		}
+
+		value := "{\"a\":[1,-2,3.5,true,false,null,\"x\"],\"b\":{\"c\":18446744073709551615,\"d\":-9223372036854775808,\"e\":\"\"}}"
+		buf, err := codec.FromJSON([]byte(value))
+		if err != nil {
+			t.Fatalf("converting from json: %v", err)
+		}
+		if buf, err = codec.ToJSON(buf); err != nil {
+			t.Fatalf("converting to json: %v", err)
+		}
+		var b bytes.Buffer
+		if err := json.Compact(&b, buf); err != nil || b.String() != value {
+			t.Fatalf("got %s, %v after conversion with %s, expected %s", buf, err, codec.ContentType, value)
+		}
+	}
+}
+`)
+}
+
+func TestRedirectPolicy(t *testing.T) {
+	// Redirects keeping the method are followed, with the request body, as
+	// allowed by the policy. Others fail.
+	testGenerated(t, Options{}, `import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestRedirectPolicy(t *testing.T) {
+	echo := newHandler(t, func(r *http.Request, function string, params []string) (string, error) {
+		return params[0], nil
+	})
+	other := httptest.NewServer(echo)
+	defer other.Close()
+	// Paths are /<redirect>/<hops>/echo.
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		elems := strings.Split(r.URL.Path, "/")
+		n, _ := strconv.Atoi(elems[2])
+		switch {
+		case n == 0:
+			echo.ServeHTTP(w, r)
+		case elems[1] == "found":
+			http.Redirect(w, r, fmt.Sprintf("/found/%d/echo", n-1), http.StatusFound)
+		case elems[1] == "other":
+			http.Redirect(w, r, other.URL+"/echo", http.StatusTemporaryRedirect)
+		default:
+			http.Redirect(w, r, fmt.Sprintf("/same/%d/echo", n-1), http.StatusTemporaryRedirect)
+		}
+	}))
+	defer srv.Close()
+
+	for _, test := range []struct {
+		policy RedirectPolicy
+		path   string
+		ok     bool
+	}{
+		{RedirectPolicy{}, "/same/3/", true},
+		{RedirectPolicy{}, "/other/1/", true},
+		{RedirectPolicy{}, "/found/1/", false},
+		{RedirectPolicy{Forbid: true}, "/same/1/", false},
+		{RedirectPolicy{MaxHops: 2}, "/same/2/", true},
+		{RedirectPolicy{MaxHops: 2}, "/same/3/", false},
+		{RedirectPolicy{SameHost: true}, "/same/1/", true},
+		{RedirectPolicy{SameHost: true}, "/other/1/", false},
+	} {
+		c := NewClient(WithRedirectPolicy(test.policy))
+		c.BaseURL = srv.URL + test.path
+		r, err := c.Echo(context.Background(), "hi")
+		if test.ok && (err != nil || r != "hi") {
+			t.Errorf("calling echo with policy %+v at %s: %q, %v", test.policy, test.path, r, err)
+		} else if !test.ok && err == nil {
+			t.Errorf("calling echo with policy %+v at %s: no error", test.policy, test.path)
+		}
+	}
+}
+`)
+}
+
+func TestBaseURL(t *testing.T) {
+	// The function name is joined to the base URL as path element, relative base
+	// URLs are resolved against the origin, and credentials in the base URL are
+	// sent with basic authentication.
+	testGenerated(t, Options{}, `import (
+	"context"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestBaseURL(t *testing.T) {
+	srv := newServer(t, func(r *http.Request, function string, params []string) (string, error) {
+		if user, password, ok := r.BasicAuth(); ok {
+			return user + ":" + password + " " + r.URL.EscapedPath(), nil
+		}
+		return r.URL.EscapedPath(), nil
+	})
+	origin, err := url.Parse(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, test := range []struct {
+		baseURL, context string
+		exp              string
+	}{
+		{srv.URL + "/api/", "", "/api/echo"},
+		{srv.URL + "/api", "", "/api/echo"},
+		{srv.URL + "/a%2Fb/", "", "/a%2Fb/echo"},
+		{srv.URL + "/api/?x=1#y", "", "/api/echo"},
+		{"/api/", "", "/api/echo"},
+		{"/api/", "/other/", "/other/echo"},
+		{strings.Replace(srv.URL, "://", "://alice:secret@", 1) + "/api/", "", "alice:secret /api/echo"},
+	} {
+		c := NewClient(WithOrigin(origin))
+		c.BaseURL = test.baseURL
+		ctx := context.Background()
+		if test.context != "" {
+			ctx = BaseURLContext(ctx, test.context)
+		}
+		if r, err := c.Echo(ctx, "x"); err != nil {
+			t.Errorf("calling with base url %q: %v", test.baseURL, err)
+		} else if r != test.exp {
+			t.Errorf("calling with base url %q: got %q, expected %q", test.baseURL, r, test.exp)
+		}
+	}
+}
+`)
+}
+
+func TestClientFromEnv(t *testing.T) {
+	// The base URL, token and timeout are configured from environment variables,
+	// and options given override them.
+	testGenerated(t, Options{}, `import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestClientFromEnv(t *testing.T) {
+	srv := newServer(t, func(r *http.Request, function string, params []string) (string, error) {
+		if function == "echo" {
+			time.Sleep(200 * time.Millisecond)
+		}
+		return r.Header.Get("Authorization"), nil
+	})
+	t.Setenv("EXAMPLE_BASE_URL", srv.URL+"/")
+	t.Setenv("EXAMPLE_TOKEN", "secret")
+	t.Setenv("EXAMPLE_TIMEOUT", "50ms")
+	c, err := NewClientFromEnv()
+	if err != nil {
+		t.Fatalf("new client from env: %v", err)
+	}
+	if r, err := c.Whoami(context.Background()); err != nil || r != "Bearer secret" {
+		t.Fatalf("calling whoami: %q, %v", r, err)
+	}
+	if _, err := c.Echo(context.Background(), "x"); err == nil {
+		t.Fatalf("no error for call slower than timeout")
+	}
+
+	c, err = NewClientFromEnv(WithHeaders(http.Header{"Authorization": {"Basic other"}}))
+	if err != nil {
+		t.Fatalf("new client from env: %v", err)
+	}
+	if r, err := c.Whoami(context.Background()); err != nil || r != "Basic other" {
+		t.Fatalf("calling whoami with option: %q, %v", r, err)
+	}
+
+	t.Setenv("EXAMPLE_TIMEOUT", "soon")
+	if _, err := NewClientFromEnv(); err == nil {
+		t.Fatalf("no error for bad timeout")
+	}
+}
+`)
+}
+
+func TestDrainLimit(t *testing.T) {
+	// The rest of response bodies is read up to the drain limit before closing
+	// them, so connections can be used again.
+	testGenerated(t, Options{}, `import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// eofTransport records whether response bodies were read until EOF before
+// they were closed.
+type eofTransport struct {
+	eofs []bool
+}
+
+func (et *eofTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	resp, err := http.DefaultTransport.RoundTrip(r)
+	if err == nil {
+		resp.Body = &eofBody{resp.Body, et, false}
+	}
+	return resp, err
+}
+
+type eofBody struct {
+	io.ReadCloser
+	et  *eofTransport
+	eof bool
+}
+
+func (b *eofBody) Read(buf []byte) (int, error) {
+	n, err := b.ReadCloser.Read(buf)
+	if err == io.EOF {
+		b.eof = true
+	}
+	return n, err
+}
+
+func (b *eofBody) Close() error {
+	b.et.eofs = append(b.et.eofs, b.eof)
+	return b.ReadCloser.Close()
+}
+
+func TestDrainLimit(t *testing.T) {
+	for _, test := range []struct {
+		padding int
+		opts    []ClientOption
+		eof     bool
+	}{
+		{10 << 10, nil, true},
+		{100 << 10, nil, false},
+		{100 << 10, []ClientOption{WithDrainLimit(1 << 20)}, true},
+		{10 << 10, []ClientOption{WithDrainLimit(-1)}, false},
+	} {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			io.WriteString(w, "{\"result\": \"ok\"}"+strings.Repeat(" ", test.padding))
+		}))
+		et := &eofTransport{}
+		c := NewClient(test.opts...)
+		c.BaseURL = srv.URL + "/"
+		c.Client = &http.Client{Transport: et}
+		if _, err := c.Whoami(context.Background()); err != nil {
+			t.Fatalf("calling whoami: %v", err)
+		}
+		srv.Close()
+		if len(et.eofs) != 1 || et.eofs[0] != test.eof {
+			t.Errorf("response bodies read until eof %v for padding %d, expected %v", et.eofs, test.padding, test.eof)
+		}
+	}
+}
+`)
+}
+
+// enumDoc has a string and an int enum, for TestEnumUnknown.
+const enumDoc = `{
+	"Name": "Test",
+	"Docs": "",
+	"Functions": [
+		{"Name": "check", "Docs": "", "Params": [{"Name": "s", "Typewords": ["Status"]}], "Returns": [{"Name": "s", "Typewords": ["Status"]}, {"Name": "l", "Typewords": ["Level"]}]}
+	],
+	"Sections": [],
+	"Structs": [],
+	"Ints": [
+		{"Name": "Level", "Docs": "", "Values": [{"Name": "LevelLow", "Value": 1, "Docs": ""}, {"Name": "LevelHigh", "Value": 2, "Docs": ""}]}
+	],
+	"Strings": [
+		{"Name": "Status", "Docs": "", "Values": [{"Name": "StatusActive", "Value": "active", "Docs": ""}, {"Name": "StatusDisabled", "Value": "disabled", "Docs": ""}]}
+	],
+	"SherpaVersion": 0,
+	"SherpadocVersion": 1
+}`
+
+func TestEnumUnknown(t *testing.T) {
+	// Values that are not documented are sent and received as is, and OrUnknown
+	// turns them into the Unknown constant.
+	testGeneratedDoc(t, enumDoc, Options{EnumUnknown: true}, `import (
+	"context"
+	"encoding/json"
+	"testing"
+)
+
+func TestEnumUnknown(t *testing.T) {
+	srv := newRawServer(t, func(function string, params json.RawMessage) string {
+		if string(params) == "[\"archived\"]" {
+			return "[\"archived\", 7]"
+		}
+		return "[\"active\", 2]"
+	})
+	c := NewClient()
+	c.BaseURL = srv.URL + "/"
+
+	if s, l, err := c.Check(context.Background(), Status("archived")); err != nil {
+		t.Fatalf("calling check: %v", err)
+	} else if s != "archived" || l != 7 || s.OrUnknown() != StatusUnknown || l.OrUnknown() != LevelUnknown {
+		t.Fatalf("got %q, %d, expected values that are not documented", s, l)
+	}
+	if s, l, err := c.Check(context.Background(), StatusActive); err != nil {
+		t.Fatalf("calling check: %v", err)
+	} else if s.OrUnknown() != StatusActive || l.OrUnknown() != LevelHigh {
+		t.Fatalf("got %q, %d, expected documented values", s, l)
+	}
+	if StatusUnknown != "" || LevelUnknown >= LevelLow {
+		t.Fatalf("got unknown constants %q and %d", StatusUnknown, LevelUnknown)
+	}
+}
+`)
+}
+
+// itemDoc has a struct type used as parameter and result, for TestExtraFields.
+const itemDoc = `{
+	"Name": "Test",
+	"Docs": "",
+	"Functions": [
+		{"Name": "update", "Docs": "", "Params": [{"Name": "item", "Typewords": ["Item"]}], "Returns": [{"Name": "r", "Typewords": ["Item"]}]}
+	],
+	"Sections": [],
+	"Structs": [
+		{"Name": "Item", "Docs": "", "Fields": [{"Name": "name", "Docs": "", "Typewords": ["string"]}]}
+	],
+	"Ints": [],
+	"Strings": [],
+	"SherpaVersion": 0,
+	"SherpadocVersion": 1
+}`
+
+func TestExtraFields(t *testing.T) {
+	// Fields that are not documented are kept in Extra, and sent again.
+	for _, opts := range []Options{{ExtraFields: true}, {ExtraFields: true, FastJSON: true}} {
+		testGeneratedDoc(t, itemDoc, opts, `import (
+	"context"
+	"encoding/json"
+	"testing"
+)
+
+func TestExtraFields(t *testing.T) {
+	var params string
+	srv := newRawServer(t, func(function string, p json.RawMessage) string {
+		params = string(p)
+		return "{\"name\": \"a\", \"size\": 3, \"color\": {\"r\": 255}}"
+	})
+	c := NewClient()
+	c.BaseURL = srv.URL + "/"
+
+	item, err := c.Update(context.Background(), Item{Name: "x"})
+	if err != nil {
+		t.Fatalf("calling update: %v", err)
+	}
+	if exp := "[{\"name\":\"x\"}]"; params != exp {
+		t.Fatalf("got params %s, expected %s", params, exp)
+	}
+	if item.Name != "a" || len(item.Extra) != 2 || string(item.Extra["size"]) != "3" || string(item.Extra["color"]) != "{\"r\": 255}" {
+		t.Fatalf("got %#v, expected name and extra fields", item)
+	}
+	item.Name = "b"
+	if _, err := c.Update(context.Background(), item); err != nil {
+		t.Fatalf("calling update: %v", err)
+	}
+	if exp := "[{\"name\":\"b\",\"color\":{\"r\":255},\"size\":3}]"; params != exp {
+		t.Fatalf("got params %s, expected %s", params, exp)
+	}
+}
+`)
+	}
+}
+
+// driftDoc has nested struct types as result, for TestSchemaDrift.
+const driftDoc = `{
+	"Name": "Test",
+	"Docs": "",
+	"Functions": [
+		{"Name": "getUser", "Docs": "", "Params": [], "Returns": [{"Name": "user", "Typewords": ["User"]}]}
+	],
+	"Sections": [],
+	"Structs": [
+		{"Name": "User", "Docs": "", "Fields": [{"Name": "name", "Docs": "", "Typewords": ["string"]}, {"Name": "friends", "Docs": "", "Typewords": ["[]", "Friend"]}]},
+		{"Name": "Friend", "Docs": "", "Fields": [{"Name": "email", "Docs": "", "Typewords": ["string"]}]}
+	],
+	"Ints": [],
+	"Strings": [],
+	"SherpaVersion": 0,
+	"SherpadocVersion": 1
+}`
+
+func TestSchemaDrift(t *testing.T) {
+	// The hook gets the fields that are not documented and unexpected nulls, and
+	// calls still succeed.
+	testGeneratedDoc(t, driftDoc, Options{SchemaDrift: true}, `import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"testing"
+)
+
+func TestSchemaDrift(t *testing.T) {
+	result := "{\"name\": \"a\", \"friends\": [{\"email\": \"b\"}]}"
+	srv := newRawServer(t, func(function string, params json.RawMessage) string {
+		return result
+	})
+	var drift []SchemaDrift
+	c := NewClient(WithSchemaDrift(func(ctx context.Context, l []SchemaDrift) {
+		drift = append(drift, l...)
+	}))
+	c.BaseURL = srv.URL + "/"
+
+	if _, err := c.GetUser(context.Background()); err != nil || drift != nil {
+		t.Fatalf("calling getuser: %v, drift %v", err, drift)
+	}
+	result = "{\"name\": \"a\", \"age\": 3, \"friends\": [{\"email\": null, \"phone\": \"\"}]}"
+	if u, err := c.GetUser(context.Background()); err != nil || u.Name != "a" || len(u.Friends) != 1 {
+		t.Fatalf("calling getuser with drift: %#v, %v", u, err)
+	}
+	exp := "[{getUser user.age unknown field} {getUser user.friends[0].email null for non-nullable type} {getUser user.friends[0].phone unknown field}]"
+	if s := fmt.Sprint(drift); s != exp {
+		t.Fatalf("got drift %s, expected %s", s, exp)
+	}
+}
+`)
+}
+
+// eventDoc has a struct type with timestamps, for TestOmitZeroTime.
+const eventDoc = `{
+	"Name": "Test",
+	"Docs": "",
+	"Functions": [
+		{"Name": "schedule", "Docs": "", "Params": [{"Name": "e", "Typewords": ["Event"]}], "Returns": [{"Name": "r", "Typewords": ["Event"]}]}
+	],
+	"Sections": [],
+	"Structs": [
+		{"Name": "Event", "Docs": "", "Fields": [{"Name": "name", "Docs": "", "Typewords": ["string"]}, {"Name": "start", "Docs": "", "Typewords": ["timestamp"]}, {"Name": "end", "Docs": "", "Typewords": ["nullable", "timestamp"]}]}
+	],
+	"Ints": [],
+	"Strings": [],
+	"SherpaVersion": 0,
+	"SherpadocVersion": 1
+}`
+
+func TestOmitZeroTime(t *testing.T) {
+	// Zero timestamps of struct fields are left out, and missing timestamps are
+	// decoded as zero.
+	for _, opts := range []Options{{OmitZeroTime: true}, {OmitZeroTime: true, FastJSON: true}} {
+		testGeneratedDoc(t, eventDoc, opts, `import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestOmitZeroTime(t *testing.T) {
+	// Fields of the event sent, in any order.
+	var params map[string]string
+	srv := newRawServer(t, func(function string, p json.RawMessage) string {
+		var l []map[string]json.RawMessage
+		if err := json.Unmarshal(p, &l); err != nil || len(l) != 1 {
+			t.Errorf("parsing params %s: %v", p, err)
+		}
+		params = map[string]string{}
+		for k, v := range l[0] {
+			params[k] = string(v)
+		}
+		return "{\"name\": \"a\", \"end\": null}"
+	})
+	c := NewClient()
+	c.BaseURL = srv.URL + "/"
+
+	e, err := c.Schedule(context.Background(), Event{Name: "x"})
+	if err != nil {
+		t.Fatalf("calling schedule: %v", err)
+	}
+	if _, ok := params["start"]; ok || params["end"] != "null" || len(params) != 2 {
+		t.Fatalf("got params %v, expected start left out", params)
+	}
+	if e.Name != "a" || !e.Start.IsZero() || e.End != nil {
+		t.Fatalf("got %#v, expected zero start", e)
+	}
+
+	start := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	if _, err := c.Schedule(context.Background(), Event{Name: "x", Start: start}); err != nil {
+		t.Fatalf("calling schedule: %v", err)
+	}
+	if params["start"] != "\"2024-01-02T03:04:05Z\"" || params["end"] != "null" || len(params) != 3 {
+		t.Fatalf("got params %v, expected start", params)
+	}
+}
+`)
+	}
+}
+
+// durationDoc has a struct type with integer durations, for TestDuration.
+const durationDoc = `{
+	"Name": "Test",
+	"Docs": "",
+	"Functions": [
+		{"Name": "configure", "Docs": "", "Params": [{"Name": "c", "Typewords": ["Config"]}], "Returns": [{"Name": "r", "Typewords": ["Config"]}]}
+	],
+	"Sections": [],
+	"Structs": [
+		{"Name": "Config", "Docs": "", "Fields": [{"Name": "timeout", "Docs": "sherpago: duration=ms", "Typewords": ["int32"]}, {"Name": "ttl", "Docs": "sherpago: duration=s", "Typewords": ["int64"]}]}
+	],
+	"Ints": [],
+	"Strings": [],
+	"SherpaVersion": 0,
+	"SherpadocVersion": 1
+}`
+
+func TestDuration(t *testing.T) {
+	// Durations are sent and received as integers in their unit.
+	for _, opts := range []Options{{}, {FastJSON: true}} {
+		testGeneratedDoc(t, durationDoc, opts, `import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestDuration(t *testing.T) {
+	srv := newRawServer(t, func(function string, params json.RawMessage) string {
+		if exp := "[{\"timeout\":2000,\"ttl\":3600}]"; string(params) != exp {
+			t.Errorf("got params %s, expected %s", params, exp)
+		}
+		return "{\"timeout\": 1500, \"ttl\": 60}"
+	})
+	c := NewClient()
+	c.BaseURL = srv.URL + "/"
+	if r, err := c.Configure(context.Background(), Config{Timeout: 2 * time.Second, TTL: time.Hour}); err != nil {
+		t.Fatalf("calling configure: %v", err)
+	} else if r.Timeout != 1500*time.Millisecond || r.TTL != time.Minute {
+		t.Fatalf("got %#v, expected 1.5s and 1m", r)
+	}
+}
+`)
+	}
+}
+
+// hostDoc has a struct type with IP and MAC address fields, for
+// TestAddressFormats.
+const hostDoc = `{
+	"Name": "Test",
+	"Docs": "",
+	"Functions": [
+		{"Name": "lookup", "Docs": "", "Params": [{"Name": "h", "Typewords": ["Host"]}], "Returns": [{"Name": "r", "Typewords": ["Host"]}]}
+	],
+	"Sections": [],
+	"Structs": [
+		{"Name": "Host", "Docs": "", "Fields": [{"Name": "addr", "Docs": "sherpago: format=ip", "Typewords": ["string"]}, {"Name": "mac", "Docs": "sherpago: format=mac", "Typewords": ["string"]}]}
+	],
+	"Ints": [],
+	"Strings": [],
+	"SherpaVersion": 0,
+	"SherpadocVersion": 1
+}`
+
+func TestAddressFormats(t *testing.T) {
+	// Addresses are sent and received as text, the empty string for the zero
+	// value, and invalid addresses fail decoding.
+	for _, opts := range []Options{{}, {FastJSON: true}} {
+		testGeneratedDoc(t, hostDoc, opts, `import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/netip"
+	"testing"
+)
+
+func TestAddressFormats(t *testing.T) {
+	var params, result string
+	srv := newRawServer(t, func(function string, p json.RawMessage) string {
+		params = string(p)
+		return result
+	})
+	c := NewClient()
+	c.BaseURL = srv.URL + "/"
+
+	mac, _ := net.ParseMAC("00:00:5e:00:53:01")
+	result = "{\"addr\": \"2001:db8::1\", \"mac\": \"00:00:5e:00:53:02\"}"
+	if r, err := c.Lookup(context.Background(), Host{Addr: netip.MustParseAddr("192.0.2.1"), Mac: mac}); err != nil {
+		t.Fatalf("calling lookup: %v", err)
+	} else if r.Addr != netip.MustParseAddr("2001:db8::1") || r.Mac.String() != "00:00:5e:00:53:02" {
+		t.Fatalf("got %#v", r)
+	}
+	if exp := "[{\"addr\":\"192.0.2.1\",\"mac\":\"00:00:5e:00:53:01\"}]"; params != exp {
+		t.Fatalf("got params %s, expected %s", params, exp)
+	}
+
+	result = "{\"addr\": \"\", \"mac\": \"\"}"
+	if r, err := c.Lookup(context.Background(), Host{}); err != nil {
+		t.Fatalf("calling lookup: %v", err)
+	} else if r.Addr.IsValid() || r.Mac != nil {
+		t.Fatalf("got %#v, expected zero values", r)
+	}
+	if exp := "[{\"addr\":\"\",\"mac\":\"\"}]"; params != exp {
+		t.Fatalf("got params %s, expected %s", params, exp)
+	}
+
+	for _, result = range []string{"{\"addr\": \"bogus\", \"mac\": \"\"}", "{\"addr\": \"\", \"mac\": \"bogus\"}"} {
+		if _, err := c.Lookup(context.Background(), Host{}); err == nil {
+			t.Fatalf("no error for invalid address in %s", result)
+		}
+	}
+}
+`)
+	}
+}
+
+// uuidDoc has a struct type with a UUID field, for TestUUIDType.
+const uuidDoc = `{
+	"Name": "Test",
+	"Docs": "",
+	"Functions": [
+		{"Name": "get", "Docs": "", "Params": [{"Name": "o", "Typewords": ["Object"]}], "Returns": [{"Name": "r", "Typewords": ["Object"]}]}
+	],
+	"Sections": [],
+	"Structs": [
+		{"Name": "Object", "Docs": "", "Fields": [{"Name": "id", "Docs": "sherpago: format=uuid", "Typewords": ["string"]}]}
+	],
+	"Ints": [],
+	"Strings": [],
+	"SherpaVersion": 0,
+	"SherpadocVersion": 1
+}`
+
+func TestUUIDType(t *testing.T) {
+	// UUIDs are sent and received as text with the methods of the configured
+	// type, here one declared in the test file.
+	for _, opts := range []Options{{UUIDType: "UUID"}, {UUIDType: "UUID", FastJSON: true}} {
+		testGeneratedDoc(t, uuidDoc, opts, `import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+)
+
+type UUID [16]byte
+
+func (u UUID) MarshalText() ([]byte, error) {
+	s := hex.EncodeToString(u[:])
+	return []byte(s[:8] + "-" + s[8:12] + "-" + s[12:16] + "-" + s[16:20] + "-" + s[20:]), nil
+}
+
+func (u *UUID) UnmarshalText(buf []byte) error {
+	s := string(buf)
+	if len(s) != 36 || s[8] != '-' || s[13] != '-' || s[18] != '-' || s[23] != '-' {
+		return errors.New("bad uuid")
+	}
+	b, err := hex.DecodeString(strings.ReplaceAll(s, "-", ""))
+	if err != nil {
+		return err
+	}
+	copy(u[:], b)
+	return nil
+}
+
+func TestUUIDType(t *testing.T) {
+	var params, result string
+	srv := newRawServer(t, func(function string, p json.RawMessage) string {
+		params = string(p)
+		return result
+	})
+	c := NewClient()
+	c.BaseURL = srv.URL + "/"
+
+	result = "{\"id\": \"f47ac10b-58cc-4372-a567-0e02b2c3d479\"}"
+	r, err := c.Get(context.Background(), Object{ID: UUID{0x01, 15: 0xff}})
+	if err != nil {
+		t.Fatalf("calling get: %v", err)
+	}
+	if exp := "[{\"id\":\"01000000-0000-0000-0000-0000000000ff\"}]"; params != exp {
+		t.Fatalf("got params %s, expected %s", params, exp)
+	}
+	if s, _ := r.ID.MarshalText(); string(s) != "f47ac10b-58cc-4372-a567-0e02b2c3d479" {
+		t.Fatalf("got id %s", s)
+	}
+
+	result = "{\"id\": \"bogus\"}"
+	if _, err := c.Get(context.Background(), Object{}); err == nil {
+		t.Fatalf("no error for invalid uuid")
+	}
+}
+`)
+	}
+}
+
+// priceDoc has a struct type with decimals as string and as number, for
+// TestDecimalType.
+const priceDoc = `{
+	"Name": "Test",
+	"Docs": "",
+	"Functions": [
+		{"Name": "quote", "Docs": "", "Params": [{"Name": "p", "Typewords": ["Price"]}], "Returns": [{"Name": "r", "Typewords": ["Price"]}]}
+	],
+	"Sections": [],
+	"Structs": [
+		{"Name": "Price", "Docs": "", "Fields": [{"Name": "amount", "Docs": "sherpago: format=money", "Typewords": ["string"]}, {"Name": "rate", "Docs": "sherpago: format=decimal", "Typewords": ["float64"]}]}
+	],
+	"Ints": [],
+	"Strings": [],
+	"SherpaVersion": 0,
+	"SherpadocVersion": 1
+}`
+
+func TestDecimalType(t *testing.T) {
+	// Decimals are sent and received without rounding, as strings and as numbers,
+	// with the methods of the configured type, here one declared in the test
+	// file.
+	for _, opts := range []Options{{DecimalType: "Decimal"}, {DecimalType: "Decimal", FastJSON: true}} {
+		testGeneratedDoc(t, priceDoc, opts, `import (
+	"context"
+	"encoding/json"
+	"errors"
+	"regexp"
+	"testing"
+)
+
+type Decimal struct {
+	s string
+}
+
+func (d Decimal) MarshalText() ([]byte, error) {
+	return []byte(d.s), nil
+}
+
+func (d *Decimal) UnmarshalText(buf []byte) error {
+	if !regexp.MustCompile("^-?[0-9]+(\\.[0-9]+)?$").Match(buf) {
+		return errors.New("bad decimal")
+	}
+	d.s = string(buf)
+	return nil
+}
+
+func TestDecimalType(t *testing.T) {
+	var params, result string
+	srv := newRawServer(t, func(function string, p json.RawMessage) string {
+		params = string(p)
+		return result
+	})
+	c := NewClient()
+	c.BaseURL = srv.URL + "/"
+
+	result = "{\"amount\": \"12.50\", \"rate\": 0.1000000000000000055511151231257827}"
+	r, err := c.Quote(context.Background(), Price{Decimal{"3.10"}, Decimal{"1.005"}})
+	if err != nil {
+		t.Fatalf("calling quote: %v", err)
+	}
+	if exp := "[{\"amount\":\"3.10\",\"rate\":1.005}]"; params != exp {
+		t.Fatalf("got params %s, expected %s", params, exp)
+	}
+	if r.Amount.s != "12.50" || r.Rate.s != "0.1000000000000000055511151231257827" {
+		t.Fatalf("got %#v", r)
+	}
+
+	result = "{\"amount\": \"twelve\", \"rate\": 1}"
+	if _, err := c.Quote(context.Background(), Price{Decimal{"0"}, Decimal{"0"}}); err == nil {
+		t.Fatalf("no error for invalid decimal")
+	}
+}
+`)
+	}
+}
+
+// linkDoc has a struct type with a URL field, for TestURLFormat.
+const linkDoc = `{
+	"Name": "Test",
+	"Docs": "",
+	"Functions": [
+		{"Name": "shorten", "Docs": "", "Params": [{"Name": "l", "Typewords": ["Link"]}], "Returns": [{"Name": "r", "Typewords": ["Link"]}]}
+	],
+	"Sections": [],
+	"Structs": [
+		{"Name": "Link", "Docs": "", "Fields": [{"Name": "href", "Docs": "sherpago: format=url", "Typewords": ["string"]}]}
+	],
+	"Ints": [],
+	"Strings": [],
+	"SherpaVersion": 0,
+	"SherpadocVersion": 1
+}`
+
+func TestURLFormat(t *testing.T) {
+	// URLs are sent and received as text, the empty string for nil, and invalid
+	// URLs fail decoding.
+	for _, opts := range []Options{{}, {FastJSON: true}} {
+		testGeneratedDoc(t, linkDoc, opts, `import (
+	"context"
+	"encoding/json"
+	"net/url"
+	"testing"
+)
+
+func TestURLFormat(t *testing.T) {
+	var params, result string
+	srv := newRawServer(t, func(function string, p json.RawMessage) string {
+		params = string(p)
+		return result
+	})
+	c := NewClient()
+	c.BaseURL = srv.URL + "/"
+
+	u, _ := url.Parse("https://example.org/a?b=c")
+	result = "{\"href\": \"https://x.example/y\"}"
+	if r, err := c.Shorten(context.Background(), Link{Href: u}); err != nil {
+		t.Fatalf("calling shorten: %v", err)
+	} else if r.Href == nil || r.Href.Host != "x.example" || r.Href.Path != "/y" {
+		t.Fatalf("got %#v", r.Href)
+	}
+	if exp := "[{\"href\":\"https://example.org/a?b=c\"}]"; params != exp {
+		t.Fatalf("got params %s, expected %s", params, exp)
+	}
+
+	result = "{\"href\": \"\"}"
+	if r, err := c.Shorten(context.Background(), Link{}); err != nil || r.Href != nil {
+		t.Fatalf("calling shorten: %#v, %v, expected nil url", r.Href, err)
+	}
+	if exp := "[{\"href\":\"\"}]"; params != exp {
+		t.Fatalf("got params %s, expected %s", params, exp)
+	}
+
+	result = "{\"href\": \"http://[bad\"}"
+	if _, err := c.Shorten(context.Background(), Link{}); err == nil {
+		t.Fatalf("no error for invalid url")
+	}
+}
+`)
+	}
+}
+
+func TestDeprecationHook(t *testing.T) {
+	// The hook is called with the deprecation from the response headers, and the
+	// call succeeds.
+	testGenerated(t, Options{}, `import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestDeprecationHook(t *testing.T) {
+	handler := newHandler(t, func(r *http.Request, function string, params []string) (string, error) {
+		return "ok", nil
+	})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/echo" {
+			w.Header().Set("Deprecation", "@1688169599")
+			w.Header().Set("Sunset", "Sat, 01 Jun 2030 00:00:00 GMT")
+			w.Header().Add("Link", "<https://example.org/deprecation>; rel=\"deprecation\", <https://example.org/other>; rel=\"help\"")
+			w.Header().Add("Warning", "299 - \"Deprecated API\"")
+		}
+		handler.ServeHTTP(w, r)
+	}))
+	defer srv.Close()
+
+	var l []Deprecation
+	c := NewClient(WithDeprecationHook(func(ctx context.Context, d Deprecation) {
+		l = append(l, d)
+	}))
+	c.BaseURL = srv.URL + "/"
+	if r, err := c.Echo(context.Background(), "x"); err != nil || r != "ok" {
+		t.Fatalf("calling echo: %q, %v", r, err)
+	}
+	if r, err := c.Login(context.Background(), "u", "p"); err != nil || r != "ok" {
+		t.Fatalf("calling login: %q, %v", r, err)
+	}
+	exp := Deprecation{
+		Function:   "echo",
+		Deprecated: true,
+		Date:       time.Unix(1688169599, 0).UTC(),
+		Sunset:     time.Date(2030, 6, 1, 0, 0, 0, 0, time.UTC),
+		Links:      []string{"https://example.org/deprecation"},
+		Warnings:   []string{"299 - \"Deprecated API\""},
+	}
+	if len(l) != 1 || fmt.Sprintf("%#v", l[0]) != fmt.Sprintf("%#v", exp) {
+		t.Fatalf("got deprecations %#v, expected %#v", l, exp)
+	}
+}
+`)
+}
+
+// iterDoc has a function returning an array, and one returning pages, for
+// TestIterMethods.
+const iterDoc = `{
+	"Name": "Test",
+	"Docs": "",
+	"Functions": [
+		{"Name": "tags", "Docs": "", "Params": [], "Returns": [{"Name": "r", "Typewords": ["[]", "string"]}]},
+		{"Name": "users", "Docs": "sherpago: pages=cursor:users:next", "Params": [{"Name": "group", "Typewords": ["string"]}, {"Name": "cursor", "Typewords": ["string"]}], "Returns": [{"Name": "r", "Typewords": ["Page"]}]}
+	],
+	"Sections": [],
+	"Structs": [
+		{"Name": "Page", "Docs": "", "Fields": [{"Name": "users", "Docs": "", "Typewords": ["[]", "string"]}, {"Name": "next", "Docs": "", "Typewords": ["string"]}]}
+	],
+	"Ints": [],
+	"Strings": [],
+	"SherpaVersion": 0,
+	"SherpadocVersion": 1
+}`
+
+func TestIterMethods(t *testing.T) {
+	// Iterators yield the elements of all pages, fetching pages as needed, and
+	// the error of a call.
+	testGeneratedDoc(t, iterDoc, Options{IterMethods: true}, `import (
+	"context"
+	"encoding/json"
+	"testing"
+)
+
+func TestIterMethods(t *testing.T) {
+	var calls []string
+	var tags string
+	srv := newRawServer(t, func(function string, params json.RawMessage) string {
+		calls = append(calls, string(params))
+		if function == "tags" {
+			return tags
+		}
+		switch string(params) {
+		case "[\"staff\",\"\"]":
+			return "{\"users\": [\"a\", \"b\"], \"next\": \"2\"}"
+		case "[\"staff\",\"2\"]":
+			return "{\"users\": [\"c\"], \"next\": \"3\"}"
+		}
+		return "{\"users\": [], \"next\": \"\"}"
+	})
+	c := NewClient()
+	c.BaseURL = srv.URL + "/"
+
+	var users []string
+	for u, err := range c.UsersAll(context.Background(), "staff", "") {
+		if err != nil {
+			t.Fatalf("iterating users: %v", err)
+		}
+		users = append(users, u)
+	}
+	if len(users) != 3 || users[0] != "a" || users[2] != "c" || len(calls) != 3 {
+		t.Fatalf("got users %v with calls %v", users, calls)
+	}
+
+	calls = nil
+	for range c.UsersAll(context.Background(), "staff", "") {
+		break
+	}
+	if len(calls) != 1 {
+		t.Fatalf("got calls %v after break, expected 1", calls)
+	}
+
+	tags = "[\"x\", \"y\"]"
+	var n int
+	for _, err := range c.TagsAll(context.Background()) {
+		if err != nil {
+			t.Fatalf("iterating tags: %v", err)
+		}
+		n++
+	}
+	if n != 2 {
+		t.Fatalf("got %d tags, expected 2", n)
+	}
+	tags = "\"bad\""
+	n = 0
+	for tag, err := range c.TagsAll(context.Background()) {
+		if err == nil {
+			t.Fatalf("got tag %q, expected error", tag)
+		}
+		n++
+	}
+	if n != 1 {
+		t.Fatalf("got %d values for failed call, expected 1 error", n)
+	}
+}
+`)
+}
+
+func TestRetries(t *testing.T) {
+	// Failed calls are sent again up to the maximum attempts, within the retry
+	// budget and the deadline.
+	testGenerated(t, Options{}, `import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRetries(t *testing.T) {
+	var requests, failures int32
+	handler := newHandler(t, func(r *http.Request, function string, params []string) (string, error) {
+		return "ok", nil
+	})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		if atomic.AddInt32(&failures, -1) >= 0 {
+			http.Error(w, "busy", http.StatusServiceUnavailable)
+			return
+		}
+		handler.ServeHTTP(w, r)
+	}))
+	defer srv.Close()
+
+	call := func(policy RetryPolicy, fail int32) (int32, error) {
+		atomic.StoreInt32(&requests, 0)
+		atomic.StoreInt32(&failures, fail)
+		c := NewClient(WithRetries(policy))
+		c.BaseURL = srv.URL + "/"
+		_, err := c.Echo(context.Background(), "x")
+		return atomic.LoadInt32(&requests), err
+	}
+
+	if n, err := call(RetryPolicy{Backoff: time.Millisecond}, 2); err != nil || n != 3 {
+		t.Fatalf("got %d requests, %v, expected success after 3", n, err)
+	}
+	if n, err := call(RetryPolicy{Backoff: time.Millisecond, MaxAttempts: 2}, 2); err == nil || n != 2 {
+		t.Fatalf("got %d requests, %v, expected error after 2", n, err)
+	}
+
+	// Waiting for the next attempt would go past the deadline.
+	start := time.Now()
+	if n, err := call(RetryPolicy{Backoff: time.Second, Deadline: 100 * time.Millisecond}, 2); err == nil || n != 1 || time.Since(start) > time.Second/2 {
+		t.Fatalf("got %d requests, %v after %s, expected error after 1", n, err, time.Since(start))
+	}
+
+	// With a budget of a single retry, the second call is not retried.
+	atomic.StoreInt32(&failures, 100)
+	atomic.StoreInt32(&requests, 0)
+	c := NewClient(WithRetries(RetryPolicy{Backoff: time.Millisecond, BudgetMin: 1, BudgetRatio: 0.001}))
+	c.BaseURL = srv.URL + "/"
+	for i := 0; i < 2; i++ {
+		if _, err := c.Echo(context.Background(), "x"); err == nil {
+			t.Fatalf("no error for failing call")
+		}
+	}
+	if n := atomic.LoadInt32(&requests); n != 3 {
+		t.Fatalf("got %d requests for two calls, expected 3 with a single retry", n)
+	}
+}
+`)
+}
+
+func TestTransportTuning(t *testing.T) {
+	// The connection settings and dial function are used by the transport of the
+	// client, and connections for a resolved address go to that address.
+	testGenerated(t, Options{}, `import (
+	"context"
+	"net"
+	"net/http"
+	"net/url"
+	"sync/atomic"
+	"testing"
+)
+
+func TestTransportTuning(t *testing.T) {
+	srv := newServer(t, func(r *http.Request, function string, params []string) (string, error) {
+		return params[0], nil
+	})
+	u, err := url.Parse(srv.URL)
+	if err != nil {
+		t.Fatalf("parsing server url: %v", err)
+	}
+
+	var dials int32
+	dial := func(ctx context.Context, network, addr string) (net.Conn, error) {
+		atomic.AddInt32(&dials, 1)
+		return (&net.Dialer{}).DialContext(ctx, network, addr)
+	}
+	calls := func(c *Client, baseURL string) int32 {
+		atomic.StoreInt32(&dials, 0)
+		c.BaseURL = baseURL
+		for i := 0; i < 3; i++ {
+			if r, err := c.Echo(context.Background(), "hi"); err != nil || r != "hi" {
+				t.Fatalf("calling echo: %q, %v", r, err)
+			}
+		}
+		return atomic.LoadInt32(&dials)
+	}
+
+	if n := calls(NewClient(WithDialContext(dial), WithNoProxy()), srv.URL+"/"); n != 1 {
+		t.Fatalf("got %d dials for 3 calls, expected 1", n)
+	}
+	if n := calls(NewClient(WithDialContext(dial), WithNoProxy(), WithTransportTuning(TransportTuning{DisableKeepAlives: true})), srv.URL+"/"); n != 3 {
+		t.Fatalf("got %d dials for 3 calls without keep-alives, expected 3", n)
+	}
+	if n := calls(NewClient(WithDialContext(dial), WithResolvedAddr(u.Hostname())), "http://sherpa.invalid:"+u.Port()+"/"); n != 1 {
+		t.Fatalf("got %d dials for 3 calls to resolved address, expected 1", n)
+	}
+}
+`)
+}
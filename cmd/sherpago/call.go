@@ -0,0 +1,248 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/mjl-/sherpadoc"
+)
+
+// docTypes holds the named types of a sherpadoc, for checking parameters.
+type docTypes struct {
+	structs map[string]sherpadoc.Struct
+	ints    map[string]sherpadoc.Ints
+	strs    map[string]sherpadoc.Strings
+}
+
+// checkValue checks that v, parsed from JSON with numbers as json.Number, has
+// the type of typewords.
+func (t docTypes) checkValue(typewords []string, v interface{}) error {
+	if len(typewords) == 0 {
+		return fmt.Errorf("missing type")
+	}
+	w, rest := typewords[0], typewords[1:]
+	if w == "nullable" {
+		if v == nil {
+			return nil
+		}
+		return t.checkValue(rest, v)
+	}
+	if v == nil && w != "any" {
+		return fmt.Errorf("null for non-nullable %s", typeString(typewords))
+	}
+	expect := func(ok bool) error {
+		if !ok {
+			return fmt.Errorf("got %s, expected %s", jsonKind(v), typeString(typewords))
+		}
+		return nil
+	}
+	switch w {
+	case "any":
+		return nil
+	case "bool":
+		_, ok := v.(bool)
+		return expect(ok)
+	case "int8", "uint8", "int16", "uint16", "int32", "uint32", "int64", "uint64":
+		n, ok := v.(json.Number)
+		if ok {
+			s := string(n)
+			ok = !strings.ContainsAny(s, ".eE") && !(strings.HasPrefix(w, "uint") && strings.HasPrefix(s, "-"))
+		}
+		return expect(ok)
+	case "float32", "float64":
+		_, ok := v.(json.Number)
+		return expect(ok)
+	case "int64s", "uint64s", "string", "timestamp":
+		s, ok := v.(string)
+		if ok && w == "timestamp" {
+			_, err := time.Parse(time.RFC3339Nano, s)
+			ok = err == nil
+		}
+		return expect(ok)
+	case "[]":
+		l, ok := v.([]interface{})
+		if !ok {
+			return expect(false)
+		}
+		for i, e := range l {
+			if err := t.checkValue(rest, e); err != nil {
+				return fmt.Errorf("[%d]: %s", i, err)
+			}
+		}
+		return nil
+	case "{}":
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return expect(false)
+		}
+		for k, e := range m {
+			if err := t.checkValue(rest, e); err != nil {
+				return fmt.Errorf("%s: %s", k, err)
+			}
+		}
+		return nil
+	}
+	if st, ok := t.structs[w]; ok {
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return expect(false)
+		}
+		for _, f := range st.Fields {
+			if e, ok := m[f.Name]; ok {
+				if err := t.checkValue(f.Typewords, e); err != nil {
+					return fmt.Errorf("%s: %s", f.Name, err)
+				}
+			}
+		}
+		return nil
+	}
+	if it, ok := t.ints[w]; ok {
+		n, ok := v.(json.Number)
+		if !ok {
+			return expect(false)
+		}
+		for _, iv := range it.Values {
+			if string(n) == fmt.Sprint(iv.Value) {
+				return nil
+			}
+		}
+		return fmt.Errorf("unknown value %s for %s", n, w)
+	}
+	if st, ok := t.strs[w]; ok {
+		s, ok := v.(string)
+		if !ok {
+			return expect(false)
+		}
+		for _, sv := range st.Values {
+			if s == sv.Value {
+				return nil
+			}
+		}
+		return fmt.Errorf("unknown value %q for %s", s, w)
+	}
+	return fmt.Errorf("unknown type %s", w)
+}
+
+// jsonKind returns the kind of JSON value v, for error messages.
+func jsonKind(v interface{}) string {
+	switch v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "bool"
+	case json.Number:
+		return "number"
+	case string:
+		return "string"
+	case []interface{}:
+		return "array"
+	}
+	return "object"
+}
+
+// call implements "sherpago call", calling a function of a live API with
+// parameters checked against its sherpadoc, and printing the result.
+func call(args []string) {
+	fs := flag.NewFlagSet("call", flag.ExitOnError)
+	docPath := fs.String("doc", "", "read the sherpadoc from this file instead of fetching it from the API")
+	timeout := fs.Duration("timeout", 30*time.Second, "timeout for the call")
+	fs.Usage = func() {
+		log.Println("sherpago call [flags] baseURL function [param ...]")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() < 2 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	baseURL, name := fs.Arg(0), fs.Arg(1)
+	if !strings.HasSuffix(baseURL, "/") {
+		log.Fatalf("bad baseURL %q: must end with a slash\n", baseURL)
+	}
+
+	var doc *sherpadoc.Section
+	if *docPath != "" {
+		doc = readDoc(*docPath)
+	} else {
+		doc = readDoc(baseURL)
+	}
+	types := docTypes{map[string]sherpadoc.Struct{}, map[string]sherpadoc.Ints{}, map[string]sherpadoc.Strings{}}
+	var fn *sherpadoc.Function
+	var gather func(sec *sherpadoc.Section)
+	gather = func(sec *sherpadoc.Section) {
+		for _, t := range sec.Structs {
+			types.structs[t.Name] = t
+		}
+		for _, t := range sec.Ints {
+			types.ints[t.Name] = t
+		}
+		for _, t := range sec.Strings {
+			types.strs[t.Name] = t
+		}
+		for _, f := range sec.Functions {
+			if f.Name == name {
+				fn = f
+			}
+		}
+		for _, subsec := range sec.Sections {
+			gather(subsec)
+		}
+	}
+	gather(doc)
+	if fn == nil {
+		log.Fatalf("no function %q in sherpadoc\n", name)
+	}
+
+	// Parameters are JSON values, with the sherpadoc types.
+	params := fs.Args()[2:]
+	if len(params) != len(fn.Params) {
+		log.Fatalf("function %q takes %d parameters, got %d: %s\n", name, len(fn.Params), len(params), signature(fn))
+	}
+	for i, p := range params {
+		dec := json.NewDecoder(strings.NewReader(p))
+		dec.UseNumber()
+		var v interface{}
+		if err := dec.Decode(&v); err != nil {
+			log.Fatalf("parameter %s: parsing json: %s\n", fn.Params[i].Name, err)
+		}
+		if err := types.checkValue(fn.Params[i].Typewords, v); err != nil {
+			log.Fatalf("parameter %s: %s\n", fn.Params[i].Name, err)
+		}
+	}
+	body := `{"params":[` + strings.Join(params, ",") + `]}`
+
+	client := &http.Client{Timeout: *timeout}
+	resp, err := client.Post(baseURL+name, "application/json; charset=utf-8", strings.NewReader(body))
+	check(err, "calling function")
+	defer resp.Body.Close()
+	var response struct {
+		Result json.RawMessage `json:"result"`
+		Error  *struct {
+			Code    string `json:"code"`
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		log.Fatalf("parsing response with status %s: %s\n", resp.Status, err)
+	}
+	if response.Error != nil {
+		log.Fatalf("error from server: %s (%s)\n", response.Error.Message, response.Error.Code)
+	}
+	var buf bytes.Buffer
+	if len(response.Result) > 0 {
+		err = json.Indent(&buf, response.Result, "", "\t")
+		check(err, "formatting result")
+	} else {
+		buf.WriteString("null")
+	}
+	buf.WriteByte('\n')
+	_, err = os.Stdout.Write(buf.Bytes())
+	check(err, "writing output")
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/mjl-/sherpago"
+)
+
+// lint implements "sherpago lint", printing the hazards for generating Go code
+// from the sherpadoc on stdin.
+func lint(args []string) {
+	fs := flag.NewFlagSet("lint", flag.ExitOnError)
+	jsonOutput := fs.Bool("json", false, "print issues as JSON objects, one per line, with fields kind, name and message")
+	fieldNames := fs.String("fieldnames", "", "policy for Go names of struct fields, as for generating")
+	noLintNames := fs.Bool("nolintnames", false, "Go names as with -nolintnames for generating")
+	stripPrefix := fs.String("strip-prefix", "", "prefix to remove from function names, as for generating")
+	sectionPrefix := fs.Bool("sectionprefix", false, "prefix names in subsections, as for generating")
+	docWidth := fs.Int("docwidth", 0, "wrap width for documentation, as for generating, long lines are not reported if set")
+	fs.Usage = func() {
+		log.Println("sherpago lint [flags] < sherpadoc.json")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	opts := sherpago.Options{
+		FieldNames:    sherpago.FieldNamePolicy(*fieldNames),
+		NoLintNames:   *noLintNames,
+		StripPrefix:   *stripPrefix,
+		SectionPrefix: *sectionPrefix,
+		DocWidth:      *docWidth,
+	}
+	issues, err := sherpago.Lint(os.Stdin, opts)
+	check(err, "linting sherpadoc")
+	enc := json.NewEncoder(os.Stdout)
+	for _, issue := range issues {
+		if *jsonOutput {
+			err = enc.Encode(issue)
+		} else {
+			_, err = fmt.Printf("%s: %s\n", issue.Kind, issue.Message)
+		}
+		check(err, "writing output")
+	}
+	if len(issues) > 0 {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/mjl-/sherpadoc"
+)
+
+// readDoc reads the sherpadoc from src: stdin for "-" or empty, a live API for
+// an http or https URL, fetching "_docs" for a URL ending with a slash, or a
+// file otherwise.
+func readDoc(src string) *sherpadoc.Section {
+	var r io.Reader
+	switch {
+	case src == "" || src == "-":
+		r = os.Stdin
+	case strings.HasPrefix(src, "http://") || strings.HasPrefix(src, "https://"):
+		if strings.HasSuffix(src, "/") {
+			src += "_docs"
+		}
+		client := &http.Client{Timeout: 30 * time.Second}
+		resp, err := client.Get(src)
+		check(err, "fetching sherpadoc")
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			log.Fatalf("fetching sherpadoc: %s\n", resp.Status)
+		}
+		r = resp.Body
+	default:
+		f, err := os.Open(src)
+		check(err, "opening sherpadoc")
+		defer f.Close()
+		r = f
+	}
+	var doc sherpadoc.Section
+	err := json.NewDecoder(r).Decode(&doc)
+	check(err, "parsing sherpadoc")
+	return &doc
+}
+
+// typeString returns typewords as written in sherpadoc, e.g. "nullable []string".
+func typeString(typewords []string) string {
+	s := ""
+	for i, w := range typewords {
+		s += w
+		if i < len(typewords)-1 && w != "[]" && w != "{}" {
+			s += " "
+		}
+	}
+	return s
+}
+
+// signature returns the signature of fn with the sherpadoc types, e.g.
+// "userGet(id int64) (user User, seen timestamp)".
+func signature(fn *sherpadoc.Function) string {
+	args := func(l []sherpadoc.Arg) []string {
+		var r []string
+		for _, a := range l {
+			r = append(r, strings.TrimSpace(a.Name+" "+typeString(a.Typewords)))
+		}
+		return r
+	}
+	s := fn.Name + "(" + strings.Join(args(fn.Params), ", ") + ")"
+	switch returns := args(fn.Returns); len(returns) {
+	case 0:
+	case 1:
+		s += " " + returns[0]
+	default:
+		s += " (" + strings.Join(returns, ", ") + ")"
+	}
+	return s
+}
+
+// listEntry is a line of "sherpago list".
+type listEntry struct {
+	Kind      string `json:"kind"` // "section", "function", "struct", "ints" or "strings".
+	Section   string `json:"section"`
+	Name      string `json:"name"`
+	Signature string `json:"signature"` // Of a function, fields of a struct, or values of an enum.
+	Docs      string `json:"docs"`
+}
+
+// list implements "sherpago list", printing the sections, functions and types
+// of an API.
+func list(args []string) {
+	fs := flag.NewFlagSet("list", flag.ExitOnError)
+	jsonOutput := fs.Bool("json", false, "print entries as JSON objects, one per line, with fields kind, section, name, signature and docs")
+	fs.Usage = func() {
+		log.Println("sherpago list [flags] [file or url]")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() > 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	doc := readDoc(fs.Arg(0))
+
+	var entries []listEntry
+	var section func(sec *sherpadoc.Section)
+	section = func(sec *sherpadoc.Section) {
+		entries = append(entries, listEntry{"section", sec.Name, sec.Name, "", sec.Docs})
+		for _, fn := range sec.Functions {
+			entries = append(entries, listEntry{"function", sec.Name, fn.Name, signature(fn), fn.Docs})
+		}
+		for _, t := range sec.Structs {
+			var fields []string
+			for _, f := range t.Fields {
+				fields = append(fields, f.Name+" "+typeString(f.Typewords))
+			}
+			entries = append(entries, listEntry{"struct", sec.Name, t.Name, "{" + strings.Join(fields, "; ") + "}", t.Docs})
+		}
+		for _, t := range sec.Ints {
+			var values []string
+			for _, v := range t.Values {
+				values = append(values, fmt.Sprintf("%s=%d", v.Name, v.Value))
+			}
+			entries = append(entries, listEntry{"ints", sec.Name, t.Name, strings.Join(values, ", "), t.Docs})
+		}
+		for _, t := range sec.Strings {
+			var values []string
+			for _, v := range t.Values {
+				values = append(values, fmt.Sprintf("%s=%q", v.Name, v.Value))
+			}
+			entries = append(entries, listEntry{"strings", sec.Name, t.Name, strings.Join(values, ", "), t.Docs})
+		}
+		for _, subsec := range sec.Sections {
+			section(subsec)
+		}
+	}
+	section(doc)
+
+	if *jsonOutput {
+		enc := json.NewEncoder(os.Stdout)
+		for _, e := range entries {
+			err := enc.Encode(e)
+			check(err, "writing output")
+		}
+		return
+	}
+	tw := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	for _, e := range entries {
+		if e.Kind == "section" {
+			continue
+		}
+		s := e.Signature
+		if e.Kind != "function" {
+			s = e.Name + " " + s
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", e.Section, e.Kind, s)
+	}
+	err := tw.Flush()
+	check(err, "writing output")
+}
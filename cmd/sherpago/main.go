@@ -6,10 +6,252 @@
 //
 // 	sherpadoc MyAPI >myapi.json
 // 	sherpago mypkg http://example.org/myapi/ < myapi.json > myapi.go
+//
+// With -bench, a test file with benchmarks for the generated package is written
+// instead:
+//
+// 	sherpago -bench mypkg http://example.org/myapi/ < myapi.json > myapi_bench_test.go
+//
+// With -fake, a file with NewFake<Type>(seed) functions returning populated
+// values of each struct type is written instead, for use in tests.
+//
+// With -cli, the source of a command-line program is written instead. It has a
+// subcommand for each function and uses the client package, which must be
+// generated separately and is imported from the path given to -cli:
+//
+// 	sherpago -cli example.org/mypkg mypkg http://example.org/myapi/ < myapi.json > cmd/mypkg/main.go
+//
+// With -markdown, a markdown API reference with the Go names and signatures is
+// written instead.
+//
+// With -mobile, a file with a Mobile type wrapping the client for gomobile bind
+// is written instead. Its methods have no context, and parameters and results
+// that gomobile cannot represent are JSON text.
+//
+// With -nats, a file with a NATSTransport type is written instead, for use
+// with the WithTransport option of the client, sending calls as NATS requests.
+//
+// With -postman, a Postman collection is written instead, with a request with
+// example parameters for each function, for exploring the API with Postman or
+// Insomnia.
+//
+// With -o, the client and all files selected by the flags above are written to
+// a directory, instead of a single file to stdout:
+//
+// 	sherpago -o mypkg -bench -fake -markdown mypkg http://example.org/myapi/ < myapi.json
+//
+// With -snippet types or -snippet client, only the types or only the client
+// are generated, without package clause and imports, to be included in an existing
+// package, e.g. with go:generate:
+//
+// 	//go:generate sh -c "sherpago -snippet types mypkg http://example.org/myapi/ < myapi.json | goimports > myapi_types.go"
+//
+// With -fastjson, the struct types get MarshalJSON and UnmarshalJSON methods
+// that do not use reflection, for faster encoding and decoding of large
+// responses.
+//
+// With -nullableslices, nullable arrays and objects are slices and maps instead
+// of pointers to them, with nil for null.
+//
+// With -tinygo, the client is suitable for TinyGo, e.g. for WebAssembly. It
+// implies -fastjson and -nosherpadep, and leaves out the options for the HTTP
+// transport.
+//
+// With -fieldnames camel, Go names of struct fields are made from the words in
+// their names, e.g. UserID for "user-id", for APIs with names that are not Go
+// identifiers. With -fieldnames lowercamel, the names in JSON are also changed
+// to lower camel case, e.g. "userID" for "user_id".
+//
+// With -nolintnames, Go names are the names from the sherpadoc with only the
+// first letter in upper case, e.g. UserId for "userId" instead of UserID.
+//
+// With -client-name, the client type gets another name than Client, e.g.
+// AdminClient, created by NewAdminClient.
+//
+// With -api, once for each additional API, clients for other APIs are written
+// to the same package, each with its own client type, e.g. for a daemon with
+// APIs for accounts and admins. Types with the same name in the APIs are
+// generated once. It requires -o:
+//
+// 	sherpago -o mypkg -api AdminClient,http://example.org/admin/,admin.json mypkg http://example.org/myapi/ < myapi.json
+//
+// With -strip-prefix, a prefix is removed from the function names for the
+// method names, e.g. with -strip-prefix admin, function "adminAddDomain"
+// becomes method AddDomain.
+//
+// With -sectionprefix, types and enum values defined in subsections get the
+// names of the subsections as prefix, e.g. AdminDomain for type Domain in
+// section Admin.
+//
+// With -noctx, each client method also gets a variant without context
+// parameter, e.g. PingNoCtx for Ping, for use in scripts.
+//
+// With -raw, each client method also gets a variant returning the result as
+// undecoded JSON, e.g. PingRaw for Ping, for forwarding results verbatim.
+//
+// With -iter, functions returning an array, or with annotation "pages", also
+// get a variant returning an iterator over the elements, e.g. ListUsersAll for
+// ListUsers, for use with range over func of Go 1.23.
+//
+// With -catalog, the client gets a Functions method describing the functions
+// of the API, with their parameter and return types, and a DynamicCall method
+// calling a function by name, for generic dispatch.
+//
+// With -expvar, the client gets a WithExpvar option publishing counters of
+// calls and errors by function with package expvar, at /debug/vars.
+//
+// With -websocket, the client gets a WithWebSocket option, for sending calls
+// over a single WebSocket connection, to servers implementing its protocol.
+//
+// With -codec, the client gets a WithCodec option, for sending requests and
+// getting responses in CBOR or MessagePack instead of JSON.
+//
+// With -keyring, the client gets a KeyringCredentials function, with a
+// provider of credentials from the keyring of the OS, read with the commands
+// "security" on macOS and "secret-tool" on other systems.
+//
+// With -schemadrift, the client gets a WithSchemaDrift option reporting fields
+// in results that are not in the sherpadoc, and null for non-nullable types,
+// without failing calls, for monitoring changes to the API of a server.
+//
+// With -validate, the client checks parameters before sending them, and
+// results, against the sherpadoc, and returns a ValidationError for
+// undocumented enum values and null for non-nullable types. Invalid calls fail
+// without a round trip, and changes to the API of a server are noticed.
+//
+// With -orzero, the struct and enum types get an OrZero method, returning the
+// zero value for a nil pointer, e.g. for nullable results, which are nil for
+// null.
+//
+// With -enumhelpers, each enum type gets a function listing its values, e.g.
+// StatusValues, a Name method, and a function looking up a value by name, e.g.
+// StatusByName.
+//
+// With -extrafields, struct types get an Extra field with the JSON fields that
+// are not in the sherpadoc, which are sent again with the struct, so data from a
+// newer server survives a round trip.
+//
+// With -omitzerotime, struct fields with timestamps are left out of the JSON
+// when zero, instead of sending "0001-01-01T00:00:00Z".
+//
+// With -enumunknown, each enum type gets a constant for undocumented values,
+// e.g. StatusUnknown, returned by its OrUnknown method for values added to the
+// API after the client was generated.
+//
+// Documentation from the sherpadoc, often markdown, is turned into Go doc
+// comments, with headings, lists and code blocks in Go doc comment syntax. With
+// -docwidth, paragraphs and list items are wrapped at the given width. Lines
+// starting with "Deprecated:", also in bold, become deprecation notices that
+// editors and linters recognize. With -skipdeprecated, functions with such a
+// notice are left out. A paragraph "Example:" in the documentation of a
+// function, followed by a code block with the JSON parameters for a call,
+// becomes an example call of the client method.
+//
+// With -module, a go.mod and go.sum are written as well, making the directory a
+// module that can be published on its own:
+//
+// 	sherpago -o mypkg -module example.org/mypkg -cli example.org/mypkg mypkg http://example.org/myapi/ < myapi.json
+//
+// Documentation in the sherpadoc can have lines with annotations for sherpago,
+// starting with "sherpago:" and followed by space-separated keys, with an
+// optional value as key=value. These lines are left out of the generated
+// documentation. For functions, the annotations are:
+//
+// 	get	Call the function with a GET request, with the parameters in the
+// 		query string, so responses can be cached, e.g. by a CDN. With
+// 		option WithSingleFlight, identical concurrent calls share a
+// 		request.
+// 	timeout=<duration>
+// 		Give up on calls after the duration, e.g. "30s", when the context
+// 		of the call has no deadline.
+// 	no-retry
+// 		Never send the request more than once, e.g. for a function that
+// 		is not idempotent. The request body cannot be sent again, e.g.
+// 		after a redirect or lost HTTP/2 connection.
+// 	await=<field>[:<value>,...]
+// 		The function returns the status of a long-running operation, a
+// 		struct with a bool field that is true when the operation is done,
+// 		or a string field with one of the values when done, e.g.
+// 		"await=state:done,failed". The client gets a method, e.g.
+// 		AwaitJobStatus for function jobStatus, that calls the function
+// 		until the operation is done, waiting longer between each call.
+// 	events=<path>
+// 		The results of the function are the types of the server-sent
+// 		events at path, relative to the base URL, e.g. "../events". The
+// 		name of an event is the name of its result, or of its type. The
+// 		client gets a method, e.g. SubscribeChanges for function
+// 		changes, returning a channel with the events, and a type for the
+// 		events, e.g. ChangesEvent. Lost connections are restored.
+// 	pages=<param>:<items>:<next>
+// 		The function returns a page of a list, in a struct with array
+// 		field items and field next with the value of parameter param for
+// 		the next page, zero after the last page, e.g.
+// 		"pages=cursor:users:next". With -iter, the iterator method calls
+// 		the function for each page.
+//
+// For types, the annotations are:
+//
+// 	bitmask	The values of the int enum are flags that can be combined. The
+// 		type gets methods Has, Set and Clear, and a String method with
+// 		the names of the flags.
+// 	union=<field> variants=<kind>:<type>,...
+// 		The struct is one of the variant struct types, by the value of
+// 		their string field, e.g. "union=kind
+// 		variants=message:EventMessage,join:EventJoin". The Go type has
+// 		a field Value with an interface type implemented by the
+// 		variants, and methods for JSON that dispatch on the field.
+// 	embeds=<type>,...
+// 		The struct embeds these struct types in Go, instead of having
+// 		their fields, which it must also have in the sherpadoc.
+//
+// For struct fields, the annotations are:
+//
+// 	default=<json>
+// 		Default value of the field, e.g. 10 or "dark", without spaces.
+// 		Struct types with such fields get a SetDefaults method, and a
+// 		New<Type> function returning a value with the defaults.
+// 	duration=<unit>
+// 		The integer field is a duration in unit ns, us, ms, s, m or h,
+// 		e.g. "duration=ms". The Go field is a time.Duration, converted
+// 		from and to the unit in JSON, with fractions of the unit
+// 		truncated. Types embedding such struct types require -fastjson.
+// 	format=<format>
+// 		The string field has a format, with a Go type: "ip" for a
+// 		netip.Addr, "mac" for a net.HardwareAddr, or "url" for a
+// 		*url.URL, with links checked when decoding. The empty string is
+// 		the zero value. Net/netip requires Go 1.18. Or "uuid" for the
+// 		type of -uuidtype, e.g. github.com/google/uuid.UUID, which must
+// 		implement encoding.TextMarshaler and TextUnmarshaler. Or
+// 		"decimal" or "money" for the type of -decimaltype, e.g.
+// 		github.com/shopspring/decimal.Decimal, for string fields, e.g.
+// 		"12.50", and float fields, decoded without rounding to float64.
+//
+// Subcommand lint reads sherpadoc from stdin and prints hazards for generating
+// Go code, e.g. names that become the same Go name or only differ in case,
+// fields with the name of a generated method, and long lines in documentation,
+// exiting with status 1 if there are any. With -json, each issue is printed as
+// a JSON object on a line. A package named like a subcommand is generated with
+// "--" before its name:
+//
+// 	sherpago lint -json < myapi.json
+//
+// Subcommand list prints the functions with their signatures, and the types, of
+// the API with sherpadoc from stdin, a file, or an http or https URL, for which
+// "_docs" is fetched if it ends with a slash. With -json, each section, function
+// and type is printed as a JSON object on a line.
+//
+// 	sherpago list https://example.org/myapi/
+//
+// Subcommand call calls a function of an API without generating a client. The
+// parameters are JSON values, checked against the sherpadoc fetched from the
+// API, or read from the file of -doc. The result is printed as JSON.
+//
+// 	sherpago call https://example.org/myapi/ userGet 123 '"admin"'
 package main
 
 import (
 	"flag"
+	"fmt"
 	"log"
 	"net/url"
 	"os"
@@ -18,6 +260,21 @@ import (
 	"github.com/mjl-/sherpago"
 )
 
+// apiFlags are the values of -api flags, "clientName,baseURL,path".
+type apiFlags []string
+
+func (l *apiFlags) String() string {
+	return strings.Join(*l, " ")
+}
+
+func (l *apiFlags) Set(s string) error {
+	if len(strings.SplitN(s, ",", 3)) != 3 {
+		return fmt.Errorf("must be clientName,baseURL,path")
+	}
+	*l = append(*l, s)
+	return nil
+}
+
 func check(err error, action string) {
 	if err != nil {
 		log.Fatalf("%s: %s\n", action, err)
@@ -26,8 +283,65 @@ func check(err error, action string) {
 
 func main() {
 	log.SetFlags(0)
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "lint":
+			lint(os.Args[2:])
+			return
+		case "list":
+			list(os.Args[2:])
+			return
+		case "call":
+			call(os.Args[2:])
+			return
+		}
+	}
+	bench := flag.Bool("bench", false, "generate benchmarks for the client package instead of the client")
+	fake := flag.Bool("fake", false, "generate functions returning fake values of the struct types instead of the client")
+	cli := flag.String("cli", "", "generate a command-line program using the client package at this import path, instead of the client")
+	markdown := flag.Bool("markdown", false, "generate a markdown API reference instead of the client")
+	mobile := flag.Bool("mobile", false, "generate a wrapper of the client for gomobile bind instead of the client")
+	nats := flag.Bool("nats", false, "generate a transport for the client sending calls as NATS requests instead of the client")
+	postman := flag.Bool("postman", false, "generate a Postman collection instead of the client")
+	unexported := flag.Bool("unexported", false, "generate unexported identifiers only, for embedding the client in a package with its own API")
+	noSherpaDep := flag.Bool("nosherpadep", false, "do not import github.com/mjl-/sherpa in the client, but generate its own Error type and error codes")
+	fastJSON := flag.Bool("fastjson", false, "generate MarshalJSON and UnmarshalJSON methods without reflection for the struct types")
+	nullableSlices := flag.Bool("nullableslices", false, "use slices and maps with nil for null for nullable arrays and objects, instead of pointers, and send nil non-nullable arrays and objects as empty")
+	tinyGo := flag.Bool("tinygo", false, "generate a client suitable for TinyGo, implies -fastjson and -nosherpadep, without the options for the HTTP transport")
+	fieldNames := flag.String("fieldnames", "", "policy for Go names of struct fields: empty for the default, camel, or lowercamel to also change the names in JSON")
+	noLintNames := flag.Bool("nolintnames", false, "only change the first letter of names from the sherpadoc to upper case for Go names, without changes like golint for initialisms")
+	clientName := flag.String("client-name", "", "name of the client type instead of Client, e.g. AdminClient, with NewAdminClient creating one")
+	stripPrefix := flag.String("strip-prefix", "", "remove this prefix from function names for the method names, e.g. admin for AddDomain for adminAddDomain")
+	sectionPrefix := flag.Bool("sectionprefix", false, "prefix names of types and enum values defined in subsections with the names of the subsections")
+	noCtx := flag.Bool("noctx", false, "also generate methods without context parameter, with NoCtx appended to their names, using context.Background()")
+	iterMethods := flag.Bool("iter", false, "also generate methods returning iterators over the elements of array results, with All appended to their names, requiring Go 1.23")
+	raw := flag.Bool("raw", false, "also generate methods returning the result as undecoded JSON, with Raw appended to their names")
+	catalog := flag.Bool("catalog", false, "generate a Functions method on the client describing the functions of the API, and a DynamicCall method calling them by name")
+	expvarOpt := flag.Bool("expvar", false, "generate a WithExpvar option for the client, publishing counters of calls and errors by function with package expvar")
+	webSocket := flag.Bool("websocket", false, "generate a WithWebSocket option for the client, sending calls over a single WebSocket connection")
+	codec := flag.Bool("codec", false, "generate a WithCodec option for the client, with CBOR and MessagePack codecs for request and response bodies")
+	keyring := flag.Bool("keyring", false, "generate a KeyringCredentials function, with a provider of credentials from the keyring of the OS, read by running a command")
+	schemaDrift := flag.Bool("schemadrift", false, "generate a WithSchemaDrift option for the client, reporting differences between results and the sherpadoc without failing calls")
+	orZero := flag.Bool("orzero", false, "generate OrZero methods for the struct and enum types, returning the zero value for a nil pointer")
+	enumHelpers := flag.Bool("enumhelpers", false, "generate functions listing the values of enum types and looking them up by name")
+	enumUnknown := flag.Bool("enumunknown", false, "generate a constant for undocumented values of enum types, e.g. StatusUnknown, returned by their OrUnknown method")
+	omitZeroTime := flag.Bool("omitzerotime", false, "leave struct fields with timestamps out of the JSON when they have the zero time")
+	decimalType := flag.String("decimaltype", "", "Go type for string and float fields with annotation format=decimal or format=money, as import path and type name, e.g. github.com/shopspring/decimal.Decimal")
+	uuidType := flag.String("uuidtype", "", "Go type for string fields with annotation format=uuid, as import path and type name, e.g. github.com/google/uuid.UUID")
+	extraFields := flag.Bool("extrafields", false, "add an Extra field to struct types with the JSON fields that are not in the sherpadoc, encoded again with the struct")
+	validate := flag.Bool("validate", false, "check parameters and results against the sherpadoc, for enum values and nullability")
+	skipDeprecated := flag.Bool("skipdeprecated", false, "leave out functions with a deprecation notice in their documentation")
+	docWidth := flag.Int("docwidth", 0, "wrap paragraphs and list items in doc comments at this width, 0 keeps lines as in the sherpadoc")
+	snippet := flag.String("snippet", "", "generate only part of the client, without package clause and imports, for inclusion in an existing package: types or client")
+	module := flag.String("module", "", "with -o, also write a go.mod and go.sum for a module with this path")
+	outDir := flag.String("o", "", "write the client and the files selected by the other flags to this directory, instead of a single file to stdout")
+	var apis apiFlags
+	flag.Var(&apis, "api", "with -o, also generate a client for the API with sherpadoc at path, as clientName,baseURL,path, can be repeated")
 	flag.Usage = func() {
-		log.Println("sherpago packageName baseURL")
+		log.Println("sherpago [flags] packageName baseURL")
+		log.Println("sherpago lint [flags] < sherpadoc.json")
+		log.Println("sherpago list [flags] [file or url]")
+		log.Println("sherpago call [flags] baseURL function [param ...]")
 		flag.PrintDefaults()
 	}
 	flag.Parse()
@@ -37,6 +351,21 @@ func main() {
 		flag.Usage()
 		os.Exit(2)
 	}
+	n := 0
+	for _, b := range []bool{*bench, *fake, *cli != "", *markdown, *mobile, *nats, *postman} {
+		if b {
+			n++
+		}
+	}
+	if len(apis) > 0 && *outDir == "" {
+		log.Fatalln("-api requires -o")
+	}
+	if *module != "" && *outDir == "" {
+		log.Fatalln("-module requires -o")
+	}
+	if n > 1 && *outDir == "" {
+		log.Fatalln("without -o, at most one of -bench, -fake, -cli, -markdown, -mobile, -nats and -postman can be specified")
+	}
 	packageName := args[0]
 	baseURL := args[1]
 
@@ -49,6 +378,83 @@ func main() {
 		log.Fatalf("bad baseURL %q: must end with a slash\n", baseURL)
 	}
 
-	err = sherpago.Generate(os.Stdin, os.Stdout, packageName, baseURL)
+	opts := sherpago.Options{
+		PackageName:    packageName,
+		BaseURL:        baseURL,
+		Benchmarks:     *bench,
+		Fakes:          *fake,
+		Markdown:       *markdown,
+		Mobile:         *mobile,
+		NATS:           *nats,
+		Postman:        *postman,
+		CLIImportPath:  *cli,
+		NoSherpaDep:    *noSherpaDep,
+		Unexported:     *unexported,
+		FastJSON:       *fastJSON,
+		NullableSlices: *nullableSlices,
+		SectionPrefix:  *sectionPrefix,
+		FieldNames:     sherpago.FieldNamePolicy(*fieldNames),
+		NoLintNames:    *noLintNames,
+		StripPrefix:    *stripPrefix,
+		ClientName:     *clientName,
+		TinyGo:         *tinyGo,
+		NoCtxMethods:   *noCtx,
+		RawMethods:     *raw,
+		IterMethods:    *iterMethods,
+		Catalog:        *catalog,
+		SchemaDrift:    *schemaDrift,
+		Expvar:         *expvarOpt,
+		Keyring:        *keyring,
+		Codec:          *codec,
+		WebSocket:      *webSocket,
+		Validate:       *validate,
+		OrZero:         *orZero,
+		EnumHelpers:    *enumHelpers,
+		EnumUnknown:    *enumUnknown,
+		ExtraFields:    *extraFields,
+		OmitZeroTime:   *omitZeroTime,
+		UUIDType:       *uuidType,
+		DecimalType:    *decimalType,
+		SkipDeprecated: *skipDeprecated,
+		DocWidth:       *docWidth,
+		ModulePath:     *module,
+		Snippet:        sherpago.Snippet(*snippet),
+	}
+
+	for _, api := range apis {
+		t := strings.SplitN(api, ",", 3)
+		f, err := os.Open(t[2])
+		check(err, "opening sherpadoc for -api")
+		defer f.Close()
+		opts.APIs = append(opts.APIs, sherpago.API{Doc: f, ClientName: t[0], BaseURL: t[1]})
+	}
+
+	if *outDir != "" {
+		err = sherpago.GenerateFS(os.Stdin, sherpago.DirFS(*outDir), opts)
+		check(err, "generating files")
+		return
+	}
+
+	// Only a single file is written to stdout.
+	name := packageName + ".go"
+	switch {
+	case *bench:
+		name = packageName + "_bench_test.go"
+	case *fake:
+		name = packageName + "_fake.go"
+	case *cli != "":
+		name = "cmd/" + packageName + "/main.go"
+	case *markdown:
+		name = "API.md"
+	case *mobile:
+		name = packageName + "_mobile.go"
+	case *nats:
+		name = packageName + "_nats.go"
+	case *postman:
+		name = packageName + ".postman_collection.json"
+	}
+	files, err := sherpago.GenerateFiles(os.Stdin, opts)
 	check(err, "generating go client package")
+	_, err = os.Stdout.Write(files[name])
+	check(err, "writing output")
 }
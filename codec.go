@@ -0,0 +1,562 @@
+package sherpago
+
+import (
+	"fmt"
+)
+
+// codecCallCode returns the Go code for the codec in the client type and its
+// call method, for Options.Codec: the field of the client type, and the code
+// converting the request body, asking for responses in the codec, and
+// converting the response body. Without Options.Codec, all are empty and calls
+// only use JSON.
+func (g *generator) codecCallCode() (field, request, accept, response string) {
+	if !g.opts.Codec {
+		return "", "", "", ""
+	}
+	field = fmt.Sprintf("\tcodec *%s // See %s.\n", g.clientIdent("Codec"), g.clientIdent("WithCodec"))
+	return field, codecRequestCode, codecAcceptCode, codecResponseCode
+}
+
+// codecRequestCode, codecAcceptCode and codecResponseCode are the Go code in the
+// call method of the client for Options.Codec, see codecCallCode.
+const codecRequestCode = `	if c.codec != nil && !info.get {
+		cbody, err := c.codec.FromJSON(body)
+		if err != nil {
+			return &sherpa.Error{Code: "sherpa:http", Message: "encoding request: " + err.Error()}
+		}
+		body = cbody
+		contentType = c.codec.ContentType
+	}
+`
+
+const codecAcceptCode = `	if c.codec != nil {
+		req.Header.Set("Accept", c.codec.ContentType+", application/json;q=0.5")
+	}
+`
+
+const codecResponseCode = `	if ct := resp.Header.Get("Content-Type"); c.codec != nil && strings.EqualFold(strings.TrimSpace(strings.Split(ct, ";")[0]), c.codec.ContentType) {
+		buf, err := io.ReadAll(respBody)
+		if err != nil {
+			return &sherpa.Error{Code: sherpa.SherpaHTTPError, Message: "reading response: " + err.Error()}
+		}
+		if buf, err = c.codec.ToJSON(buf); err != nil {
+			return &sherpa.Error{Code: sherpa.SherpaBadResponse, Message: "decoding response: " + err.Error()}
+		}
+		respBody = bytes.NewReader(buf)
+	}
+`
+
+// codecCode is the Go code for encodings of request and response bodies other
+// than JSON, see Options.Codec. It is a format string with the names of the
+// client type, the option type, the Codec type, the CBORCodec and
+// MessagePackCodec variables, and the WithCodec and WithTransport functions as
+// parameters.
+const codecCode = `// %[3]s is an encoding of request and response bodies other than JSON, see
+// %[6]s. It converts from and to the JSON of requests and responses.
+type %[3]s struct {
+	ContentType string                           // E.g. "application/cbor".
+	FromJSON    func(buf []byte) ([]byte, error) // Converts a JSON request body.
+	ToJSON      func(buf []byte) ([]byte, error) // Converts a response body to JSON.
+}
+
+// %[4]s is CBOR, RFC 8949, with content type "application/cbor". Byte strings
+// in responses become base64 strings, and tags are ignored.
+var %[4]s = %[3]s{
+	ContentType: "application/cbor",
+	FromJSON: func(buf []byte) ([]byte, error) {
+		return codecFromJSON(buf, cborAppend)
+	},
+	ToJSON: func(buf []byte) ([]byte, error) {
+		return codecToJSON(buf, (*codecDecoder).cbor)
+	},
+}
+
+// %[5]s is MessagePack, with content type "application/msgpack".
+// Binary values in responses become base64 strings, extension types are not
+// supported.
+var %[5]s = %[3]s{
+	ContentType: "application/msgpack",
+	FromJSON: func(buf []byte) ([]byte, error) {
+		return codecFromJSON(buf, msgpackAppend)
+	},
+	ToJSON: func(buf []byte) ([]byte, error) {
+		return codecToJSON(buf, (*codecDecoder).msgpack)
+	},
+}
+
+// %[6]s returns an option that makes the client send request bodies in
+// codec, e.g. %[4]s, and ask for responses in codec, for smaller messages.
+// The server must accept requests in codec. Responses with another content
+// type are read as JSON. Parameters of functions called with GET are always
+// JSON. Calls with %[7]s or over a WebSocket connection are not affected.
+func %[6]s(codec %[3]s) %[2]s {
+	return func(c *%[1]s) {
+		c.codec = &codec
+	}
+}
+
+// codecFromJSON converts JSON value buf with appendValue.
+func codecFromJSON(buf []byte, appendValue func(b []byte, v interface{}) ([]byte, error)) ([]byte, error) {
+	dec := json.NewDecoder(bytes.NewReader(buf))
+	dec.UseNumber()
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+	return appendValue(nil, v)
+}
+
+// appendBigEndian appends the size lowest bytes of n, most significant first.
+func appendBigEndian(b []byte, n uint64, size int) []byte {
+	for i := size - 1; i >= 0; i-- {
+		b = append(b, byte(n>>(8*i)))
+	}
+	return b
+}
+
+// cborHead appends the initial bytes of a data item of major type with argument n.
+func cborHead(b []byte, major byte, n uint64) []byte {
+	major <<= 5
+	switch {
+	case n < 24:
+		return append(b, major|byte(n))
+	case n <= 0xff:
+		return appendBigEndian(append(b, major|24), n, 1)
+	case n <= 0xffff:
+		return appendBigEndian(append(b, major|25), n, 2)
+	case n <= 0xffffffff:
+		return appendBigEndian(append(b, major|26), n, 4)
+	}
+	return appendBigEndian(append(b, major|27), n, 8)
+}
+
+// cborAppend appends v, a JSON value decoded with json.Number, as CBOR.
+func cborAppend(b []byte, v interface{}) ([]byte, error) {
+	switch v := v.(type) {
+	case nil:
+		return append(b, 0xf6), nil
+	case bool:
+		if v {
+			return append(b, 0xf5), nil
+		}
+		return append(b, 0xf4), nil
+	case string:
+		return append(cborHead(b, 3, uint64(len(v))), v...), nil
+	case json.Number:
+		if n, err := v.Int64(); err == nil && n >= 0 {
+			return cborHead(b, 0, uint64(n)), nil
+		} else if err == nil {
+			return cborHead(b, 1, uint64(-(n + 1))), nil
+		}
+		if n, err := strconv.ParseUint(string(v), 10, 64); err == nil {
+			return cborHead(b, 0, n), nil
+		}
+		f, err := v.Float64()
+		if err != nil {
+			return nil, err
+		}
+		return appendBigEndian(append(b, 0xfb), math.Float64bits(f), 8), nil
+	case []interface{}:
+		b = cborHead(b, 4, uint64(len(v)))
+		for _, e := range v {
+			var err error
+			if b, err = cborAppend(b, e); err != nil {
+				return nil, err
+			}
+		}
+		return b, nil
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		b = cborHead(b, 5, uint64(len(v)))
+		for _, k := range keys {
+			b = append(cborHead(b, 3, uint64(len(k))), k...)
+			var err error
+			if b, err = cborAppend(b, v[k]); err != nil {
+				return nil, err
+			}
+		}
+		return b, nil
+	}
+	return nil, fmt.Errorf("unsupported value of type %%T", v)
+}
+
+// msgpackHead appends the type and length n of a string, array or map, with
+// type fix for n below max, or else the type for an 8 bit length, if not 0,
+// followed by the types for a 16 and 32 bit length.
+func msgpackHead(b []byte, n int, fix byte, max int, types [3]byte) []byte {
+	switch {
+	case n < max:
+		return append(b, fix|byte(n))
+	case n <= 0xff && types[0] != 0:
+		return appendBigEndian(append(b, types[0]), uint64(n), 1)
+	case n <= 0xffff:
+		return appendBigEndian(append(b, types[1]), uint64(n), 2)
+	}
+	return appendBigEndian(append(b, types[2]), uint64(n), 4)
+}
+
+// msgpackAppend appends v, a JSON value decoded with json.Number, as
+// MessagePack.
+func msgpackAppend(b []byte, v interface{}) ([]byte, error) {
+	switch v := v.(type) {
+	case nil:
+		return append(b, 0xc0), nil
+	case bool:
+		if v {
+			return append(b, 0xc3), nil
+		}
+		return append(b, 0xc2), nil
+	case string:
+		return append(msgpackHead(b, len(v), 0xa0, 32, [3]byte{0xd9, 0xda, 0xdb}), v...), nil
+	case json.Number:
+		if n, err := v.Int64(); err == nil {
+			if n >= -32 && n < 128 {
+				return append(b, byte(n)), nil
+			}
+			// The smallest of 1, 2, 4 and 8 bytes, with types from 0xcc for unsigned
+			// and 0xd0 for signed.
+			t, size := byte(0xcc), 1
+			if n < 0 {
+				t = 0xd0
+			}
+			for size < 8 && (n >= 0 && uint64(n)>>(8*size) != 0 || n < int64(-1)<<(8*size-1)) {
+				t++
+				size *= 2
+			}
+			return appendBigEndian(append(b, t), uint64(n), size), nil
+		}
+		if n, err := strconv.ParseUint(string(v), 10, 64); err == nil {
+			return appendBigEndian(append(b, 0xcf), n, 8), nil
+		}
+		f, err := v.Float64()
+		if err != nil {
+			return nil, err
+		}
+		return appendBigEndian(append(b, 0xcb), math.Float64bits(f), 8), nil
+	case []interface{}:
+		b = msgpackHead(b, len(v), 0x90, 16, [3]byte{0, 0xdc, 0xdd})
+		for _, e := range v {
+			var err error
+			if b, err = msgpackAppend(b, e); err != nil {
+				return nil, err
+			}
+		}
+		return b, nil
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		b = msgpackHead(b, len(v), 0x80, 16, [3]byte{0, 0xde, 0xdf})
+		for _, k := range keys {
+			b = append(msgpackHead(b, len(k), 0xa0, 32, [3]byte{0xd9, 0xda, 0xdb}), k...)
+			var err error
+			if b, err = msgpackAppend(b, v[k]); err != nil {
+				return nil, err
+			}
+		}
+		return b, nil
+	}
+	return nil, fmt.Errorf("unsupported value of type %%T", v)
+}
+
+// codecDecoder converts a CBOR or MessagePack value to JSON.
+type codecDecoder struct {
+	buf   []byte // Remaining input.
+	out   []byte // JSON.
+	depth int    // Of arrays, maps and tags, limited against stack exhaustion.
+}
+
+// codecToJSON converts buf, a single value, to JSON with value.
+func codecToJSON(buf []byte, value func(d *codecDecoder) error) ([]byte, error) {
+	d := &codecDecoder{buf: buf}
+	if err := value(d); err != nil {
+		return nil, err
+	}
+	if len(d.buf) > 0 {
+		return nil, fmt.Errorf("data after value")
+	}
+	return d.out, nil
+}
+
+func (d *codecDecoder) take(n uint64) ([]byte, error) {
+	if n > uint64(len(d.buf)) {
+		return nil, io.ErrUnexpectedEOF
+	}
+	b := d.buf[:n]
+	d.buf = d.buf[n:]
+	return b, nil
+}
+
+// uint reads an unsigned integer of size bytes, most significant first.
+func (d *codecDecoder) uint(size int) (uint64, error) {
+	b, err := d.take(uint64(size))
+	var n uint64
+	for _, c := range b {
+		n = n<<8 | uint64(c)
+	}
+	return n, err
+}
+
+// str appends b, a text string, or a byte string as base64 if isBytes.
+func (d *codecDecoder) str(b []byte, isBytes bool) error {
+	var buf []byte
+	var err error
+	if isBytes {
+		buf, err = json.Marshal(b)
+	} else {
+		buf, err = json.Marshal(string(b))
+	}
+	d.out = append(d.out, buf...)
+	return err
+}
+
+func (d *codecDecoder) float(f float64, bits int) error {
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return fmt.Errorf("number %%v not valid in JSON", f)
+	}
+	d.out = strconv.AppendFloat(d.out, f, 'g', -1, bits)
+	return nil
+}
+
+// items converts n array elements, or n map keys and values, with value, or
+// until a CBOR break if indefinite.
+func (d *codecDecoder) items(n uint64, isMap, indefinite bool, value func(d *codecDecoder) error) error {
+	if d.depth++; d.depth > 1000 {
+		return fmt.Errorf("values nested too deeply")
+	}
+	defer func() { d.depth-- }()
+	open, close := byte('['), byte(']')
+	if isMap {
+		open, close = '{', '}'
+	}
+	d.out = append(d.out, open)
+	for i := uint64(0); indefinite || i < n; i++ {
+		if indefinite && len(d.buf) > 0 && d.buf[0] == 0xff {
+			d.buf = d.buf[1:]
+			break
+		}
+		if i > 0 {
+			d.out = append(d.out, ',')
+		}
+		if isMap {
+			start := len(d.out)
+			if err := value(d); err != nil {
+				return err
+			}
+			if d.out[start] != '"' {
+				return fmt.Errorf("map key is not a string")
+			}
+			d.out = append(d.out, ':')
+		}
+		if err := value(d); err != nil {
+			return err
+		}
+	}
+	d.out = append(d.out, close)
+	return nil
+}
+
+// cborArg reads the argument of a data item with additional information info,
+// at most 27.
+func (d *codecDecoder) cborArg(info byte) (uint64, error) {
+	if info < 24 {
+		return uint64(info), nil
+	}
+	return d.uint(1 << (info - 24))
+}
+
+// cbor converts a CBOR data item.
+func (d *codecDecoder) cbor() error {
+	b, err := d.take(1)
+	if err != nil {
+		return err
+	}
+	major, info := b[0]>>5, b[0]&0x1f
+	var n uint64
+	indefinite := info == 31 && major >= 2 && major <= 5
+	if info <= 27 {
+		if n, err = d.cborArg(info); err != nil {
+			return err
+		}
+	} else if !indefinite {
+		return fmt.Errorf("unsupported cbor initial byte 0x%%x", b[0])
+	}
+	switch major {
+	case 0:
+		d.out = strconv.AppendUint(d.out, n, 10)
+	case 1:
+		if n > math.MaxInt64 {
+			return fmt.Errorf("negative integer out of range")
+		}
+		d.out = strconv.AppendInt(d.out, -1-int64(n), 10)
+	case 2, 3:
+		if !indefinite {
+			s, err := d.take(n)
+			if err != nil {
+				return err
+			}
+			return d.str(s, major == 2)
+		}
+		// A sequence of definite length strings of the same type, until a break.
+		var s []byte
+		for len(d.buf) == 0 || d.buf[0] != 0xff {
+			h, err := d.take(1)
+			if err != nil {
+				return err
+			}
+			if h[0]>>5 != major || h[0]&0x1f > 27 {
+				return fmt.Errorf("bad chunk in indefinite length string")
+			}
+			n, err := d.cborArg(h[0] & 0x1f)
+			if err != nil {
+				return err
+			}
+			chunk, err := d.take(n)
+			if err != nil {
+				return err
+			}
+			s = append(s, chunk...)
+		}
+		d.buf = d.buf[1:]
+		return d.str(s, major == 2)
+	case 4, 5:
+		return d.items(n, major == 5, indefinite, (*codecDecoder).cbor)
+	case 6:
+		// The tag is ignored, the value is used.
+		if d.depth++; d.depth > 1000 {
+			return fmt.Errorf("values nested too deeply")
+		}
+		defer func() { d.depth-- }()
+		return d.cbor()
+	case 7:
+		switch info {
+		case 20:
+			d.out = append(d.out, "false"...)
+		case 21:
+			d.out = append(d.out, "true"...)
+		case 22, 23:
+			d.out = append(d.out, "null"...)
+		case 25:
+			return d.float(halfFloat(uint16(n)), 32)
+		case 26:
+			return d.float(float64(math.Float32frombits(uint32(n))), 32)
+		case 27:
+			return d.float(math.Float64frombits(n), 64)
+		default:
+			return fmt.Errorf("unsupported cbor simple value %%d", n)
+		}
+	}
+	return nil
+}
+
+// halfFloat returns the value of an IEEE 754 half-precision float.
+func halfFloat(h uint16) float64 {
+	exp := int(h>>10) & 0x1f
+	mant := float64(h & 0x3ff)
+	var f float64
+	switch exp {
+	case 0:
+		f = math.Ldexp(mant, -24)
+	case 31:
+		f = math.Inf(1)
+		if mant != 0 {
+			f = math.NaN()
+		}
+	default:
+		f = math.Ldexp(mant+1024, exp-25)
+	}
+	if h&0x8000 != 0 {
+		f = -f
+	}
+	return f
+}
+
+// msgpack converts a MessagePack value.
+func (d *codecDecoder) msgpack() error {
+	b, err := d.take(1)
+	if err != nil {
+		return err
+	}
+	t := b[0]
+	var kind byte // 's' for string, 'b' for binary, 'a' for array, 'm' for map.
+	var n uint64
+	switch {
+	case t <= 0x7f:
+		d.out = strconv.AppendUint(d.out, uint64(t), 10)
+		return nil
+	case t >= 0xe0:
+		d.out = strconv.AppendInt(d.out, int64(int8(t)), 10)
+		return nil
+	case t <= 0x8f:
+		kind, n = 'm', uint64(t&0x0f)
+	case t <= 0x9f:
+		kind, n = 'a', uint64(t&0x0f)
+	case t <= 0xbf:
+		kind, n = 's', uint64(t&0x1f)
+	case t == 0xc0:
+		d.out = append(d.out, "null"...)
+		return nil
+	case t == 0xc2:
+		d.out = append(d.out, "false"...)
+		return nil
+	case t == 0xc3:
+		d.out = append(d.out, "true"...)
+		return nil
+	case t >= 0xc4 && t <= 0xc6:
+		kind = 'b'
+		n, err = d.uint(1 << (t - 0xc4))
+	case t == 0xca:
+		n, err = d.uint(4)
+		if err != nil {
+			return err
+		}
+		return d.float(float64(math.Float32frombits(uint32(n))), 32)
+	case t == 0xcb:
+		n, err = d.uint(8)
+		if err != nil {
+			return err
+		}
+		return d.float(math.Float64frombits(n), 64)
+	case t >= 0xcc && t <= 0xcf:
+		n, err = d.uint(1 << (t - 0xcc))
+		d.out = strconv.AppendUint(d.out, n, 10)
+		return err
+	case t >= 0xd0 && t <= 0xd3:
+		size := 1 << (t - 0xd0)
+		n, err = d.uint(size)
+		// Sign extend.
+		shift := uint(64 - 8*size)
+		d.out = strconv.AppendInt(d.out, int64(n<<shift)>>shift, 10)
+		return err
+	case t >= 0xd9 && t <= 0xdb:
+		kind = 's'
+		n, err = d.uint(1 << (t - 0xd9))
+	case t == 0xdc || t == 0xdd:
+		kind = 'a'
+		n, err = d.uint(2 << (t - 0xdc))
+	case t == 0xde || t == 0xdf:
+		kind = 'm'
+		n, err = d.uint(2 << (t - 0xde))
+	default:
+		return fmt.Errorf("unsupported msgpack type 0x%%x", t)
+	}
+	if err != nil {
+		return err
+	}
+	if kind == 's' || kind == 'b' {
+		s, err := d.take(n)
+		if err != nil {
+			return err
+		}
+		return d.str(s, kind == 'b')
+	}
+	return d.items(n, kind == 'm', false, (*codecDecoder).msgpack)
+}
+
+`
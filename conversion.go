@@ -0,0 +1,103 @@
+package sherpago
+
+import (
+	"fmt"
+
+	"github.com/mjl-/sherpadoc"
+)
+
+// fieldConversion is how a struct field is encoded when its Go type is not that
+// of its sherpadoc type, due to an annotation, e.g. a time.Duration for an
+// integer with a "duration" annotation.
+type fieldConversion struct {
+	goType   string // Type of the field, e.g. "time.Duration".
+	jsonType string // Sherpadoc type of the value in JSON, e.g. "int64".
+
+	// Go type of the value in JSON if not that of jsonType, e.g. "json.Number"
+	// for jsonType "any".
+	valueType string
+
+	// If set, encoding/json encodes the Go type as the JSON type itself, e.g. with
+	// text methods. With FastJSON, it is encoded with encoding/json like "any".
+	native bool
+
+	encode    func(x string) string              // Go expression of the JSON value for field x.
+	decode    func(x, val string) string         // Go statements setting field x from JSON value val, returning errors.
+	literal   func(v interface{}) (string, bool) // Go expression for JSON value v, as for goLiteral.
+	sample    string                             // Go expression with an example value.
+	fake      string                             // Go expression with a pseudo-random value, using r, a *rand.Rand.
+	signature string                             // The annotation, e.g. "duration=ms", for comparing types of APIs.
+}
+
+// jsonGoType returns the Go type of the value in JSON.
+func (c *fieldConversion) jsonGoType() string {
+	if c.valueType != "" {
+		return c.valueType
+	}
+	return c.jsonType
+}
+
+// fieldConversion returns the conversion for field f of struct t, or nil if its
+// Go type is that of its sherpadoc type.
+func (g *generator) fieldConversion(t sherpadoc.Struct, f sherpadoc.Field) *fieldConversion {
+	what := fmt.Sprintf("field %s for type %s", f.Name, t.Name)
+	l := annotations(what, f.Docs, fieldAnnotations)
+	unit, isDuration := l["duration"]
+	format, isFormat := l["format"]
+	if !isDuration && !isFormat {
+		return nil
+	}
+	if isDuration && isFormat {
+		panic(genError{fmt.Errorf("sherpago annotations \"duration\" and \"format\" for %s conflict", what)})
+	}
+	if g.union(t.Name) != nil {
+		panic(genError{fmt.Errorf("sherpago annotations \"duration\" and \"format\" for %s cannot be used in a union", what)})
+	}
+	if isDuration {
+		return g.durationConversion(what, f, unit)
+	}
+	return g.formatConversion(what, f, format)
+}
+
+// conversionFields returns the fields of struct t with a conversion, by name.
+// If plain is set, only those that encoding/json does not encode itself.
+func (g *generator) conversionFields(t sherpadoc.Struct, plain bool) map[string]*fieldConversion {
+	r := map[string]*fieldConversion{}
+	for _, f := range t.Fields {
+		if c := g.fieldConversion(t, f); c != nil && !(plain && c.native) {
+			r[f.Name] = c
+		}
+	}
+	return r
+}
+
+// hasConversions returns whether a struct type of the API has a field with a
+// conversion, see conversionFields.
+func (g *generator) hasConversions(plain bool) bool {
+	for _, sec := range g.sections() {
+		for _, t := range sec.Structs {
+			if len(g.conversionFields(t, plain)) > 0 {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// fieldGoType returns the Go type of field f of struct t.
+func (g *generator) fieldGoType(t sherpadoc.Struct, f sherpadoc.Field) string {
+	if c := g.fieldConversion(t, f); c != nil {
+		return c.goType
+	}
+	return g.goTypewords(fmt.Sprintf("field %s for type %s", f.Name, t.Name), f.Typewords)
+}
+
+// fieldLiteral returns a Go expression for JSON value v for field f of struct
+// t, like goLiteral, with conversions.
+func (g *generator) fieldLiteral(t sherpadoc.Struct, f sherpadoc.Field, v interface{}) (string, bool) {
+	if c := g.fieldConversion(t, f); c != nil {
+		return c.literal(v)
+	}
+	what := fmt.Sprintf("field %s for type %s", f.Name, t.Name)
+	return g.goLiteral(parseType(what, f.Typewords), v)
+}
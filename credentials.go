@@ -0,0 +1,185 @@
+package sherpago
+
+// credentialCode is the Go code with the option for setting credentials on
+// requests from a provider. It is a format string with the names of the client
+// type, the option type, the CredentialProvider type, and the WithCredentials
+// function as parameters.
+const credentialCode = `// %[3]s returns the credentials for requests of a client, see %[4]s.
+type %[3]s interface {
+	// Credentials returns headers for a request, e.g. Authorization.
+	Credentials(ctx context.Context) (http.Header, error)
+}
+
+// %[4]s returns an option that makes the client set the headers from
+// provider on each request, after those of WithHeaders.
+func %[4]s(provider %[3]s) %[2]s {
+	return func(c *%[1]s) {
+		c.credentials = provider
+	}
+}
+
+`
+
+// credentialStoreCode is the Go code with the provider with credentials from a
+// file. It is a format string with the names of the CredentialProvider type,
+// the Credentials type, the CredentialFile, DefaultCredentialFile and
+// WriteCredentialFile functions, and the package name as parameters.
+const credentialStoreCode = `// %[2]s are credentials for the API, as stored by %[5]s and read by
+// %[3]s.
+type %[2]s struct {
+	Token    string ` + "`json:\"token,omitempty\"`" + `    // Sent as bearer token.
+	Username string ` + "`json:\"username,omitempty\"`" + ` // Sent with Password with basic authentication, if there is no token.
+	Password string ` + "`json:\"password,omitempty\"`" + `
+}
+
+// Header returns the Authorization header for the credentials, or nil if
+// there are none.
+func (cr %[2]s) Header() http.Header {
+	switch {
+	case cr.Token != "":
+		return http.Header{"Authorization": {"Bearer " + cr.Token}}
+	case cr.Username != "":
+		auth := base64.StdEncoding.EncodeToString([]byte(cr.Username + ":" + cr.Password))
+		return http.Header{"Authorization": {"Basic " + auth}}
+	}
+	return nil
+}
+
+// %[3]s returns a provider with the credentials in the file at path, a JSON
+// object with the fields of %[2]s, e.g. from %[4]s. The file is read
+// again after it has changed.
+func %[3]s(path string) %[1]s {
+	return &fileProvider{path: path}
+}
+
+type fileProvider struct {
+	path string
+
+	sync.Mutex
+	modTime time.Time
+	size    int64
+	header  http.Header // Not nil once read.
+}
+
+func (f *fileProvider) Credentials(ctx context.Context) (http.Header, error) {
+	fi, err := os.Stat(f.path)
+	if err != nil {
+		return nil, err
+	}
+	f.Lock()
+	defer f.Unlock()
+	if f.header == nil || !fi.ModTime().Equal(f.modTime) || fi.Size() != f.size {
+		buf, err := os.ReadFile(f.path)
+		if err != nil {
+			return nil, err
+		}
+		var cr %[2]s
+		if err := json.Unmarshal(buf, &cr); err != nil {
+			return nil, fmt.Errorf("parsing credentials in %%s: %%w", f.path, err)
+		}
+		f.header = cr.Header()
+		if f.header == nil {
+			f.header = http.Header{}
+		}
+		f.modTime = fi.ModTime()
+		f.size = fi.Size()
+	}
+	return f.header, nil
+}
+
+// %[4]s returns the path of the credential file in the configuration
+// directory of the user, e.g. ~/.config/%[6]s/credentials.json, see
+// os.UserConfigDir.
+func %[4]s() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "%[6]s", "credentials.json"), nil
+}
+
+// %[5]s writes cr to the file at path, only readable by the user,
+// creating its directory if needed.
+func %[5]s(path string, cr %[2]s) error {
+	buf, err := json.MarshalIndent(cr, "", "\t")
+	if err != nil {
+		return err
+	}
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+	// Written to a new temporary file in the same directory first, so readers never
+	// see a partial file, and concurrent writers do not write the same file. The
+	// file is created only readable by the user.
+	f, err := os.CreateTemp(dir, filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.Write(append(buf, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
+
+`
+
+// keyringCode is the Go code with the provider with credentials from the
+// keyring of the OS, see Options.Keyring. It is a format string with the names
+// of the CredentialProvider type, the Credentials type and the
+// KeyringCredentials function as parameters.
+const keyringCode = `// %[3]s returns a provider with the credentials stored in the keyring of
+// the OS for service and account, read once with the command "security" on
+// macOS, and "secret-tool" of libsecret on other systems. The secret is a JSON
+// object with the fields of %[2]s, or a token. It can be stored with:
+//
+//	security add-generic-password -s service -a account -w secret
+//	secret-tool store --label=label service service account account
+func %[3]s(service, account string) %[1]s {
+	return &keyringProvider{service: service, account: account}
+}
+
+type keyringProvider struct {
+	service, account string
+
+	sync.Mutex
+	header http.Header // Not nil once read.
+}
+
+func (k *keyringProvider) Credentials(ctx context.Context) (http.Header, error) {
+	k.Lock()
+	defer k.Unlock()
+	if k.header != nil {
+		return k.header, nil
+	}
+	var cmd *exec.Cmd
+	if runtime.GOOS == "darwin" {
+		cmd = exec.CommandContext(ctx, "security", "find-generic-password", "-s", k.service, "-a", k.account, "-w")
+	} else {
+		cmd = exec.CommandContext(ctx, "secret-tool", "lookup", "service", k.service, "account", k.account)
+	}
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("reading credentials from keyring: %%w", err)
+	}
+	secret := strings.TrimSpace(string(out))
+	cr := %[2]s{Token: secret}
+	if strings.HasPrefix(secret, "{") {
+		cr = %[2]s{}
+		if err := json.Unmarshal([]byte(secret), &cr); err != nil {
+			return nil, fmt.Errorf("parsing credentials from keyring: %%w", err)
+		}
+	}
+	k.header = cr.Header()
+	if k.header == nil {
+		k.header = http.Header{}
+	}
+	return k.header, nil
+}
+
+`
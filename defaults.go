@@ -0,0 +1,73 @@
+package sherpago
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/mjl-/sherpadoc"
+)
+
+// fieldDefaults returns Go statements setting the fields of struct t in
+// variable v to the values of their "default" annotations, or the empty string
+// if no field has a default.
+func (g *generator) fieldDefaults(t sherpadoc.Struct) string {
+	// The fields of unions are not in the Go type.
+	if g.union(t.Name) != nil {
+		return ""
+	}
+	var code string
+	for _, f := range t.Fields {
+		what := fmt.Sprintf("field %s for type %s", f.Name, t.Name)
+		s, ok := annotations(what, f.Docs, fieldAnnotations)["default"]
+		if !ok {
+			continue
+		}
+		dec := json.NewDecoder(strings.NewReader(s))
+		dec.UseNumber()
+		var v interface{}
+		err := dec.Decode(&v)
+		var lit string
+		if err == nil && !dec.More() {
+			lit, ok = g.fieldLiteral(t, f, v)
+		}
+		if err != nil || dec.More() || !ok {
+			panic(genError{fmt.Errorf("bad default %q in sherpago annotation for %s, must be a JSON value of its type", s, what)})
+		}
+		code += fmt.Sprintf("\tv.%s = %s\n", g.fieldName(f.Name), lit)
+	}
+	return code
+}
+
+// generateDefaults writes a SetDefaults method and a function returning a new
+// value with defaults for struct t if its fields have "default" annotations.
+func (g *generator) generateDefaults(t sherpadoc.Struct) {
+	code := g.fieldDefaults(t)
+	if code == "" {
+		return
+	}
+	typeName := g.typeName(t.Name)
+	g.printf(`// SetDefaults sets the fields of v that have a documented default to their
+// default value.
+func (v *%[1]s) SetDefaults() {
+%[2]s}
+
+// %[3]s returns a %[1]s with the fields that have a documented default set to
+// their default value.
+func %[3]s() %[1]s {
+	var v %[1]s
+	v.SetDefaults()
+	return v
+}
+
+`, typeName, code, g.defaultsFuncName(t.Name))
+}
+
+// defaultsFuncName returns the name of the function returning a new value of
+// struct type name with defaults.
+func (g *generator) defaultsFuncName(name string) string {
+	if g.opts.Unexported {
+		return "new" + g.exportedTypeName(name)
+	}
+	return "New" + g.exportedTypeName(name)
+}
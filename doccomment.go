@@ -0,0 +1,199 @@
+package sherpago
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+var (
+	markdownHeading  = regexp.MustCompile(`^#{1,6}[ \t]+(.*?)[ \t#]*$`)
+	markdownListItem = regexp.MustCompile(`^[ ]{0,3}([-*+]|[0-9]{1,9}[.)])[ \t]+(.*)$`)
+
+	// E.g. "Deprecated: ...", "**Deprecated:** ..." or "deprecated: ...".
+	markdownDeprecated = regexp.MustCompile(`(?i)^(?:\*\*|__)?deprecated(?::(?:\*\*|__)?|(?:\*\*|__)?:)[ \t]*(.*)$`)
+)
+
+// goDocLines returns the lines of an idiomatic Go doc comment for docs from the
+// sherpadoc, which are often markdown, without the comment markers. Headings,
+// lists and fenced or indented code blocks are turned into their Go doc comment
+// form, with blocks separated by empty lines. If width is > 0, paragraphs and
+// list items are wrapped at width characters.
+func goDocLines(docs string, width int) []string {
+	lines := docLines(sanitizeDoc(docs))
+
+	var r []string
+	block := func(l []string) {
+		if len(r) > 0 {
+			r = append(r, "")
+		}
+		r = append(r, l...)
+	}
+	blank := func(s string) bool {
+		return strings.TrimSpace(s) == ""
+	}
+	indented := func(s string) bool {
+		return strings.HasPrefix(s, "\t") || strings.HasPrefix(s, " ")
+	}
+	fence := func(s string) string {
+		s = strings.TrimSpace(s)
+		if strings.HasPrefix(s, "```") {
+			return "```"
+		} else if strings.HasPrefix(s, "~~~") {
+			return "~~~"
+		}
+		return ""
+	}
+	plain := func(s string) bool {
+		return !blank(s) && !indented(s) && fence(s) == "" && !markdownHeading.MatchString(s) && !markdownListItem.MatchString(s)
+	}
+
+	for i := 0; i < len(lines); {
+		line := lines[i]
+		switch {
+		case blank(line):
+			i++
+
+		case fence(line) != "":
+			f := fence(line)
+			var code []string
+			for i++; i < len(lines) && !strings.HasPrefix(strings.TrimSpace(lines[i]), f); i++ {
+				code = append(code, lines[i])
+			}
+			i++ // Closing fence.
+			if c := codeBlock(code); len(c) > 0 {
+				block(c)
+			}
+
+		case markdownHeading.MatchString(line):
+			block([]string{"# " + markdownHeading.FindStringSubmatch(line)[1]})
+			i++
+
+		case markdownListItem.MatchString(line):
+			var items []string
+			for i < len(lines) && markdownListItem.MatchString(lines[i]) {
+				m := markdownListItem.FindStringSubmatch(lines[i])
+				marker := "  -"
+				if m[1][0] >= '0' && m[1][0] <= '9' {
+					marker = " " + m[1][:len(m[1])-1] + "."
+				}
+				words := strings.Fields(m[2])
+				// Continuation lines of the item, possibly lazy without indent.
+				for i++; i < len(lines) && !blank(lines[i]) && !markdownListItem.MatchString(lines[i]) && fence(lines[i]) == ""; i++ {
+					words = append(words, strings.Fields(lines[i])...)
+				}
+				items = append(items, wrapWords(words, marker+" ", "    ", width)...)
+			}
+			block(items)
+
+		case indented(line):
+			var code []string
+			for ; i < len(lines) && (indented(lines[i]) || blank(lines[i])); i++ {
+				code = append(code, lines[i])
+			}
+			block(codeBlock(code))
+
+		default:
+			// A deprecation notice starts its own paragraph, in the form Go tools
+			// recognize.
+			var para []string
+			for ; i < len(lines) && plain(lines[i]) && (len(para) == 0 || !markdownDeprecated.MatchString(lines[i])); i++ {
+				line := strings.TrimSpace(lines[i])
+				if m := markdownDeprecated.FindStringSubmatch(line); m != nil {
+					line = "Deprecated: " + m[1]
+				}
+				para = append(para, line)
+			}
+			if width > 0 {
+				para = wrapWords(strings.Fields(strings.Join(para, " ")), "", "", width)
+			}
+			block(para)
+		}
+	}
+	return r
+}
+
+// isDeprecated returns whether docs have a line starting with "Deprecated:",
+// possibly in bold.
+func isDeprecated(docs string) bool {
+	for _, line := range docLines(sanitizeDoc(docs)) {
+		if markdownDeprecated.MatchString(line) {
+			return true
+		}
+	}
+	return false
+}
+
+// sanitizeDoc returns docs with line endings turned into newlines, and without
+// characters that are invalid in Go source files: invalid UTF-8 is replaced,
+// other control characters than tab and newline, and byte order marks are
+// removed. Docs are always written as line comments with a space or tab after
+// the "//", so they cannot end the comment like "*/" would, or become a
+// directive like "//go:generate".
+func sanitizeDoc(docs string) string {
+	docs = strings.NewReplacer("\r\n", "\n", "\r", "\n", "\u2028", "\n", "\u2029", "\n").Replace(docs)
+	// Map replaces invalid UTF-8 with the replacement character.
+	return strings.Map(func(r rune) rune {
+		if r == '\uFEFF' || r != '\t' && r != '\n' && unicode.IsControl(r) {
+			return -1
+		}
+		return r
+	}, docs)
+}
+
+// codeBlock returns lines as Go doc comment code block, indented with a tab
+// instead of their common indent. Leading and trailing empty lines are removed.
+func codeBlock(lines []string) []string {
+	for len(lines) > 0 && strings.TrimSpace(lines[0]) == "" {
+		lines = lines[1:]
+	}
+	for len(lines) > 0 && strings.TrimSpace(lines[len(lines)-1]) == "" {
+		lines = lines[:len(lines)-1]
+	}
+	prefix := ""
+	first := true
+	for _, line := range lines {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		indent := line[:len(line)-len(strings.TrimLeft(line, " \t"))]
+		if first {
+			prefix = indent
+			first = false
+		}
+		for !strings.HasPrefix(indent, prefix) {
+			prefix = prefix[:len(prefix)-1]
+		}
+	}
+	r := make([]string, len(lines))
+	for i, line := range lines {
+		if strings.TrimSpace(line) == "" {
+			r[i] = ""
+		} else {
+			r[i] = "\t" + strings.TrimRight(strings.TrimPrefix(line, prefix), " \t")
+		}
+	}
+	return r
+}
+
+// wrapWords returns words as lines, the first starting with first and the others
+// with next. If width is > 0, lines are wrapped so they are at most width
+// characters, unless a single word is longer.
+func wrapWords(words []string, first, next string, width int) []string {
+	var lines []string
+	line := first
+	n := 0
+	for _, w := range words {
+		if n > 0 && width > 0 && len(line)+1+len(w) > width {
+			lines = append(lines, line)
+			line = next
+			n = 0
+		}
+		if n > 0 {
+			line += " "
+		}
+		line += w
+		n++
+	}
+	return append(lines, line)
+}
@@ -0,0 +1,106 @@
+package sherpago
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/mjl-/sherpadoc"
+)
+
+// sanitizeDocs are docs that could break generated Go files if written as is.
+var sanitizeDocs = []string{
+	"",
+	"ends comment */ here",
+	"/* starts comment",
+	"line\nbreaks\r\nof\rall kinds here",
+	"\n//go:generate rm -rf /",
+	"\r//go:build ignore",
+	"\n//line other.go:1",
+	"backticks ` and ``` in text",
+	"```\ncode */ with `backticks`\n```",
+	"```go\n//go:generate true\n```",
+	"\tindented\n\t//go:noinline",
+	"# Heading */\n\n- item `x` */\n- ```",
+	"nul \x00, escape \x1b[31m, bom \uFEFF, invalid \xff\xfe",
+	"\"quotes\" and \\ backslashes \\\"",
+}
+
+func FuzzSanitizeDoc(f *testing.F) {
+	for _, docs := range sanitizeDocs {
+		f.Add(docs)
+	}
+	f.Fuzz(checkSanitizeDoc)
+}
+
+// checkSanitizeDoc checks that docs are sanitized, and that clients generated
+// with docs in all places are valid Go, without other comments than for
+// empty docs.
+func checkSanitizeDoc(t *testing.T, docs string) {
+	s := sanitizeDoc(docs)
+	if !utf8.ValidString(s) {
+		t.Fatalf("sanitized docs %q are not valid UTF-8", s)
+	}
+	for _, r := range s {
+		if r == '\r' || r == '\uFEFF' || r != '\t' && r != '\n' && unicode.IsControl(r) {
+			t.Fatalf("sanitized docs %q have character %U", s, r)
+		}
+	}
+
+	exp := sanitizeComments(t, "")
+	if got := sanitizeComments(t, docs); got != exp {
+		t.Fatalf("generated files for docs %q have %s, expected %s", docs, got, exp)
+	}
+}
+
+// sanitizeComments generates all files for a client with docs for the API, a
+// section, a function, its parameters, a struct, a field, and enums, and
+// returns the numbers of lines starting a block comment or a directive. The
+// files are parsed by GenerateFiles.
+func sanitizeComments(t *testing.T, docs string) string {
+	field := sherpadoc.Field{Name: "f", Docs: docs, Typewords: []string{"string"}}
+	doc := sherpadoc.Section{
+		Name: "Test",
+		Docs: docs,
+		Functions: []*sherpadoc.Function{
+			{Name: "fn", Docs: docs, Params: []sherpadoc.Arg{{Name: "p", Typewords: []string{"S"}}}, Returns: []sherpadoc.Arg{{Name: "r", Typewords: []string{"E"}}}},
+		},
+		Sections: []*sherpadoc.Section{{Name: "Sub", Docs: docs}},
+		Structs:  []sherpadoc.Struct{{Name: "S", Docs: docs, Fields: []sherpadoc.Field{field}}},
+		Ints: []sherpadoc.Ints{{Name: "E", Docs: docs, Values: []struct {
+			Name  string
+			Value int
+			Docs  string
+		}{{"One", 1, docs}}}},
+		Strings:          []sherpadoc.Strings{},
+		SherpadocVersion: sherpadoc.SherpadocVersion,
+	}
+	buf, err := json.Marshal(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts := Options{PackageName: "example", BaseURL: "http://localhost/example/", Benchmarks: true, Fakes: true, CLIImportPath: "example.org/example"}
+	files, err := GenerateFiles(bytes.NewReader(buf), opts)
+	if err != nil {
+		t.Fatalf("generating files for docs %q: %v", docs, err)
+	}
+	var blocks, directives int
+	for name, buf := range files {
+		if !strings.HasSuffix(name, ".go") {
+			continue
+		}
+		for _, line := range strings.Split(string(buf), "\n") {
+			line = strings.TrimSpace(line)
+			if strings.HasPrefix(line, "/*") {
+				blocks++
+			} else if strings.HasPrefix(line, "//go:") || strings.HasPrefix(line, "//line ") {
+				directives++
+			}
+		}
+	}
+	return fmt.Sprintf("%d block comments and %d directives", blocks, directives)
+}
@@ -0,0 +1,284 @@
+package sherpago
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mjl-/sherpadoc"
+)
+
+// exampleDocLines returns the doc comment lines for fn, with the example from
+// the documentation turned into a call of the client method. A paragraph
+// "Example:" followed by a code block with the JSON parameters of the function,
+// as sent in a request, is an example. If the parameters do not match, the code
+// block is kept as is.
+func (g *generator) exampleDocLines(fn *sherpadoc.Function, lines []string) []string {
+	for i := 0; i+2 < len(lines); i++ {
+		if !strings.EqualFold(lines[i], "Example:") || lines[i+1] != "" || !strings.HasPrefix(lines[i+2], "\t") {
+			continue
+		}
+		end := i + 2
+		for end < len(lines) && (strings.HasPrefix(lines[end], "\t") || lines[end] == "" && end+1 < len(lines) && strings.HasPrefix(lines[end+1], "\t")) {
+			end++
+		}
+		call, ok := g.exampleCall(fn, strings.Join(lines[i+2:end], "\n"))
+		if !ok {
+			continue
+		}
+		r := append([]string{}, lines[:i+2]...)
+		r = append(r, "\t"+call)
+		return append(r, lines[end:]...)
+	}
+	return lines
+}
+
+// exampleCall returns a Go statement calling the client method for fn with the
+// JSON parameters in s.
+func (g *generator) exampleCall(fn *sherpadoc.Function, s string) (string, bool) {
+	dec := json.NewDecoder(strings.NewReader(s))
+	dec.UseNumber()
+	var params []interface{}
+	if err := dec.Decode(&params); err != nil || dec.More() || len(params) != len(fn.Params) {
+		return "", false
+	}
+	args := []string{"ctx"}
+	for i, p := range fn.Params {
+		arg, ok := g.goLiteral(parseType("parameter for "+fn.Name, p.Typewords), params[i])
+		if !ok {
+			return "", false
+		}
+		args = append(args, arg)
+	}
+	var results []string
+	for i := range fn.Returns {
+		results = append(results, fmt.Sprintf("r%d", i))
+	}
+	results = append(results, "err")
+	return fmt.Sprintf("%s := c.%s(%s)", strings.Join(results, ", "), g.goName(fn.Name), strings.Join(args, ", ")), true
+}
+
+// goLiteral returns a Go expression for JSON value v, as decoded with
+// json.Decoder.UseNumber, of type t. It returns false if v is not a valid value
+// for t.
+func (g *generator) goLiteral(t Type, v interface{}) (string, bool) {
+	switch t := t.(type) {
+	case BaseType:
+		return g.goBaseLiteral(t, v)
+	case NullableType:
+		if v == nil {
+			return "nil", true
+		}
+		s, ok := g.goLiteral(t.Type, v)
+		if !ok || g.nilIsNull(t) {
+			return s, ok
+		}
+		switch tt := t.Type.(type) {
+		case ArrayType, ObjectType:
+			return "&" + s, true
+		case IdentType:
+			if _, isStruct := g.structs[tt.Name]; isStruct {
+				return "&" + s, true
+			}
+		}
+		return fmt.Sprintf("func() %s { var v %s = %s; return &v }()", g.goType(t), g.goType(t.Type), s), true
+	case ArrayType:
+		l, ok := v.([]interface{})
+		if !ok {
+			return "", false
+		}
+		var elems []string
+		for _, e := range l {
+			s, ok := g.goLiteral(t.Type, e)
+			if !ok {
+				return "", false
+			}
+			elems = append(elems, s)
+		}
+		return fmt.Sprintf("%s{%s}", g.goType(t), strings.Join(elems, ", ")), true
+	case ObjectType:
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return "", false
+		}
+		var elems []string
+		for _, k := range sortedKeys(m) {
+			s, ok := g.goLiteral(t.Value, m[k])
+			if !ok {
+				return "", false
+			}
+			elems = append(elems, fmt.Sprintf("%s: %s", strconv.Quote(k), s))
+		}
+		return fmt.Sprintf("%s{%s}", g.goType(t), strings.Join(elems, ", ")), true
+	case IdentType:
+		if st, ok := g.structs[t.Name]; ok {
+			m, ok := v.(map[string]interface{})
+			if !ok {
+				return "", false
+			}
+			if u := g.union(t.Name); u != nil {
+				for _, uv := range u.variants {
+					if m[u.field] == uv.kind {
+						s, ok := g.goLiteral(IdentType{Name: uv.typ}, v)
+						return fmt.Sprintf("%s{Value: %s}", g.goType(t), s), ok
+					}
+				}
+				return "", false
+			}
+			var fields []string
+			embedded := g.embeddedFields(st)
+			for _, name := range g.embeds(st) {
+				em := map[string]interface{}{}
+				for k, ev := range m {
+					if embedded[k] == name {
+						em[k] = ev
+					}
+				}
+				s, ok := g.goLiteral(IdentType{Name: name}, em)
+				if !ok {
+					return "", false
+				}
+				fields = append(fields, fmt.Sprintf("%s: %s", g.typeName(name), s))
+			}
+			n := 0
+			for _, f := range st.Fields {
+				fv, ok := m[f.Name]
+				if !ok {
+					continue
+				}
+				n++
+				if embedded[f.Name] != "" {
+					continue
+				}
+				s, ok := g.fieldLiteral(st, f, fv)
+				if !ok {
+					return "", false
+				}
+				fields = append(fields, fmt.Sprintf("%s: %s", g.fieldName(f.Name), s))
+			}
+			if n != len(m) {
+				return "", false
+			}
+			return fmt.Sprintf("%s{%s}", g.goType(t), strings.Join(fields, ", ")), true
+		}
+		if it, ok := g.ints[t.Name]; ok {
+			num, ok := v.(json.Number)
+			if !ok {
+				return "", false
+			}
+			x, err := strconv.ParseInt(string(num), 10, 64)
+			if err != nil {
+				return "", false
+			}
+			for _, ev := range it.Values {
+				if int64(ev.Value) == x {
+					return g.typeName(ev.Name), true
+				}
+			}
+			return fmt.Sprintf("%s(%d)", g.goType(t), x), true
+		}
+		if st, ok := g.strs[t.Name]; ok {
+			s, ok := v.(string)
+			if !ok {
+				return "", false
+			}
+			for _, ev := range st.Values {
+				if ev.Value == s {
+					return g.typeName(ev.Name), true
+				}
+			}
+			return fmt.Sprintf("%s(%s)", g.goType(t), strconv.Quote(s)), true
+		}
+	}
+	return "", false
+}
+
+// goBaseLiteral returns a Go expression for JSON value v of base type t, as
+// goLiteral.
+func (g *generator) goBaseLiteral(t BaseType, v interface{}) (string, bool) {
+	switch t.Name {
+	case "any":
+		return goAnyLiteral(v), true
+	case "bool":
+		b, ok := v.(bool)
+		return strconv.FormatBool(b), ok
+	case "string":
+		s, ok := v.(string)
+		return strconv.Quote(s), ok
+	case "timestamp":
+		s, ok := v.(string)
+		if !ok {
+			return "", false
+		}
+		tm, err := time.Parse(time.RFC3339Nano, s)
+		if err != nil {
+			return "", false
+		}
+		tm = tm.UTC()
+		return fmt.Sprintf("time.Date(%d, %d, %d, %d, %d, %d, %d, time.UTC)", tm.Year(), tm.Month(), tm.Day(), tm.Hour(), tm.Minute(), tm.Second(), tm.Nanosecond()), true
+	}
+
+	var num string
+	switch x := v.(type) {
+	case json.Number:
+		num = string(x)
+	case string:
+		// Encoded as string in JSON.
+		if t.Name != "int64s" && t.Name != "uint64s" {
+			return "", false
+		}
+		num = x
+	default:
+		return "", false
+	}
+	var err error
+	switch t.Name {
+	case "float32", "float64":
+		_, err = strconv.ParseFloat(num, 64)
+	case "uint8", "uint16", "uint32", "uint64", "uint64s":
+		_, err = strconv.ParseUint(num, 10, 64)
+	default:
+		_, err = strconv.ParseInt(num, 10, 64)
+	}
+	return num, err == nil
+}
+
+// goAnyLiteral returns a Go expression of type interface{} for JSON value v.
+func goAnyLiteral(v interface{}) string {
+	switch x := v.(type) {
+	case nil:
+		return "nil"
+	case bool:
+		return strconv.FormatBool(x)
+	case json.Number:
+		return "float64(" + string(x) + ")"
+	case string:
+		return strconv.Quote(x)
+	case []interface{}:
+		var elems []string
+		for _, e := range x {
+			elems = append(elems, goAnyLiteral(e))
+		}
+		return "[]interface{}{" + strings.Join(elems, ", ") + "}"
+	case map[string]interface{}:
+		var elems []string
+		for _, k := range sortedKeys(x) {
+			elems = append(elems, fmt.Sprintf("%s: %s", strconv.Quote(k), goAnyLiteral(x[k])))
+		}
+		return "map[string]interface{}{" + strings.Join(elems, ", ") + "}"
+	}
+	panic(genError{fmt.Errorf("unexpected json value %v", v)})
+}
+
+// sortedKeys returns the keys of m, sorted.
+func sortedKeys(m map[string]interface{}) []string {
+	var keys []string
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,167 @@
+package sherpago
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/mjl-/sherpadoc"
+)
+
+// driftCode is the Go code for checking results for schema drift, see
+// Options.SchemaDrift. It is a format string with the names of the client type,
+// the option type, the SchemaDrift type and the WithSchemaDrift function as
+// parameters.
+const driftCode = `// %[3]s is a difference between a result from the server and the API
+// documentation the client was generated from, see %[4]s.
+type %[3]s struct {
+	Function string // Name of the function, as in the API.
+	Path     string // Of the value in the results, e.g. "user.friends[0].email".
+	Problem  string // "unknown field" or "null for non-nullable type".
+}
+
+// %[4]s returns an option that checks results against the types in the API
+// documentation, calling hook with the differences, e.g. fields added on the
+// server after the client was generated, or null for types that are not
+// nullable. Calls do not fail, results are decoded as without the option:
+// unknown fields are ignored and null becomes the zero value. For monitoring
+// drift between client and server. Results are decoded a second time for the
+// check.
+func %[4]s(hook func(ctx context.Context, drift []%[3]s)) %[2]s {
+	return func(c *%[1]s) {
+		c.drift = func(ctx context.Context, info callInfo, raw json.RawMessage) {
+			if drift := checkDrift(info, raw); len(drift) > 0 {
+				hook(ctx, drift)
+			}
+		}
+	}
+}
+
+// checkDrift returns the differences between results raw and their types in
+// info, in order of the results and object keys.
+func checkDrift(info callInfo, raw json.RawMessage) []%[3]s {
+	var v interface{}
+	if err := json.Unmarshal(raw, &v); err != nil {
+		return nil
+	}
+	values := []interface{}{v}
+	if len(info.results) > 1 {
+		// Decoding would have failed for other values.
+		values, _ = v.([]interface{})
+		if len(values) != len(info.results) {
+			return nil
+		}
+	}
+
+	var drift []%[3]s
+	keys := func(m map[string]interface{}) []string {
+		l := make([]string, 0, len(m))
+		for k := range m {
+			l = append(l, k)
+		}
+		sort.Strings(l)
+		return l
+	}
+	var check func(path string, typewords []string, v interface{})
+	check = func(path string, typewords []string, v interface{}) {
+		if len(typewords) == 0 {
+			return
+		}
+		w, rest := typewords[0], typewords[1:]
+		if w == "nullable" {
+			if v != nil {
+				check(path, rest, v)
+			}
+			return
+		}
+		if v == nil {
+			if w != "any" {
+				drift = append(drift, %[3]s{info.name, path, "null for non-nullable type"})
+			}
+			return
+		}
+		switch w {
+		case "[]":
+			l, _ := v.([]interface{})
+			for i, e := range l {
+				check(fmt.Sprintf("%%s[%%d]", path, i), rest, e)
+			}
+		case "{}":
+			m, _ := v.(map[string]interface{})
+			for _, k := range keys(m) {
+				check(fmt.Sprintf("%%s[%%q]", path, k), rest, m[k])
+			}
+		default:
+			// Other types, e.g. enums and unions, are not checked.
+			fields, ok := info.structs[w]
+			m, _ := v.(map[string]interface{})
+			if !ok {
+				return
+			}
+			for _, k := range keys(m) {
+				if typewords, ok := fields[k]; ok {
+					check(path+"."+k, typewords, m[k])
+				} else {
+					drift = append(drift, %[3]s{info.name, path + "." + k, "unknown field"})
+				}
+			}
+		}
+	}
+	for i, r := range info.results {
+		check(r.name, r.typewords, values[i])
+	}
+	return drift
+}
+
+`
+
+// driftStructsVar returns the name of the variable with the struct types of the
+// API, for checking for schema drift.
+func (g *generator) driftStructsVar() string {
+	return unexportedName(g.clientName()) + "Structs"
+}
+
+// driftCallInfo returns the fields for the callInfo of fn with the types of its
+// results, for checking for schema drift, see Options.SchemaDrift.
+func (g *generator) driftCallInfo(fn *sherpadoc.Function) string {
+	if !g.opts.SchemaDrift || len(fn.Returns) == 0 {
+		return ""
+	}
+	var l []string
+	for i, r := range fn.Returns {
+		name := r.Name
+		if name == "" {
+			name = fmt.Sprintf("result%d", i)
+		}
+		l = append(l, fmt.Sprintf("{%q, %s}", name, typewordsLiteral(r.Typewords)))
+	}
+	return fmt.Sprintf(", results: []schemaValue{%s}, structs: %s", strings.Join(l, ", "), g.driftStructsVar())
+}
+
+// typewordsLiteral returns a Go string slice literal for typewords.
+func typewordsLiteral(typewords []string) string {
+	var words []string
+	for _, w := range typewords {
+		words = append(words, fmt.Sprintf("%q", w))
+	}
+	return "[]string{" + strings.Join(words, ", ") + "}"
+}
+
+// generateDriftStructs writes the variable with the fields of the struct types
+// of the API, by their names in the sherpadoc. Unions are left out, their
+// values are not checked.
+func (g *generator) generateDriftStructs() {
+	g.printf("var %s = map[string]map[string][]string{\n", g.driftStructsVar())
+	for _, sec := range g.sections() {
+		for _, t := range sec.Structs {
+			if g.union(t.Name) != nil {
+				continue
+			}
+			var fields []string
+			for _, f := range t.Fields {
+				fields = append(fields, fmt.Sprintf("%q: %s", f.Name, typewordsLiteral(f.Typewords)))
+			}
+			g.printf("\t%q: {%s},\n", t.Name, strings.Join(fields, ", "))
+		}
+	}
+	g.printf("}\n\n")
+}
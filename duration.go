@@ -0,0 +1,69 @@
+package sherpago
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/mjl-/sherpadoc"
+)
+
+// Units for the "duration" annotation of struct fields.
+var durationUnits = map[string]struct {
+	d    time.Duration
+	code string
+}{
+	"ns": {time.Nanosecond, "time.Nanosecond"},
+	"us": {time.Microsecond, "time.Microsecond"},
+	"ms": {time.Millisecond, "time.Millisecond"},
+	"s":  {time.Second, "time.Second"},
+	"m":  {time.Minute, "time.Minute"},
+	"h":  {time.Hour, "time.Hour"},
+}
+
+// durationConversion returns the conversion for field f with a "duration"
+// annotation with unit, e.g. "ms", to a time.Duration. The field must be a
+// non-nullable integer.
+func (g *generator) durationConversion(what string, f sherpadoc.Field, unit string) *fieldConversion {
+	u, ok := durationUnits[unit]
+	if !ok {
+		panic(genError{fmt.Errorf("bad unit %q in sherpago annotation \"duration\" for %s, must be ns, us, ms, s, m or h", unit, what)})
+	}
+	var w string
+	if len(f.Typewords) == 1 {
+		w = f.Typewords[0]
+	}
+	switch w {
+	case "int8", "uint8", "int16", "uint16", "int32", "uint32", "int64", "uint64":
+	default:
+		panic(genError{fmt.Errorf("sherpago annotation \"duration\" for %s requires a non-nullable integer type", what)})
+	}
+	return &fieldConversion{
+		goType:   "time.Duration",
+		jsonType: w,
+		encode: func(x string) string {
+			return fmt.Sprintf("%s(%s / %s)", w, x, u.code)
+		},
+		decode: func(x, val string) string {
+			return fmt.Sprintf("%s = time.Duration(%s) * %s\n", x, val, u.code)
+		},
+		literal: func(v interface{}) (string, bool) {
+			num, ok := v.(json.Number)
+			if !ok {
+				return "", false
+			}
+			n, err := strconv.ParseInt(string(num), 10, 64)
+			if err != nil {
+				return "", false
+			}
+			if n == 0 {
+				return "0", true
+			}
+			return durationCode(time.Duration(n) * u.d), true
+		},
+		sample:    "time.Second",
+		fake:      fmt.Sprintf("time.Duration(%s) * %s", g.goFake(BaseType{w}), u.code),
+		signature: "duration=" + unit,
+	}
+}
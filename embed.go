@@ -0,0 +1,102 @@
+package sherpago
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/mjl-/sherpadoc"
+)
+
+// embeds returns the struct types that struct t embeds, with its "embeds"
+// annotation. The fields of these types, which t must also have in the
+// sherpadoc, are not generated for t again.
+func (g *generator) embeds(t sherpadoc.Struct) []string {
+	s, ok := g.typeAnnotations(t.Name)["embeds"]
+	if !ok {
+		return nil
+	}
+	what := "type " + t.Name
+	if g.union(t.Name) != nil {
+		panic(genError{fmt.Errorf("sherpago annotation \"embeds\" for %s cannot be used for a union", what)})
+	}
+	fields := map[string]sherpadoc.Field{}
+	for _, f := range t.Fields {
+		fields[f.Name] = f
+	}
+	owners := map[string]string{}
+	var l []string
+	for _, name := range strings.Split(s, ",") {
+		et, ok := g.structs[name]
+		if !ok || name == t.Name || g.union(name) != nil {
+			panic(genError{fmt.Errorf("embedded type %q in sherpago annotation for %s is not another struct type", name, what)})
+		}
+		if g.embedsType(name, t.Name) {
+			panic(genError{fmt.Errorf("embedded type %q in sherpago annotation for %s embeds %s itself", name, what, t.Name)})
+		}
+		if g.fieldNameConflict(t, g.typeName(name)) {
+			panic(genError{fmt.Errorf("embedded type %q in sherpago annotation for %s conflicts with a field", name, what)})
+		}
+		for _, ef := range et.Fields {
+			f, ok := fields[ef.Name]
+			if !ok || strings.Join(f.Typewords, " ") != strings.Join(ef.Typewords, " ") {
+				panic(genError{fmt.Errorf("%s does not have field %q of embedded type %s", what, ef.Name, name)})
+			}
+			if other, ok := owners[ef.Name]; ok {
+				panic(genError{fmt.Errorf("field %q of %s is in both embedded types %s and %s", ef.Name, what, other, name)})
+			}
+			owners[ef.Name] = name
+			if g.opts.NullableSlices && !g.opts.FastJSON && isSliceOrMap(parseType("field "+ef.Name+" for "+name, ef.Typewords)) {
+				// Its MarshalJSON method would be promoted to t.
+				panic(genError{fmt.Errorf("embedded type %s in sherpago annotation for %s has arrays or objects, not supported with NullableSlices", name, what)})
+			}
+		}
+		l = append(l, name)
+	}
+	return l
+}
+
+// embedsType returns whether struct type name embeds struct type other,
+// directly or through other embedded types.
+func (g *generator) embedsType(name, other string) bool {
+	seen := map[string]bool{}
+	var embeds func(name string) bool
+	embeds = func(name string) bool {
+		if seen[name] {
+			return false
+		}
+		seen[name] = true
+		s, ok := annotations("type "+name, g.structs[name].Docs, typeAnnotations)["embeds"]
+		if !ok {
+			return false
+		}
+		for _, e := range strings.Split(s, ",") {
+			if e == other || embeds(e) {
+				return true
+			}
+		}
+		return false
+	}
+	return embeds(name)
+}
+
+// fieldNameConflict returns whether struct t has a field with Go name goName.
+func (g *generator) fieldNameConflict(t sherpadoc.Struct, goName string) bool {
+	for _, f := range t.Fields {
+		if g.fieldName(f.Name) == goName {
+			return true
+		}
+	}
+	return false
+}
+
+// embeddedFields returns the names of the fields of struct t that are in types
+// it embeds, mapped to the embedded type.
+func (g *generator) embeddedFields(t sherpadoc.Struct) map[string]string {
+	m := map[string]string{}
+	for _, name := range g.embeds(t) {
+		for _, f := range g.structs[name].Fields {
+			m[f.Name] = name
+		}
+	}
+	return m
+}
@@ -0,0 +1,152 @@
+package sherpago
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/mjl-/sherpadoc"
+)
+
+// generateEnumHelpers writes functions for listing the values of enum type
+// name and looking them up by name, see Options.EnumHelpers. Values are the Go
+// names of the values, names their names in the sherpadoc, and keys their
+// values as text, for values with multiple names.
+func (g *generator) generateEnumHelpers(name string, values, names, keys []string) {
+	typeName := g.typeName(name)
+	var nameCases, valueCases string
+	seen := map[string]bool{}
+	for i, v := range values {
+		// The first name of a value is its name.
+		if !seen[keys[i]] {
+			seen[keys[i]] = true
+			nameCases += fmt.Sprintf("\tcase %s:\n\t\treturn %s\n", v, strconv.Quote(names[i]))
+		}
+		valueCases += fmt.Sprintf("\tcase %s:\n\t\treturn %s, true\n", strconv.Quote(names[i]), v)
+	}
+	g.printf(`// %[2]s returns the documented values of %[1]s, in the order of the
+// API documentation.
+func %[2]s() []%[1]s {
+	return []%[1]s{%[3]s}
+}
+
+// Name returns the name of v in the API documentation, or the empty string if
+// v is not a documented value.
+func (v %[1]s) Name() string {
+	switch v {
+%[4]s	}
+	return ""
+}
+
+// %[5]s returns the value of %[1]s with a name in the API
+// documentation, and whether it exists.
+func %[5]s(name string) (%[1]s, bool) {
+	switch name {
+%[6]s	}
+	var zero %[1]s
+	return zero, false
+}
+
+`, typeName, g.enumValuesName(name), strings.Join(values, ", "), nameCases, g.enumByNameName(name), valueCases)
+}
+
+// enumValuesName returns the name of the function listing the values of enum
+// type name.
+func (g *generator) enumValuesName(name string) string {
+	return g.typeName(name) + "Values"
+}
+
+// enumByNameName returns the name of the function looking up a value of enum
+// type name by its name.
+func (g *generator) enumByNameName(name string) string {
+	return g.typeName(name) + "ByName"
+}
+
+// generateEnumUnknown writes the Unknown constant for enum type name, with
+// value unknown, a Go expression for a value that is not documented, and the
+// OrUnknown method, see Options.EnumUnknown. Values are the Go names of the
+// documented values, keys their values as text.
+func (g *generator) generateEnumUnknown(name, unknown string, values, keys []string) {
+	typeName := g.typeName(name)
+	var cases []string
+	seen := map[string]bool{}
+	for i, v := range values {
+		if !seen[keys[i]] {
+			seen[keys[i]] = true
+			cases = append(cases, v)
+		}
+	}
+	check := ""
+	if len(cases) > 0 {
+		check = fmt.Sprintf("\tswitch v {\n\tcase %s:\n\t\treturn v\n\t}\n", strings.Join(cases, ", "))
+	}
+	g.printf(`// %[2]s is returned by OrUnknown for values of %[1]s that are not
+// documented, e.g. added to the API after this client was generated.
+const %[2]s %[1]s = %[3]s
+
+// OrUnknown returns v if it is a documented value, and %[2]s otherwise.
+// Values are decoded and sent as is, so v keeps a value that is not known.
+func (v %[1]s) OrUnknown() %[1]s {
+%[4]s	return %[2]s
+}
+
+`, typeName, g.enumUnknownName(name), unknown, check)
+}
+
+// enumUnknownName returns the name of the constant for values that are not
+// documented of enum type name.
+func (g *generator) enumUnknownName(name string) string {
+	return g.typeName(name) + "Unknown"
+}
+
+// generateBitmask writes methods for the flags of int enum type t with the
+// "bitmask" annotation.
+func (g *generator) generateBitmask(t sherpadoc.Ints) {
+	typeName := g.typeName(t.Name)
+	var flags, zero string
+	for _, v := range t.Values {
+		if v.Value == 0 {
+			if zero == "" {
+				zero = fmt.Sprintf("\tif v == 0 {\n\t\treturn %s\n\t}\n", strconv.Quote(v.Name))
+			}
+			continue
+		}
+		flags += fmt.Sprintf("\t\t{%s, %s},\n", g.typeName(v.Name), strconv.Quote(v.Name))
+	}
+	g.printf(`// Has returns whether all flags of f are set in v.
+func (v %[1]s) Has(f %[1]s) bool {
+	return v&f == f
+}
+
+// Set returns v with the flags of f set.
+func (v %[1]s) Set(f %[1]s) %[1]s {
+	return v | f
+}
+
+// Clear returns v with the flags of f cleared.
+func (v %[1]s) Clear(f %[1]s) %[1]s {
+	return v &^ f
+}
+
+// String returns the names of the flags set in v, separated by "|", followed by
+// the remaining bits as number, if any.
+func (v %[1]s) String() string {
+%[3]s	var l []string
+	for _, f := range []struct {
+		v    %[1]s
+		name string
+	}{
+%[2]s	} {
+		if v&f.v == f.v {
+			l = append(l, f.name)
+			v &^= f.v
+		}
+	}
+	if v != 0 || len(l) == 0 {
+		l = append(l, strconv.Itoa(int(v)))
+	}
+	return strings.Join(l, "|")
+}
+
+`, typeName, flags, zero)
+}
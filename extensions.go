@@ -0,0 +1,84 @@
+package sherpago
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// VendorFields holds the vendor extension fields of a sherpadoc, with names
+// starting with "x-", that the sherpadoc package ignores. They are keyed by the
+// path of the element they are in, e.g. "" for the top-level section,
+// "Sections.Admin" for its subsection "Admin", "Functions.ping",
+// "Functions.ping.Params.0", "Functions.ping.Returns.0", "Structs.User",
+// "Structs.User.Fields.name", "Ints.Level", "Ints.Level.Values.LevelRead" and
+// "Strings.Status". Functions and types are not prefixed with their section,
+// their names are unique in a sherpadoc. Elements without vendor fields are
+// left out.
+type VendorFields map[string]map[string]json.RawMessage
+
+// parseVendorFields returns the vendor fields in sherpadoc buf.
+func parseVendorFields(buf []byte) VendorFields {
+	r := VendorFields{}
+
+	parse := func(path string, msg json.RawMessage, v interface{}) {
+		if len(msg) == 0 || string(msg) == "null" {
+			return
+		}
+		if err := json.Unmarshal(msg, v); err != nil {
+			panic(genError{fmt.Errorf("parsing vendor fields at %q: %s", path, err)})
+		}
+	}
+
+	// gather stores the vendor fields of obj and returns the fields by name.
+	gather := func(path string, msg json.RawMessage) map[string]json.RawMessage {
+		var obj map[string]json.RawMessage
+		parse(path, msg, &obj)
+		for k, v := range obj {
+			if !strings.HasPrefix(k, "x-") {
+				continue
+			}
+			if r[path] == nil {
+				r[path] = map[string]json.RawMessage{}
+			}
+			r[path][k] = v
+		}
+		return obj
+	}
+
+	// elems calls fn for each element of an array of objects, with their path and
+	// fields.
+	elems := func(path string, msg json.RawMessage, byIndex bool, fn func(path string, obj map[string]json.RawMessage)) {
+		var l []json.RawMessage
+		parse(path, msg, &l)
+		for i, e := range l {
+			key := fmt.Sprintf("%d", i)
+			if !byIndex {
+				var name struct{ Name string }
+				parse(path, e, &name)
+				key = name.Name
+			}
+			epath := strings.TrimPrefix(path+"."+key, ".")
+			fn(epath, gather(epath, e))
+		}
+	}
+
+	var section func(path string, obj map[string]json.RawMessage)
+	section = func(path string, obj map[string]json.RawMessage) {
+		elems("Functions", obj["Functions"], false, func(path string, fn map[string]json.RawMessage) {
+			elems(path+".Params", fn["Params"], true, func(string, map[string]json.RawMessage) {})
+			elems(path+".Returns", fn["Returns"], true, func(string, map[string]json.RawMessage) {})
+		})
+		elems("Structs", obj["Structs"], false, func(path string, t map[string]json.RawMessage) {
+			elems(path+".Fields", t["Fields"], false, func(string, map[string]json.RawMessage) {})
+		})
+		for _, kind := range []string{"Ints", "Strings"} {
+			elems(kind, obj[kind], false, func(path string, t map[string]json.RawMessage) {
+				elems(path+".Values", t["Values"], false, func(string, map[string]json.RawMessage) {})
+			})
+		}
+		elems(path+".Sections", obj["Sections"], false, section)
+	}
+	section("", gather("", buf))
+	return r
+}
@@ -0,0 +1,103 @@
+package sherpago
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/mjl-/sherpadoc"
+)
+
+// extraCode is the Go code with the helper for encoding the Extra fields of
+// struct types, see Options.ExtraFields.
+const extraCode = `// appendExtraJSON appends the fields in extra to JSON object b, in order of their
+// names.
+func appendExtraJSON(b []byte, extra map[string]json.RawMessage) ([]byte, error) {
+	keys := make([]string, 0, len(extra))
+	for k := range extra {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	b = b[:len(b)-1]
+	for _, k := range keys {
+		if b[len(b)-1] != '{' {
+			b = append(b, ',')
+		}
+		key, err := json.Marshal(k)
+		if err != nil {
+			return nil, err
+		}
+		b = append(append(b, key...), ':')
+		b = append(b, extra[k]...)
+	}
+	return append(b, '}'), nil
+}
+
+`
+
+// extraField is the declaration of the field with fields not in the sherpadoc.
+const extraField = "\tExtra map[string]json.RawMessage `json:\"-\"` // Fields not in the API documentation, e.g. added later, sent as is.\n"
+
+// generateExtraJSON writes MarshalJSON and UnmarshalJSON methods for struct t,
+// keeping fields that are not in the sherpadoc in its Extra field, see
+// Options.ExtraFields. Without FastJSON, which handles Extra itself. Nil
+// values for non-nullable arrays and objects, zero timestamps and durations are
+// handled as generatePlainJSON does.
+func (g *generator) generateExtraJSON(t sherpadoc.Struct) {
+	typeName := g.typeName(t.Name)
+	var names []string
+	for _, f := range t.Fields {
+		names = append(names, strconv.Quote(f.Name))
+	}
+	g.printf(`func (v %[1]s) MarshalJSON() ([]byte, error) {
+	// Without the methods of %[1]s.
+	type plain %[1]s
+%[2]s	b, err := json.Marshal(%[4]s)
+	if err != nil || len(v.Extra) == 0 {
+		return b, err
+	}
+	return appendExtraJSON(b, v.Extra)
+}
+
+func (v *%[1]s) UnmarshalJSON(buf []byte) error {
+	type plain %[1]s
+%[5]s	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(buf, &fields); err != nil || fields == nil {
+		return err
+	}
+	// Like encoding/json, documented fields are matched without case.
+	for k := range fields {
+		for _, name := range []string{%[3]s} {
+			if strings.EqualFold(k, name) {
+				delete(fields, k)
+				break
+			}
+		}
+	}
+	v.Extra = nil
+	if len(fields) > 0 {
+		v.Extra = fields
+	}
+	return nil
+}
+
+`, typeName, g.emptySliceFixes(t), strings.Join(names, ", "), g.plainValue(t), g.plainUnmarshal(t))
+}
+
+// checkExtraFields checks that struct types can get an Extra field.
+func (g *generator) checkExtraFields() {
+	for _, sec := range g.sections() {
+		for _, t := range sec.Structs {
+			for _, f := range t.Fields {
+				if g.fieldName(f.Name) == "Extra" {
+					panic(genError{fmt.Errorf("field %q of type %q conflicts with field Extra for ExtraFields", f.Name, t.Name)})
+				}
+			}
+			// The methods of embedded types would be promoted to the plain types used
+			// for encoding.
+			if len(g.embeds(t)) > 0 && !g.opts.FastJSON {
+				panic(genError{fmt.Errorf("type %q embeds types, which requires FastJSON with ExtraFields", t.Name)})
+			}
+		}
+	}
+}
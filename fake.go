@@ -0,0 +1,171 @@
+package sherpago
+
+import (
+	"fmt"
+	"io"
+)
+
+// GenerateFakes reads sherpadoc from in and writes a Go file to out with a
+// NewFake<Type>(seed) function for each struct type, returning a value with
+// pseudo-random but deterministic field values. Nullable fields are randomly
+// nil, and enum fields are set to one of the listed values. The file must be
+// placed in the package generated by Generate, with the same packageName.
+func GenerateFakes(in io.Reader, out io.Writer, packageName string) (retErr error) {
+	defer recoverGenError(&retErr)
+
+	g := newGenerator(readDoc(in), out, Options{PackageName: packageName})
+	g.generateFakes()
+	return nil
+}
+
+func (g *generator) generateFakes() {
+	g.printf("package %s\n\n", g.opts.PackageName)
+	g.printImports(append([]string{"math/rand", "time"}, g.formatImports()...))
+	g.printf(`var _ time.Time // in case "timestamp" is used
+
+// Maximum depth of nested structs in fake values. Deeper nullable fields are
+// nil, and deeper arrays and maps empty.
+const fakeDepth = 3
+
+func fakeString(r *rand.Rand) string {
+	const chars = "abcdefghijklmnopqrstuvwxyz"
+	buf := make([]byte, 1+r.Intn(12))
+	for i := range buf {
+		buf[i] = chars[r.Intn(len(chars))]
+	}
+	return string(buf)
+}
+
+`)
+
+	for _, sec := range g.sections() {
+		for _, t := range sec.Structs {
+			typeName := g.typeName(t.Name)
+			newFake := "NewFake"
+			if g.opts.Unexported {
+				newFake = "newFake"
+			}
+			g.printf(`// %[2]s%[3]s returns a %[1]s with fields set to pseudo-random values
+// derived from seed, for use in tests.
+func %[2]s%[3]s(seed int64) %[1]s {
+	return fake%[3]s(rand.New(rand.NewSource(seed)), 0)
+}
+
+func fake%[3]s(r *rand.Rand, depth int) %[1]s {
+	var v %[1]s
+`, typeName, newFake, g.exportedTypeName(t.Name))
+			if u := g.union(t.Name); u != nil {
+				// One of the variants.
+				g.printf("\tswitch r.Intn(%d) {\n", len(u.variants))
+				for i, uv := range u.variants {
+					g.printf("\tcase %d:\n\t\tv.Value = fake%s(r, depth+1)\n", i, g.exportedTypeName(uv.typ))
+				}
+				g.printf("\t}\n\treturn v\n}\n\n")
+				continue
+			}
+			for _, f := range t.Fields {
+				what := fmt.Sprintf("field %s for type %s", f.Name, t.Name)
+				fake := g.goFake(parseType(what, f.Typewords))
+				if c := g.fieldConversion(t, f); c != nil {
+					fake = c.fake
+				}
+				g.printf("\tv.%s = %s\n", g.fieldName(f.Name), fake)
+			}
+			g.printf("\treturn v\n}\n\n")
+		}
+
+		for _, t := range sec.Ints {
+			typeName := g.typeName(t.Name)
+			g.printf("func fake%s(r *rand.Rand) %s {\n", g.exportedTypeName(t.Name), typeName)
+			if len(t.Values) == 0 {
+				g.printf("\treturn %s(r.Uint64())\n}\n\n", typeName)
+				continue
+			}
+			g.printf("\tvalues := []%s{", typeName)
+			for _, v := range t.Values {
+				g.printf("%s, ", g.typeName(v.Name))
+			}
+			g.printf("}\n\treturn values[r.Intn(len(values))]\n}\n\n")
+		}
+
+		for _, t := range sec.Strings {
+			typeName := g.typeName(t.Name)
+			g.printf("func fake%s(r *rand.Rand) %s {\n", g.exportedTypeName(t.Name), typeName)
+			if len(t.Values) == 0 {
+				g.printf("\treturn %s(fakeString(r))\n}\n\n", typeName)
+				continue
+			}
+			g.printf("\tvalues := []%s{", typeName)
+			for _, v := range t.Values {
+				g.printf("%s, ", g.typeName(v.Name))
+			}
+			g.printf("}\n\treturn values[r.Intn(len(values))]\n}\n\n")
+		}
+	}
+
+	g.flush()
+}
+
+// goFake returns a Go expression with a pseudo-random value of type t, using
+// variables r (a *rand.Rand) and depth (of nested structs).
+func (g *generator) goFake(t Type) string {
+	switch t := t.(type) {
+	case BaseType:
+		switch t.Name {
+		case "any", "string":
+			return "fakeString(r)"
+		case "bool":
+			return "r.Intn(2) == 1"
+		case "float32", "float64":
+			return g.goType(t) + "(r.NormFloat64() * 1000)"
+		case "timestamp":
+			return "time.Unix(r.Int63n(1<<32), 0).UTC()"
+		default:
+			return g.goType(t) + "(r.Uint64())"
+		}
+	case NullableType:
+		if g.nilIsNull(t) {
+			return fmt.Sprintf(`func() %s {
+		if depth >= fakeDepth || r.Intn(2) == 0 {
+			return nil
+		}
+		return %s
+	}()`, g.goType(t), g.goFake(t.Type))
+		}
+		return fmt.Sprintf(`func() %s {
+		if depth >= fakeDepth || r.Intn(2) == 0 {
+			return nil
+		}
+		v := %s
+		return &v
+	}()`, g.goType(t), g.goFake(t.Type))
+	case ArrayType:
+		return fmt.Sprintf(`func() %s {
+		if depth >= fakeDepth {
+			return %[1]s{}
+		}
+		l := make(%[1]s, r.Intn(3))
+		for i := range l {
+			l[i] = %s
+		}
+		return l
+	}()`, g.goType(t), g.goFake(t.Type))
+	case ObjectType:
+		return fmt.Sprintf(`func() %s {
+		m := %[1]s{}
+		if depth >= fakeDepth {
+			return m
+		}
+		for n := r.Intn(3); n > 0; n-- {
+			m[fakeString(r)] = %s
+		}
+		return m
+	}()`, g.goType(t), g.goFake(t.Value))
+	case IdentType:
+		if _, ok := g.structs[t.Name]; ok {
+			return fmt.Sprintf("fake%s(r, depth+1)", g.exportedTypeName(t.Name))
+		}
+		return fmt.Sprintf("fake%s(r)", g.exportedTypeName(t.Name))
+	}
+	panic(genError{fmt.Errorf("no fake value for type %s", g.goType(t))})
+}
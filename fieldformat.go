@@ -0,0 +1,261 @@
+package sherpago
+
+import (
+	"encoding/json"
+	"fmt"
+	"go/token"
+	"net"
+	"net/netip"
+	"net/url"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/mjl-/sherpadoc"
+)
+
+// formatConversion returns the conversion for string field f with a "format"
+// annotation: "ip" for a netip.Addr, "mac" for a net.HardwareAddr, "url" for a
+// *url.URL, or "uuid" for the type of Options.UUIDType. For ip, mac and url, the
+// empty string is the zero value of the Go type. Formats "decimal" and "money"
+// are for the type of Options.DecimalType, for string and float fields.
+func (g *generator) formatConversion(what string, f sherpadoc.Field, format string) *fieldConversion {
+	if format == "decimal" || format == "money" {
+		return g.decimalConversion(what, f, format)
+	}
+	if len(f.Typewords) != 1 || f.Typewords[0] != "string" {
+		panic(genError{fmt.Errorf("sherpago annotation \"format\" for %s requires a non-nullable string type", what)})
+	}
+	switch format {
+	case "ip":
+		return &fieldConversion{
+			goType:   "netip.Addr",
+			jsonType: "string",
+			native:   true, // Through MarshalText and UnmarshalText.
+			literal: func(v interface{}) (string, bool) {
+				s, ok := v.(string)
+				if !ok {
+					return "", false
+				} else if s == "" {
+					return "netip.Addr{}", true
+				} else if _, err := netip.ParseAddr(s); err != nil {
+					return "", false
+				}
+				return fmt.Sprintf("netip.MustParseAddr(%q)", s), true
+			},
+			sample:    `netip.MustParseAddr("192.0.2.1")`,
+			fake:      "netip.AddrFrom4([4]byte{192, 0, 2, byte(r.Intn(256))})",
+			signature: "format=ip",
+		}
+	case "mac":
+		return &fieldConversion{
+			goType:   "net.HardwareAddr",
+			jsonType: "string",
+			encode: func(x string) string {
+				return x + ".String()"
+			},
+			decode: func(x, val string) string {
+				return fmt.Sprintf("if %[2]s == \"\" {\n\t%[1]s = nil\n} else if mac, err := net.ParseMAC(%[2]s); err != nil {\n\treturn err\n} else {\n\t%[1]s = mac\n}\n", x, val)
+			},
+			literal: func(v interface{}) (string, bool) {
+				s, ok := v.(string)
+				if !ok {
+					return "", false
+				} else if s == "" {
+					return "nil", true
+				}
+				mac, err := net.ParseMAC(s)
+				if err != nil {
+					return "", false
+				}
+				return macLiteral(mac), true
+			},
+			sample:    macLiteral(net.HardwareAddr{0x00, 0x00, 0x5e, 0x00, 0x53, 0x01}),
+			fake:      "net.HardwareAddr{0x02, 0x00, 0x5e, 0x00, byte(r.Intn(256)), byte(r.Intn(256))}",
+			signature: "format=mac",
+		}
+	case "url":
+		value := func(s string) string {
+			return fmt.Sprintf("func() *url.URL {\n\tu, _ := url.Parse(%q)\n\treturn u\n}()", s)
+		}
+		return &fieldConversion{
+			goType:   "*url.URL",
+			jsonType: "string",
+			encode: func(x string) string {
+				return fmt.Sprintf("func() string {\n\tif %[1]s == nil {\n\t\treturn \"\"\n\t}\n\treturn %[1]s.String()\n}()", x)
+			},
+			decode: func(x, val string) string {
+				return fmt.Sprintf("if %[2]s == \"\" {\n\t%[1]s = nil\n} else if u, err := url.Parse(%[2]s); err != nil {\n\treturn err\n} else {\n\t%[1]s = u\n}\n", x, val)
+			},
+			literal: func(v interface{}) (string, bool) {
+				s, ok := v.(string)
+				if !ok {
+					return "", false
+				} else if s == "" {
+					return "nil", true
+				} else if _, err := url.Parse(s); err != nil {
+					return "", false
+				}
+				return value(s), true
+			},
+			sample:    value("https://example.com/"),
+			fake:      value("https://example.com/"),
+			signature: "format=url",
+		}
+	case "uuid":
+		_, goType := g.optionType("UUIDType", g.opts.UUIDType)
+		if goType == "" {
+			panic(genError{fmt.Errorf("format uuid in sherpago annotation for %s requires Options.UUIDType", what)})
+		}
+		value := textValue(goType)
+		return &fieldConversion{
+			goType:   goType,
+			jsonType: "string",
+			native:   true,
+			literal: func(v interface{}) (string, bool) {
+				s, ok := v.(string)
+				if !ok || !uuidRegexp.MatchString(s) {
+					return "", false
+				}
+				return value(s), true
+			},
+			sample:    value("f47ac10b-58cc-4372-a567-0e02b2c3d479"),
+			fake:      value("f47ac10b-58cc-4372-a567-0e02b2c3d479"),
+			signature: "format=uuid",
+		}
+	}
+	panic(genError{fmt.Errorf("unknown format %q in sherpago annotation for %s, must be ip, mac, url, uuid, decimal or money", format, what)})
+}
+
+var uuidRegexp = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+
+var decimalRegexp = regexp.MustCompile(`^-?[0-9]+(\.[0-9]+)?$`)
+
+// decimalConversion returns the conversion for field f with format "decimal" or
+// "money" to the type of Options.DecimalType, for exact arithmetic. String
+// fields hold the decimal as text, e.g. "12.50", and are encoded by the type
+// itself. Float fields are JSON numbers, which are decoded through json.Number
+// without the precision loss of a float64.
+func (g *generator) decimalConversion(what string, f sherpadoc.Field, format string) *fieldConversion {
+	_, goType := g.optionType("DecimalType", g.opts.DecimalType)
+	if goType == "" {
+		panic(genError{fmt.Errorf("format %s in sherpago annotation for %s requires Options.DecimalType", format, what)})
+	}
+	var w string
+	if len(f.Typewords) == 1 {
+		w = f.Typewords[0]
+	}
+	value := textValue(goType)
+	c := &fieldConversion{
+		goType:    goType,
+		sample:    value("12.50"),
+		fake:      value("12.50"),
+		signature: "format=" + format,
+	}
+	switch w {
+	case "string":
+		c.jsonType = "string"
+		c.native = true
+		c.literal = func(v interface{}) (string, bool) {
+			s, ok := v.(string)
+			if !ok || !decimalRegexp.MatchString(s) {
+				return "", false
+			}
+			return value(s), true
+		}
+	case "float32", "float64":
+		c.jsonType = "any"
+		c.valueType = "json.Number"
+		c.encode = func(x string) string {
+			// Text of a decimal does not fail. If it is not a valid JSON number,
+			// encoding fails.
+			return fmt.Sprintf("func() json.Number {\n\tbuf, _ := %s.MarshalText()\n\treturn json.Number(buf)\n}()", x)
+		}
+		c.decode = func(x, val string) string {
+			return fmt.Sprintf("if err := %s.UnmarshalText([]byte(%s)); err != nil {\n\treturn err\n}\n", x, val)
+		}
+		c.literal = func(v interface{}) (string, bool) {
+			num, ok := v.(json.Number)
+			if !ok {
+				return "", false
+			}
+			return value(string(num)), true
+		}
+	default:
+		panic(genError{fmt.Errorf("format %s in sherpago annotation for %s requires a non-nullable string or float type", format, what)})
+	}
+	return c
+}
+
+// textValue returns a function returning a Go expression of goType for text s,
+// for types with values only known to the type, through UnmarshalText.
+func textValue(goType string) func(s string) string {
+	return func(s string) string {
+		return fmt.Sprintf("func() %s {\n\tvar v %s\n\t_ = v.UnmarshalText([]byte(%q))\n\treturn v\n}()", goType, goType, s)
+	}
+}
+
+// optionType returns the import path, empty for a type in the generated
+// package, and the Go type for s of an option, e.g. Options.UUIDType, with
+// "github.com/google/uuid" and "uuid.UUID" for "github.com/google/uuid.UUID".
+// The package name must be the last element of the import path.
+func (g *generator) optionType(option, s string) (string, string) {
+	if s == "" {
+		return "", ""
+	}
+	imp, name := "", s
+	if i := strings.LastIndex(s, "."); i >= 0 {
+		imp, name = s[:i], s[i+1:]
+	}
+	if !token.IsIdentifier(name) || !token.IsExported(name) {
+		panic(genError{fmt.Errorf("bad type %q for %s, must be an import path and an exported type name, e.g. github.com/google/uuid.UUID", s, option)})
+	}
+	if imp == "" {
+		return "", name
+	}
+	return imp, path.Base(imp) + "." + name
+}
+
+// typeOptions returns the options with Go types for formats, by name.
+func (g *generator) typeOptions() map[string]string {
+	return map[string]string{
+		"UUIDType":    g.opts.UUIDType,
+		"DecimalType": g.opts.DecimalType,
+	}
+}
+
+// macLiteral returns a Go expression for mac.
+func macLiteral(mac net.HardwareAddr) string {
+	var l []string
+	for _, b := range mac {
+		l = append(l, fmt.Sprintf("0x%02x", b))
+	}
+	return "net.HardwareAddr{" + strings.Join(l, ", ") + "}"
+}
+
+// formatImports returns the packages for the Go types of fields with a "format"
+// annotation.
+func (g *generator) formatImports() []string {
+	var l []string
+	for _, sec := range g.sections() {
+		for _, t := range sec.Structs {
+			for _, c := range g.conversionFields(t, false) {
+				switch c.goType {
+				case "netip.Addr":
+					l = append(l, "net/netip")
+				case "net.HardwareAddr":
+					l = append(l, "net")
+				case "*url.URL":
+					l = append(l, "net/url")
+				default:
+					for option, s := range g.typeOptions() {
+						if imp, goType := g.optionType(option, s); imp != "" && c.goType == goType {
+							l = append(l, imp)
+						}
+					}
+				}
+			}
+		}
+	}
+	return l
+}
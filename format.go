@@ -0,0 +1,52 @@
+package sherpago
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"sort"
+	"strings"
+)
+
+// formatFiles parses the generated Go files, calls Options.ASTHook with their
+// syntax trees if set, and replaces them with the trees printed as by gofmt. A
+// snippet of the client package is formatted without calling the hook, it is
+// not a complete file. Generated code that does not parse is a bug in sherpago,
+// reported as error.
+func formatFiles(files map[string][]byte, opts Options) {
+	var names []string
+	for name := range files {
+		if strings.HasSuffix(name, ".go") {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if opts.Snippet != "" && name == opts.PackageName+".go" {
+			buf, err := format.Source(files[name])
+			if err != nil {
+				panic(genError{fmt.Errorf("formatting generated %s (bug in sherpago): %s", name, err)})
+			}
+			files[name] = buf
+			continue
+		}
+
+		fset := token.NewFileSet()
+		file, err := parser.ParseFile(fset, name, files[name], parser.ParseComments)
+		if err != nil {
+			panic(genError{fmt.Errorf("parsing generated %s (bug in sherpago): %s", name, err)})
+		}
+		if opts.ASTHook != nil {
+			if err := opts.ASTHook(name, fset, file); err != nil {
+				panic(genError{fmt.Errorf("ast hook for %s: %s", name, err)})
+			}
+		}
+		var buf bytes.Buffer
+		if err := format.Node(&buf, fset, file); err != nil {
+			panic(genError{fmt.Errorf("printing %s: %s", name, err)})
+		}
+		files[name] = buf.Bytes()
+	}
+}
@@ -0,0 +1,69 @@
+package sherpago
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing/fstest"
+)
+
+// WriteFS is a file system that generated files are written to by GenerateFS.
+type WriteFS interface {
+	// WriteFile writes data to file name, a slash-separated path as in io/fs.
+	// Parent directories are created as needed.
+	WriteFile(name string, data []byte) error
+}
+
+// DirFS returns a WriteFS that writes files in directory dir on the local file
+// system.
+func DirFS(dir string) WriteFS {
+	return dirFS(dir)
+}
+
+type dirFS string
+
+func (d dirFS) WriteFile(name string, data []byte) error {
+	p := filepath.Join(string(d), filepath.FromSlash(name))
+	err := os.MkdirAll(filepath.Dir(p), 0777)
+	if err == nil {
+		err = os.WriteFile(p, data, 0666)
+	}
+	return err
+}
+
+// MapFS is a WriteFS that stores files in memory. The files can be read through
+// io/fs by converting to fstest.MapFS.
+type MapFS fstest.MapFS
+
+// WriteFile stores data as file name.
+func (m MapFS) WriteFile(name string, data []byte) error {
+	m[name] = &fstest.MapFile{Data: data, Mode: 0666}
+	return nil
+}
+
+// GenerateFS reads sherpadoc from in and writes the files returned by
+// GenerateFiles to fsys, in order of their names.
+func GenerateFS(in io.Reader, fsys WriteFS, opts Options) error {
+	files, err := GenerateFiles(in, opts)
+	if err != nil {
+		return err
+	}
+	var names []string
+	for name := range files {
+		if !fs.ValidPath(name) {
+			return fmt.Errorf("invalid file name %q", name)
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		err := fsys.WriteFile(name, files[name])
+		if err != nil {
+			return fmt.Errorf("writing %s: %s", name, err)
+		}
+	}
+	return nil
+}
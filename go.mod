@@ -1,6 +1,6 @@
 module github.com/mjl-/sherpago
 
-go 1.12
+go 1.18
 
 require (
 	github.com/mjl-/sherpa v0.6.0
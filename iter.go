@@ -0,0 +1,198 @@
+package sherpago
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/mjl-/sherpadoc"
+)
+
+// iterElems returns the Go expression for the slice of array type t in x, with
+// a condition for whether it is present, for a nullable array that is a
+// pointer, and the Go type of its elements. The type must be an array, possibly
+// nullable.
+func (g *generator) iterElems(t Type, x string) (slice, cond, elem string, ok bool) {
+	if nt, isNullable := t.(NullableType); isNullable {
+		if !g.nilIsNull(nt) {
+			cond = x + " != nil"
+			x = "*" + x
+		}
+		t = nt.Type
+	}
+	at, ok := t.(ArrayType)
+	if !ok {
+		return "", "", "", false
+	}
+	return x, cond, g.goType(at.Type), true
+}
+
+// iterPages returns the parameter, and the fields of the struct result with the
+// elements and the value of the parameter for the next page, of fn with the
+// "pages" annotation, or nil values if it has no such annotation. The annotation
+// is "<param>:<items>:<next>", e.g. "pages=cursor:users:next".
+func (g *generator) iterPages(fn *sherpadoc.Function) (param *sherpadoc.Arg, items, next *sherpadoc.Field) {
+	what := "function " + fn.Name
+	v, ok := annotations(what, fn.Docs, functionAnnotations)["pages"]
+	if !ok {
+		return nil, nil, nil
+	}
+	t := strings.Split(v, ":")
+	if len(t) != 3 {
+		panic(genError{fmt.Errorf("sherpago annotation \"pages\" for %s must be <param>:<items>:<next>", what)})
+	}
+	if len(fn.Returns) != 1 {
+		panic(genError{fmt.Errorf("sherpago annotation \"pages\" for %s requires a single result", what)})
+	}
+	tw := fn.Returns[0].Typewords
+	if len(tw) == 2 && tw[0] == "nullable" {
+		tw = tw[1:]
+	}
+	var st sherpadoc.Struct
+	if len(tw) == 1 {
+		st = g.structs[tw[0]]
+	}
+	if st.Name == "" || g.union(st.Name) != nil {
+		panic(genError{fmt.Errorf("sherpago annotation \"pages\" for %s requires a struct type as result", what)})
+	}
+	for i, p := range fn.Params {
+		if p.Name == t[0] {
+			param = &fn.Params[i]
+		}
+	}
+	for i, f := range st.Fields {
+		switch f.Name {
+		case t[1]:
+			items = &st.Fields[i]
+		case t[2]:
+			next = &st.Fields[i]
+		}
+	}
+	if param == nil {
+		panic(genError{fmt.Errorf("%s has no parameter %q for sherpago annotation \"pages\"", what, t[0])})
+	}
+	if items == nil {
+		panic(genError{fmt.Errorf("result of %s has no field %q for sherpago annotation \"pages\"", what, t[1])})
+	} else if _, _, _, ok := g.iterElems(parseType(what, items.Typewords), ""); !ok {
+		panic(genError{fmt.Errorf("field %q of result of %s for sherpago annotation \"pages\" is not an array", t[1], what)})
+	}
+	if next == nil {
+		panic(genError{fmt.Errorf("result of %s has no field %q for sherpago annotation \"pages\"", what, t[2])})
+	} else if strings.Join(next.Typewords, " ") != strings.Join(param.Typewords, " ") {
+		panic(genError{fmt.Errorf("field %q of result of %s for sherpago annotation \"pages\" must have the type of parameter %q", t[2], what, t[0])})
+	}
+	if g.iterZero(next.Typewords) == "" {
+		panic(genError{fmt.Errorf("field %q of result of %s for sherpago annotation \"pages\" must be a string or integer, possibly nullable", t[2], what)})
+	}
+	return param, items, next
+}
+
+// iterZero returns the Go expression of the zero value for the next page of
+// typewords, for which there are no more pages, or the empty string if the type
+// cannot be a page parameter.
+func (g *generator) iterZero(typewords []string) string {
+	if len(typewords) == 2 && typewords[0] == "nullable" {
+		if g.iterZero(typewords[1:]) == "" {
+			return ""
+		}
+		return "nil"
+	}
+	if len(typewords) != 1 {
+		return ""
+	}
+	switch w := typewords[0]; w {
+	case "string":
+		return `""`
+	case "int8", "uint8", "int16", "uint16", "int32", "uint32", "int64", "uint64", "int64s", "uint64s":
+		return "0"
+	default:
+		if _, ok := g.strs[w]; ok {
+			return `""`
+		}
+	}
+	return ""
+}
+
+// iterName returns the name of the method with an iterator for fn.
+func (g *generator) iterName(fn *sherpadoc.Function) string {
+	return g.goName(fn.Name) + "All"
+}
+
+// hasIter returns whether fn gets a method with an iterator, see
+// Options.IterMethods: for functions with an array as single result, or with
+// the "pages" annotation.
+func (g *generator) hasIter(fn *sherpadoc.Function) bool {
+	if !g.opts.IterMethods {
+		return false
+	}
+	if param, _, _ := g.iterPages(fn); param != nil {
+		return true
+	}
+	if len(fn.Returns) != 1 {
+		return false
+	}
+	_, _, _, ok := g.iterElems(parseType("result of "+fn.Name, fn.Returns[0].Typewords), "")
+	return ok
+}
+
+// generateIter writes the method for fn returning an iterator over the
+// elements of its results, for a function for which hasIter is true.
+func (g *generator) generateIter(fn *sherpadoc.Function) {
+	whatParam := "parameter for " + fn.Name
+	name := g.goName(fn.Name)
+	params := []string{"ctx context.Context"}
+	args := []string{"ctx"}
+	for i, local := range g.goParamNames(fn) {
+		params = append(params, fmt.Sprintf("%s %s", local, g.goTypewords(whatParam, fn.Params[i].Typewords)))
+		args = append(args, local)
+	}
+
+	var rangeCode, nextCode, elem string
+	param, items, next := g.iterPages(fn)
+	if param != nil {
+		nullable := fn.Returns[0].Typewords[0] == "nullable"
+		slice, cond, e, _ := g.iterElems(parseType(whatParam, items.Typewords), "r0."+g.fieldName(items.Name))
+		if nullable && cond != "" {
+			cond = "r0 != nil && " + cond
+		} else if nullable {
+			cond = "r0 != nil"
+		}
+		rangeCode, elem = iterRange(slice, cond), e
+		stop := fmt.Sprintf("r0.%s == %s", g.fieldName(next.Name), g.iterZero(next.Typewords))
+		if nullable {
+			stop = "r0 == nil || " + stop
+		}
+		var local string
+		for i := range fn.Params {
+			if &fn.Params[i] == param {
+				local = args[1+i]
+			}
+		}
+		nextCode = fmt.Sprintf("if %s {\n\treturn\n}\n%s = r0.%s\n", stop, local, g.fieldName(next.Name))
+		g.printf("// %s returns an iterator over the %s of the results of\n// %s, calling it for each page, with %s set to the %s of\n// the previous result, until the last page. After an error, the iterator\n// stops.\n", g.iterName(fn), items.Name, name, local, next.Name)
+	} else {
+		slice, cond, e, _ := g.iterElems(parseType(whatParam, fn.Returns[0].Typewords), "r0")
+		rangeCode, elem = iterRange(slice, cond), e
+		g.printf("// %s returns an iterator over the elements of the result of\n// %s, calling it once. After an error, the iterator stops.\n", g.iterName(fn), name)
+	}
+
+	g.printf("func (c *%s) %s(%s) iter.Seq2[%s, error] {\n", g.clientName(), g.iterName(fn), strings.Join(params, ", "), elem)
+	g.printf("\treturn func(yield func(%s, error) bool) {\n", elem)
+	call := fmt.Sprintf("r0, err := c.%s(%s)\n", name, strings.Join(args, ", "))
+	errCode := fmt.Sprintf("if err != nil {\n\tvar zero %s\n\tyield(zero, err)\n\treturn\n}\n", elem)
+	if param == nil {
+		g.printf("%s", indent(call+errCode+rangeCode, "\t\t"))
+	} else {
+		g.printf("\t\tfor {\n%s\t\t}\n", indent(call+errCode+rangeCode+nextCode, "\t\t\t"))
+	}
+	g.printf("\t}\n}\n\n")
+}
+
+// iterRange returns Go code yielding the elements of slice, if cond is empty
+// or true.
+func iterRange(slice, cond string) string {
+	code := fmt.Sprintf("for _, e := range %s {\n\tif !yield(e, nil) {\n\t\treturn\n\t}\n}\n", slice)
+	if cond == "" {
+		return code
+	}
+	return fmt.Sprintf("if %s {\n%s}\n", cond, indent(code, "\t"))
+}
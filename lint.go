@@ -0,0 +1,144 @@
+package sherpago
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/mjl-/sherpadoc"
+)
+
+// LintIssue is a hazard for generating Go code from a sherpadoc, found by Lint.
+type LintIssue struct {
+	// Kind of issue: "conflict" for names that become the same Go name, "case" for
+	// names whose Go names only differ in case, "method" for fields with the name
+	// of a generated method, "docs" for documentation with long lines, or
+	// "generate" for other reasons generating fails.
+	Kind    string `json:"kind"`
+	Name    string `json:"name"` // In the sherpadoc, e.g. "User", or "User.id" for a field.
+	Message string `json:"message"`
+}
+
+// Longest line in documentation that Lint does not report, unless
+// Options.DocWidth is set.
+const lintDocWidth = 120
+
+// Methods that sherpago can generate on struct types, with the option adding
+// them, for fields with those names.
+var lintMethods = map[string]string{
+	"OrZero":        "option OrZero",
+	"SetDefaults":   "a sherpago default annotation",
+	"MarshalJSON":   "option FastJSON",
+	"UnmarshalJSON": "option FastJSON",
+}
+
+// Lint reads sherpadoc from in and returns the hazards for generating Go code
+// with opts, e.g. names that become the same Go name, or that differ only in
+// case, which encoding/json treats as the same when decoding. Unlike
+// generating, all issues are returned, not only the first.
+func Lint(in io.Reader, opts Options) (issues []LintIssue, retErr error) {
+	defer recoverGenError(&retErr)
+
+	buf, err := io.ReadAll(in)
+	if err != nil {
+		return nil, fmt.Errorf("reading sherpadoc: %s", err)
+	}
+	g := newGenerator(prepareDoc(bytes.NewReader(buf), opts), io.Discard, opts)
+
+	add := func(kind, name, format string, args ...interface{}) {
+		issues = append(issues, LintIssue{kind, name, fmt.Sprintf(format, args...)})
+	}
+
+	// names returns a function checking the Go name for a sherpadoc name against
+	// the other names of the same scope.
+	names := func(what string) func(name, goName string) {
+		seen := map[string]string{} // Lower case Go name to sherpadoc name.
+		goNames := map[string]string{}
+		return func(name, goName string) {
+			lower := strings.ToLower(goName)
+			if other, ok := seen[lower]; !ok {
+				seen[lower] = name
+				goNames[lower] = goName
+			} else if goNames[lower] == goName {
+				add("conflict", name, "%s %q becomes Go name %s, like %q", what, name, goName, other)
+			} else {
+				add("case", name, "%s %q becomes Go name %s, which only differs in case from %s for %q", what, name, goName, goNames[lower], other)
+			}
+		}
+	}
+	docs := func(name, docs string) {
+		if g.opts.DocWidth > 0 {
+			return
+		}
+		for _, line := range strings.Split(docs, "\n") {
+			if n := utf8.RuneCountInString(line); n > lintDocWidth {
+				add("docs", name, "documentation of %q has a line of %d characters, consider Options.DocWidth", name, n)
+				return
+			}
+		}
+	}
+
+	typeNames := names("name")
+	funcNames := names("function")
+	var section func(sec *sherpadoc.Section)
+	section = func(sec *sherpadoc.Section) {
+		docs(sec.Name, sec.Docs)
+		for _, t := range sec.Structs {
+			typeNames(t.Name, g.typeName(t.Name))
+			docs(t.Name, t.Docs)
+			fieldNames := names("field")
+			for _, f := range t.Fields {
+				name := t.Name + "." + f.Name
+				goName := g.fieldName(f.Name)
+				fieldNames(name, goName)
+				if option, ok := lintMethods[goName]; ok {
+					add("method", name, "field %q has the name of method %s generated with %s", name, goName, option)
+				}
+				docs(name, f.Docs)
+			}
+		}
+		for _, t := range sec.Ints {
+			typeNames(t.Name, g.typeName(t.Name))
+			docs(t.Name, t.Docs)
+			for _, v := range t.Values {
+				typeNames(v.Name, g.typeName(v.Name))
+				docs(v.Name, v.Docs)
+			}
+		}
+		for _, t := range sec.Strings {
+			typeNames(t.Name, g.typeName(t.Name))
+			docs(t.Name, t.Docs)
+			for _, v := range t.Values {
+				typeNames(v.Name, g.typeName(v.Name))
+				docs(v.Name, v.Docs)
+			}
+		}
+		for _, fn := range sec.Functions {
+			funcNames(fn.Name, g.goName(fn.Name))
+			docs(fn.Name, fn.Docs)
+		}
+		for _, subsec := range sec.Sections {
+			section(subsec)
+		}
+	}
+	section(g.doc)
+
+	// Generating stops at the first conflict, e.g. with the names of the client,
+	// which are not reported again.
+	for _, issue := range issues {
+		if issue.Kind == "conflict" {
+			return issues, nil
+		}
+	}
+	var genErr error
+	func() {
+		defer recoverGenError(&genErr)
+		g.checkNames()
+	}()
+	if genErr != nil {
+		add("generate", "", "%s", genErr)
+	}
+	return issues, nil
+}
@@ -0,0 +1,155 @@
+package sherpago
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/mjl-/sherpadoc"
+)
+
+// GenerateMarkdown reads sherpadoc from in and writes a markdown API reference to
+// out. It has the sections, functions and types from the sherpadoc, along with
+// the Go names and method signatures of the client generated by Generate.
+func GenerateMarkdown(in io.Reader, out io.Writer, packageName string) (retErr error) {
+	defer recoverGenError(&retErr)
+
+	g := newGenerator(readDoc(in), out, Options{PackageName: packageName})
+	g.generateMarkdown()
+	return nil
+}
+
+func (g *generator) generateMarkdown() {
+	heading := func(depth int, title string) {
+		if depth > 6 {
+			depth = 6
+		}
+		g.printf("%s %s\n\n", strings.Repeat("#", depth), title)
+	}
+	paragraphs := func(docs string) {
+		lines := docLines(docs)
+		if len(lines) > 0 {
+			g.printf("%s\n\n", strings.Join(lines, "\n"))
+		}
+	}
+
+	var generateSection func(sec *sherpadoc.Section, depth int)
+	generateSection = func(sec *sherpadoc.Section, depth int) {
+		heading(depth, sec.Name)
+		paragraphs(sec.Docs)
+		if depth == 1 {
+			g.printf("Go package `%s`, with type `%s` for calling the functions.\n\n", g.opts.PackageName, g.clientName())
+		}
+
+		if len(sec.Functions) > 0 {
+			heading(depth+1, "Functions")
+		}
+		for _, fn := range sec.Functions {
+			heading(depth+2, fn.Name)
+			g.printf("```go\nfunc (c *%s) %s\n```\n\n", g.clientName(), g.goSignature(fn))
+			paragraphs(fn.Docs)
+		}
+
+		if len(sec.Structs)+len(sec.Ints)+len(sec.Strings) > 0 {
+			heading(depth+1, "Types")
+		}
+		for _, t := range sec.Structs {
+			heading(depth+2, g.typeName(t.Name))
+			paragraphs(t.Docs)
+			if u := g.union(t.Name); u != nil {
+				g.printf("Union, field Value has one of the variants, with JSON field `%s` set to their kind.\n\n", u.field)
+				g.printf("| Kind | Go type |\n|---|---|\n")
+				for _, uv := range u.variants {
+					g.printf("| %s | `%s` |\n", markdownCell(uv.kind), g.typeName(uv.typ))
+				}
+				g.printf("\n")
+				continue
+			}
+			if embeds := g.embeds(t); len(embeds) > 0 {
+				var names []string
+				for _, name := range embeds {
+					names = append(names, g.typeName(name))
+				}
+				g.printf("Embeds `%s`.\n\n", strings.Join(names, "`, `"))
+			}
+			if len(t.Fields) == 0 {
+				continue
+			}
+			g.printf("| Field | Go type | JSON name | Description |\n|---|---|---|---|\n")
+			for _, f := range t.Fields {
+				what := fmt.Sprintf("field %s for type %s", f.Name, t.Name)
+				g.printf("| %s | `%s` | %s | %s |\n", g.fieldName(f.Name), g.goTypewords(what, f.Typewords), f.Name, markdownCell(f.Docs))
+			}
+			g.printf("\n")
+		}
+		for _, t := range sec.Ints {
+			heading(depth+2, g.typeName(t.Name))
+			g.printf("Integer enum.\n\n")
+			paragraphs(t.Docs)
+			if len(t.Values) == 0 {
+				continue
+			}
+			g.printf("| Constant | Value | Description |\n|---|---|---|\n")
+			for _, v := range t.Values {
+				g.printf("| %s | %d | %s |\n", g.typeName(v.Name), v.Value, markdownCell(v.Docs))
+			}
+			g.printf("\n")
+		}
+		for _, t := range sec.Strings {
+			heading(depth+2, g.typeName(t.Name))
+			g.printf("String enum.\n\n")
+			paragraphs(t.Docs)
+			if len(t.Values) == 0 {
+				continue
+			}
+			g.printf("| Constant | Value | Description |\n|---|---|---|\n")
+			for _, v := range t.Values {
+				g.printf("| %s | `%s` | %s |\n", g.typeName(v.Name), strconv.Quote(v.Value), markdownCell(v.Docs))
+			}
+			g.printf("\n")
+		}
+
+		for _, subsec := range sec.Sections {
+			generateSection(subsec, depth+1)
+		}
+	}
+	generateSection(g.doc, 1)
+
+	g.flush()
+}
+
+// goSignature returns the name, parameters and results of the client method for
+// fn, as used in a Go method declaration.
+func (g *generator) goSignature(fn *sherpadoc.Function) string {
+	return g.goSignatureName(fn, g.goName(fn.Name), true)
+}
+
+// goSignatureName returns a signature like goSignature, but with method name
+// name, and without context parameter if withCtx is false.
+func (g *generator) goSignatureName(fn *sherpadoc.Function, name string, withCtx bool) string {
+	whatParam := "parameter for " + fn.Name
+	params := []string{}
+	if withCtx {
+		params = append(params, "ctx context.Context")
+	}
+	for i, local := range g.goParamNames(fn) {
+		params = append(params, fmt.Sprintf("%s %s", local, g.goTypewords(whatParam, fn.Params[i].Typewords)))
+	}
+	results := []string{}
+	for _, t := range fn.Returns {
+		results = append(results, g.goTypewords(whatParam, t.Typewords))
+	}
+	results = append(results, "error")
+	r := strings.Join(results, ", ")
+	if len(results) > 1 {
+		r = "(" + r + ")"
+	}
+	return fmt.Sprintf("%s(%s) %s", name, strings.Join(params, ", "), r)
+}
+
+// markdownCell returns docs as text for a single cell in a markdown table.
+func markdownCell(docs string) string {
+	s := strings.Join(docLines(docs), " ")
+	return strings.Replace(s, "|", `\|`, -1)
+}
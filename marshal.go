@@ -0,0 +1,806 @@
+package sherpago
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/mjl-/sherpadoc"
+)
+
+// fastJSONCode is the Go code with helpers for the MarshalJSON and UnmarshalJSON
+// methods generated for Options.FastJSON, written before the types.
+const fastJSONCode = `var _ = sort.Strings // in case maps are used
+
+// appendJSONString appends s as JSON string to b, escaped like encoding/json.
+func appendJSONString(b []byte, s string) []byte {
+	const hex = "0123456789abcdef"
+	b = append(b, '"')
+	start := 0
+	for i := 0; i < len(s); {
+		c := s[i]
+		if c < utf8.RuneSelf {
+			if c >= 0x20 && c != '"' && c != '\\' && c != '<' && c != '>' && c != '&' {
+				i++
+				continue
+			}
+			b = append(b, s[start:i]...)
+			switch c {
+			case '"', '\\':
+				b = append(b, '\\', c)
+			case '\n':
+				b = append(b, '\\', 'n')
+			case '\r':
+				b = append(b, '\\', 'r')
+			case '\t':
+				b = append(b, '\\', 't')
+			default:
+				b = append(b, '\\', 'u', '0', '0', hex[c>>4], hex[c&0xf])
+			}
+			i++
+			start = i
+			continue
+		}
+		r, size := utf8.DecodeRuneInString(s[i:])
+		if r == utf8.RuneError && size == 1 || r == '\u2028' || r == '\u2029' {
+			b = append(b, s[start:i]...)
+			if r == utf8.RuneError {
+				b = append(b, "\ufffd"...)
+			} else {
+				b = append(b, '\\', 'u', '2', '0', '2', hex[r&0xf])
+			}
+			start = i + size
+		}
+		i += size
+	}
+	b = append(b, s[start:]...)
+	return append(b, '"')
+}
+
+// appendJSONFloat appends f as JSON number to b, formatted like encoding/json.
+func appendJSONFloat(b []byte, f float64, bits int) ([]byte, error) {
+	if math.IsInf(f, 0) || math.IsNaN(f) {
+		return nil, fmt.Errorf("json: unsupported value: %s", strconv.FormatFloat(f, 'g', -1, bits))
+	}
+	format := byte('f')
+	if abs := math.Abs(f); abs != 0 {
+		if bits == 64 && (abs < 1e-6 || abs >= 1e21) || bits == 32 && (float32(abs) < 1e-6 || float32(abs) >= 1e21) {
+			format = 'e'
+		}
+	}
+	b = strconv.AppendFloat(b, f, format, -1, bits)
+	if format == 'e' {
+		// Turn e-09 into e-9.
+		n := len(b)
+		if n >= 4 && b[n-4] == 'e' && b[n-3] == '-' && b[n-2] == '0' {
+			b[n-2] = b[n-1]
+			b = b[:n-1]
+		}
+	}
+	return b, nil
+}
+
+// appendJSONTime appends t as JSON string to b, like time.Time.MarshalJSON.
+func appendJSONTime(b []byte, t time.Time) ([]byte, error) {
+	if y := t.Year(); y < 0 || y >= 10000 {
+		return nil, fmt.Errorf("json: year outside of range [0,9999]")
+	}
+	b = append(b, '"')
+	b = t.AppendFormat(b, time.RFC3339Nano)
+	return append(b, '"'), nil
+}
+
+// appendJSONValue appends the JSON encoding of v to b, using encoding/json.
+func appendJSONValue(b []byte, v interface{}) ([]byte, error) {
+	buf, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return append(b, buf...), nil
+}
+
+// jsonReader parses JSON values from buf, for the UnmarshalJSON methods.
+type jsonReader struct {
+	buf []byte
+	pos int
+}
+
+func (r *jsonReader) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("json: parsing at offset %d: %s", r.pos, fmt.Sprintf(format, args...))
+}
+
+// peek skips whitespace and returns the next byte, or 0 at the end.
+func (r *jsonReader) peek() byte {
+	for r.pos < len(r.buf) {
+		switch c := r.buf[r.pos]; c {
+		case ' ', '\t', '\r', '\n':
+			r.pos++
+		default:
+			return c
+		}
+	}
+	return 0
+}
+
+// end returns an error if anything but whitespace follows.
+func (r *jsonReader) end() error {
+	r.peek()
+	if r.pos < len(r.buf) {
+		return r.errorf("data after JSON value")
+	}
+	return nil
+}
+
+func (r *jsonReader) literal(s string) bool {
+	if r.peek() == s[0] && bytes.HasPrefix(r.buf[r.pos:], []byte(s)) {
+		r.pos += len(s)
+		return true
+	}
+	return false
+}
+
+// null consumes a null value, and returns whether it did.
+func (r *jsonReader) null() bool {
+	return r.literal("null")
+}
+
+func (r *jsonReader) boolean() (bool, error) {
+	if r.literal("true") {
+		return true, nil
+	} else if r.literal("false") {
+		return false, nil
+	}
+	return false, r.errorf("expected boolean")
+}
+
+// scanString consumes a string, returning whether it is free of escapes.
+func (r *jsonReader) scanString() (plain bool, err error) {
+	if r.peek() != '"' {
+		return false, r.errorf("expected string")
+	}
+	plain = true
+	for r.pos++; r.pos < len(r.buf); {
+		switch c := r.buf[r.pos]; {
+		case c == '"':
+			r.pos++
+			return plain, nil
+		case c == '\\':
+			plain = false
+			r.pos += 2
+		case c < 0x20:
+			return false, r.errorf("control character in string")
+		default:
+			r.pos++
+		}
+	}
+	return false, r.errorf("unterminated string")
+}
+
+func (r *jsonReader) str() (string, error) {
+	r.peek()
+	start := r.pos
+	plain, err := r.scanString()
+	if err != nil {
+		return "", err
+	}
+	if s := r.buf[start+1 : r.pos-1]; plain && utf8.Valid(s) {
+		return string(s), nil
+	}
+	// Escapes and invalid UTF-8 are rare, leave them to encoding/json.
+	var s string
+	err = json.Unmarshal(r.buf[start:r.pos], &s)
+	return s, err
+}
+
+// number returns the next number, which is quoted for ",string" fields.
+func (r *jsonReader) number(quoted bool) ([]byte, error) {
+	if quoted {
+		r.peek()
+		start := r.pos
+		plain, err := r.scanString()
+		if err != nil {
+			return nil, err
+		} else if !plain {
+			return nil, r.errorf("expected number in string")
+		}
+		return r.buf[start+1 : r.pos-1], nil
+	}
+	r.peek()
+	start := r.pos
+	for ; r.pos < len(r.buf); r.pos++ {
+		c := r.buf[r.pos]
+		if !(c >= '0' && c <= '9' || c == '-' || c == '+' || c == '.' || c == 'e' || c == 'E') {
+			break
+		}
+	}
+	if r.pos == start {
+		return nil, r.errorf("expected number")
+	}
+	return r.buf[start:r.pos], nil
+}
+
+func (r *jsonReader) int(bits int, quoted bool) (int64, error) {
+	s, err := r.number(quoted)
+	if err != nil {
+		return 0, err
+	}
+	v, err := strconv.ParseInt(string(s), 10, bits)
+	if err != nil {
+		return 0, r.errorf("%s", err)
+	}
+	return v, nil
+}
+
+func (r *jsonReader) uint(bits int, quoted bool) (uint64, error) {
+	s, err := r.number(quoted)
+	if err != nil {
+		return 0, err
+	}
+	v, err := strconv.ParseUint(string(s), 10, bits)
+	if err != nil {
+		return 0, r.errorf("%s", err)
+	}
+	return v, nil
+}
+
+func (r *jsonReader) float(bits int) (float64, error) {
+	s, err := r.number(false)
+	if err != nil {
+		return 0, err
+	}
+	v, err := strconv.ParseFloat(string(s), bits)
+	if err != nil {
+		return 0, r.errorf("%s", err)
+	}
+	return v, nil
+}
+
+// raw consumes any JSON value and returns it.
+func (r *jsonReader) raw() ([]byte, error) {
+	c := r.peek()
+	start := r.pos
+	var err error
+	switch c {
+	case '"':
+		_, err = r.scanString()
+	case '{', '[':
+		for depth := 0; err == nil; {
+			if r.pos >= len(r.buf) {
+				return nil, r.errorf("unexpected end of JSON")
+			}
+			switch r.buf[r.pos] {
+			case '"':
+				_, err = r.scanString()
+				continue
+			case '{', '[':
+				depth++
+			case '}', ']':
+				depth--
+			}
+			r.pos++
+			if depth == 0 {
+				break
+			}
+		}
+	case 't', 'f':
+		_, err = r.boolean()
+	case 'n':
+		if !r.null() {
+			err = r.errorf("expected null")
+		}
+	default:
+		_, err = r.number(false)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return r.buf[start:r.pos], nil
+}
+
+// array reads a JSON array, calling fn to read each element.
+func (r *jsonReader) array(fn func() error) error {
+	if r.peek() != '[' {
+		return r.errorf("expected array")
+	}
+	r.pos++
+	for first := true; ; first = false {
+		c := r.peek()
+		if c == ']' {
+			r.pos++
+			return nil
+		}
+		if !first {
+			if c != ',' {
+				return r.errorf("expected , or ]")
+			}
+			r.pos++
+		}
+		if err := fn(); err != nil {
+			return err
+		}
+	}
+}
+
+// object reads a JSON object, calling fn with each key to read its value. Key
+// is only valid during the call.
+func (r *jsonReader) object(fn func(key []byte) error) error {
+	if r.peek() != '{' {
+		return r.errorf("expected object")
+	}
+	r.pos++
+	for first := true; ; first = false {
+		c := r.peek()
+		if c == '}' {
+			r.pos++
+			return nil
+		}
+		if !first {
+			if c != ',' {
+				return r.errorf("expected , or }")
+			}
+			r.pos++
+		}
+		r.peek()
+		start := r.pos
+		plain, err := r.scanString()
+		if err != nil {
+			return err
+		}
+		key := r.buf[start+1 : r.pos-1]
+		if !plain {
+			var s string
+			if err := json.Unmarshal(r.buf[start:r.pos], &s); err != nil {
+				return err
+			}
+			key = []byte(s)
+		}
+		if r.peek() != ':' {
+			return r.errorf("expected :")
+		}
+		r.pos++
+		if err := fn(key); err != nil {
+			return err
+		}
+	}
+}
+
+`
+
+// fastJSONImports are the packages used by fastJSONCode and the generated
+// methods, besides those of the client.
+var fastJSONImports = []string{"fmt", "math", "sort", "strconv", "unicode/utf8"}
+
+// generateFastJSON writes MarshalJSON and UnmarshalJSON methods for struct t,
+// producing and accepting the same JSON as encoding/json does with the struct
+// tags of the generated type, except that object keys must match exactly.
+func (g *generator) generateFastJSON(t sherpadoc.Struct) {
+	typeName := g.typeName(t.Name)
+	g.printf(`func (v %[1]s) MarshalJSON() ([]byte, error) {
+	return v.appendJSON(nil)
+}
+
+func (v *%[1]s) appendJSON(b []byte) (_ []byte, err error) {
+	b = append(b, '{')
+`, typeName)
+	omit := map[string]bool{}
+	for _, f := range g.zeroTimeFields(t) {
+		omit[f.Name] = true
+	}
+	conversions := g.conversionFields(t, false)
+	// After a field that can be left out, whether a separator is needed is only
+	// known when encoding.
+	var dynamic bool
+	for i, f := range t.Fields {
+		what := fmt.Sprintf("field %s for type %s", f.Name, t.Name)
+		x := "v." + g.fieldName(f.Name)
+		var field string
+		if c := conversions[f.Name]; c == nil {
+			field = g.appendJSON(parseType(what, f.Typewords), x, 0, true)
+		} else if c.native {
+			field = g.appendJSON(BaseType{"any"}, x, 0, true)
+		} else {
+			field = g.appendJSON(BaseType{c.jsonType}, c.encode(x), 0, true)
+		}
+		field = indent(field, "\t")
+		if omit[f.Name] || dynamic {
+			dynamic = true
+			field = fmt.Sprintf("\tif b[len(b)-1] != '{' {\n\t\tb = append(b, ',')\n\t}\n\tb = append(b, %q...)\n", `"`+f.Name+`":`) + field
+			if omit[f.Name] {
+				field = fmt.Sprintf("\tif !%s.IsZero() {\n%s\t}\n", x, indent(field, "\t"))
+			}
+			g.printf("%s", field)
+			continue
+		}
+		sep := ","
+		if i == 0 {
+			sep = ""
+		}
+		g.printf("\tb = append(b, %q...)\n%s", sep+`"`+f.Name+`":`, field)
+	}
+	if g.opts.ExtraFields {
+		g.printf("\tif len(v.Extra) > 0 {\n\t\treturn appendExtraJSON(append(b, '}'), v.Extra)\n\t}\n")
+	}
+	g.printf(`	return append(b, '}'), nil
+}
+
+func (v *%[1]s) UnmarshalJSON(buf []byte) error {
+	r := &jsonReader{buf: buf}
+	if r.null() {
+		return nil
+	}
+	if err := v.readJSON(r); err != nil {
+		return err
+	}
+	return r.end()
+}
+
+func (v *%[1]s) readJSON(r *jsonReader) error {
+`, typeName)
+	if g.opts.ExtraFields {
+		g.printf("\tv.Extra = nil\n")
+	}
+	g.printf(`	return r.object(func(key []byte) error {
+		switch string(key) {
+`)
+	for _, f := range t.Fields {
+		what := fmt.Sprintf("field %s for type %s", f.Name, t.Name)
+		g.printf("\t\tcase %q:\n", f.Name)
+		x := "v." + g.fieldName(f.Name)
+		if c := conversions[f.Name]; c != nil && c.native {
+			g.printf("%s", indent(g.readJSON(BaseType{"any"}, x, 0, true), "\t\t\t"))
+			continue
+		} else if c != nil {
+			jt := BaseType{c.jsonType}
+			read := fmt.Sprintf("var d %s\n%s%s", c.jsonGoType(), g.readJSON(jt, "d", 0, true), c.decode(x, "d"))
+			g.printf("\t\t\tif !r.null() {\n%s\t\t\t}\n", indent(read, "\t\t\t\t"))
+			continue
+		}
+		g.printf("%s", indent(g.readJSON(parseType(what, f.Typewords), x, 0, true), "\t\t\t"))
+	}
+	if g.opts.ExtraFields {
+		g.printf(`		default:
+			raw, err := r.raw()
+			if err != nil {
+				return err
+			}
+			if v.Extra == nil {
+				v.Extra = map[string]json.RawMessage{}
+			}
+			v.Extra[string(key)] = append(json.RawMessage(nil), raw...)
+		}
+		return nil
+	})
+}
+
+`)
+		return
+	}
+	g.printf(`		default:
+			_, err := r.raw()
+			return err
+		}
+		return nil
+	})
+}
+
+`)
+}
+
+// generatePlainJSON writes a MarshalJSON method for struct t if it has fields
+// with non-nullable arrays or objects, that encodes nil values for them as
+// empty array or object, for Options.NullableSlices, fields with timestamps
+// that are left out when zero, for Options.OmitZeroTime, or fields with a
+// conversion that encoding/json does not do itself, e.g. for durations. For
+// conversions, an UnmarshalJSON method is written too.
+func (g *generator) generatePlainJSON(t sherpadoc.Struct) {
+	fixes := g.emptySliceFixes(t)
+	conversions := len(g.conversionFields(t, true)) > 0
+	if fixes == "" && len(g.zeroTimeFields(t)) == 0 && !conversions {
+		return
+	}
+	typeName := g.typeName(t.Name)
+	g.printf(`func (v %[1]s) MarshalJSON() ([]byte, error) {
+	// Without the methods of %[1]s.
+	type plain %[1]s
+%[2]s	return json.Marshal(%[3]s)
+}
+
+`, typeName, fixes, g.plainValue(t))
+	if conversions {
+		g.printf(`func (v *%[1]s) UnmarshalJSON(buf []byte) error {
+	type plain %[1]s
+%[2]s	return nil
+}
+
+`, typeName, g.plainUnmarshal(t))
+	}
+}
+
+// plainValue returns the Go expression for encoding v of struct type t as its
+// type plain without methods. Fields with zero timestamps, see zeroTimeFields,
+// and with conversions, see conversionFields, are replaced by fields of an
+// outer struct, which take precedence over embedded fields with the same JSON
+// name.
+func (g *generator) plainValue(t sherpadoc.Struct) string {
+	decls := ""
+	values := []string{"plain(v)"}
+	for _, f := range g.zeroTimeFields(t) {
+		decls += fmt.Sprintf("\t\t%s *time.Time `json:\"%s,omitempty\"`\n", g.fieldName(f.Name), f.Name)
+		values = append(values, fmt.Sprintf("omitZeroTime(v.%s)", g.fieldName(f.Name)))
+	}
+	conversions := g.conversionFields(t, true)
+	for _, f := range t.Fields {
+		if c := conversions[f.Name]; c != nil {
+			decls += fmt.Sprintf("\t\t%s %s `json:\"%s\"`\n", g.fieldName(f.Name), c.jsonGoType(), f.Name)
+			values = append(values, c.encode("v."+g.fieldName(f.Name)))
+		}
+	}
+	if decls == "" {
+		return "plain(v)"
+	}
+	return fmt.Sprintf("struct {\n\t\tplain\n%s\t}{%s}", decls, strings.Join(values, ", "))
+}
+
+// plainUnmarshal returns Go statements decoding JSON buf into v of struct type
+// t as its type plain without methods, returning errors. Fields with
+// conversions are decoded through fields of an outer struct, as for plainValue.
+func (g *generator) plainUnmarshal(t sherpadoc.Struct) string {
+	conversions := g.conversionFields(t, true)
+	if len(conversions) == 0 {
+		return "\tif err := json.Unmarshal(buf, (*plain)(v)); err != nil {\n\t\treturn err\n\t}\n"
+	}
+	var decls, sets string
+	for _, f := range t.Fields {
+		c := conversions[f.Name]
+		if c == nil {
+			continue
+		}
+		name := g.fieldName(f.Name)
+		decls += fmt.Sprintf("\t\t%s *%s `json:\"%s\"`\n", name, c.jsonGoType(), f.Name)
+		sets += fmt.Sprintf("\tif x.%s != nil {\n%s\t}\n", name, indent(c.decode("v."+name, "*x."+name), "\t\t"))
+	}
+	return fmt.Sprintf("\tx := struct {\n\t\t*plain\n%s\t}{plain: (*plain)(v)}\n\tif err := json.Unmarshal(buf, &x); err != nil {\n\t\treturn err\n\t}\n%s", decls, sets)
+}
+
+// checkPlainEmbeds checks that types embedding other types can be encoded
+// without FastJSON: a MarshalJSON method of an embedded type for zero
+// timestamps or conversions would be promoted to the type without methods.
+func (g *generator) checkPlainEmbeds() {
+	if g.opts.FastJSON {
+		return
+	}
+	for _, sec := range g.sections() {
+		for _, t := range sec.Structs {
+			for _, name := range g.embeds(t) {
+				if len(g.zeroTimeFields(g.structs[name])) > 0 {
+					panic(genError{fmt.Errorf("type %q embeds type %q with timestamps, which requires FastJSON with OmitZeroTime", t.Name, name)})
+				}
+				if len(g.conversionFields(g.structs[name], true)) > 0 {
+					panic(genError{fmt.Errorf("type %q embeds type %q with fields converted for a duration or format annotation, which requires FastJSON", t.Name, name)})
+				}
+			}
+		}
+	}
+}
+
+// emptySliceFixes returns Go statements setting the fields of struct t in v
+// with nil values for non-nullable arrays and objects to empty values, for
+// Options.NullableSlices.
+func (g *generator) emptySliceFixes(t sherpadoc.Struct) string {
+	if !g.opts.NullableSlices {
+		return ""
+	}
+	var fields []string
+	for _, f := range t.Fields {
+		what := fmt.Sprintf("field %s for type %s", f.Name, t.Name)
+		typ := parseType(what, f.Typewords)
+		if isSliceOrMap(typ) {
+			fields = append(fields, fmt.Sprintf("\tif v.%[1]s == nil {\n\t\tv.%[1]s = %[2]s{}\n\t}\n", g.fieldName(f.Name), g.goType(typ)))
+		}
+	}
+	return strings.Join(fields, "")
+}
+
+// appendJSON returns Go statements appending the JSON encoding of x, an
+// addressable expression of type t, to b. Errors are returned with the
+// result parameter err. If quoted, 64-bit integers are written as strings, as
+// for struct fields with a ",string" tag. Depth is used to name loop variables.
+func (g *generator) appendJSON(t Type, x string, depth int, quoted bool) string {
+	check := func(s string) string {
+		return fmt.Sprintf("if b, err = %s; err != nil {\n\treturn nil, err\n}\n", s)
+	}
+	switch t := t.(type) {
+	case BaseType:
+		switch t.Name {
+		case "any":
+			return check(fmt.Sprintf("appendJSONValue(b, %s)", x))
+		case "bool":
+			return fmt.Sprintf("b = strconv.AppendBool(b, %s)\n", x)
+		case "int8", "int16", "int32", "int64":
+			return fmt.Sprintf("b = strconv.AppendInt(b, int64(%s), 10)\n", x)
+		case "uint8", "uint16", "uint32", "uint64":
+			return fmt.Sprintf("b = strconv.AppendUint(b, uint64(%s), 10)\n", x)
+		case "int64s", "uint64s":
+			fn := "AppendInt"
+			if t.Name == "uint64s" {
+				fn = "AppendUint"
+			}
+			if !quoted {
+				return fmt.Sprintf("b = strconv.%s(b, %s, 10)\n", fn, x)
+			}
+			return fmt.Sprintf("b = append(b, '\"')\nb = strconv.%s(b, %s, 10)\nb = append(b, '\"')\n", fn, x)
+		case "float32", "float64":
+			return check(fmt.Sprintf("appendJSONFloat(b, float64(%s), %s)", x, strings.TrimPrefix(t.Name, "float")))
+		case "string":
+			return fmt.Sprintf("b = appendJSONString(b, %s)\n", x)
+		case "timestamp":
+			return check(fmt.Sprintf("appendJSONTime(b, %s)", x))
+		}
+	case NullableType:
+		elem := "(*" + x + ")"
+		if g.nilIsNull(t) {
+			elem = x
+		}
+		return fmt.Sprintf("if %s == nil {\n\tb = append(b, \"null\"...)\n} else {\n%s}\n", x, indent(g.appendJSON(t.Type, elem, depth, quoted), "\t"))
+	case ArrayType:
+		i := fmt.Sprintf("i%d", depth)
+		return fmt.Sprintf(`if %[1]s == nil {
+	b = append(b, %[4]s...)
+} else {
+	b = append(b, '[')
+	for %[2]s := range %[1]s {
+		if %[2]s > 0 {
+			b = append(b, ',')
+		}
+%[3]s	}
+	b = append(b, ']')
+}
+`, x, i, indent(g.appendJSON(t.Type, x+"["+i+"]", depth+1, false), "\t\t"), g.nilJSON(t))
+	case ObjectType:
+		// Keys are sorted, like encoding/json does.
+		k := fmt.Sprintf("k%d", depth)
+		e := fmt.Sprintf("e%d", depth)
+		return fmt.Sprintf(`if %[1]s == nil {
+	b = append(b, %[5]s...)
+} else {
+	keys := make([]string, 0, len(%[1]s))
+	for k := range %[1]s {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	b = append(b, '{')
+	for i, %[2]s := range keys {
+		if i > 0 {
+			b = append(b, ',')
+		}
+		b = appendJSONString(b, %[2]s)
+		b = append(b, ':')
+		%[3]s := %[1]s[%[2]s]
+%[4]s	}
+	b = append(b, '}')
+}
+`, x, k, e, indent(g.appendJSON(t.Value, e, depth+1, false), "\t\t"), g.nilJSON(t))
+	case IdentType:
+		switch {
+		case g.structs[t.Name].Name != "":
+			return check(fmt.Sprintf("%s.appendJSON(b)", x))
+		case g.ints[t.Name].Name != "":
+			return fmt.Sprintf("b = strconv.AppendInt(b, int64(%s), 10)\n", x)
+		default:
+			return fmt.Sprintf("b = appendJSONString(b, string(%s))\n", x)
+		}
+	}
+	panic(genError{fmt.Errorf("no JSON encoding for type %s", g.goType(t))})
+}
+
+// nilJSON returns the JSON for a nil value of array or object type t, as Go
+// string literal. Without Options.NullableSlices, nil values are encoded as null,
+// like encoding/json does. With it, null is only used for nullable types, with
+// nilIsNull.
+func (g *generator) nilJSON(t Type) string {
+	if !g.opts.NullableSlices {
+		return `"null"`
+	}
+	if _, ok := t.(ArrayType); ok {
+		return `"[]"`
+	}
+	return `"{}"`
+}
+
+// readJSON returns Go statements reading a JSON value of type t from r into x,
+// an addressable expression, returning errors, like encoding/json. Quoted and
+// depth are as for appendJSON.
+func (g *generator) readJSON(t Type, x string, depth int, quoted bool) string {
+	read := func(s string) string {
+		return fmt.Sprintf("if !r.null() {\n\tif val, err := %s; err != nil {\n\t\treturn err\n\t} else {\n\t\t%s = %s(val)\n\t}\n}\n", s, x, g.goType(t))
+	}
+	switch t := t.(type) {
+	case BaseType:
+		switch t.Name {
+		case "any":
+			return fmt.Sprintf("if val, err := r.raw(); err != nil {\n\treturn err\n} else if err := json.Unmarshal(val, &%s); err != nil {\n\treturn err\n}\n", x)
+		case "bool":
+			return read("r.boolean()")
+		case "int8", "int16", "int32", "int64":
+			return read(fmt.Sprintf("r.int(%s, false)", strings.TrimPrefix(t.Name, "int")))
+		case "uint8", "uint16", "uint32", "uint64":
+			return read(fmt.Sprintf("r.uint(%s, false)", strings.TrimPrefix(t.Name, "uint")))
+		case "int64s":
+			return read(fmt.Sprintf("r.int(64, %v)", quoted))
+		case "uint64s":
+			return read(fmt.Sprintf("r.uint(64, %v)", quoted))
+		case "float32", "float64":
+			return read(fmt.Sprintf("r.float(%s)", strings.TrimPrefix(t.Name, "float")))
+		case "string":
+			return read("r.str()")
+		case "timestamp":
+			return fmt.Sprintf("if !r.null() {\n\tif val, err := r.raw(); err != nil {\n\t\treturn err\n\t} else if err := %s.UnmarshalJSON(val); err != nil {\n\t\treturn err\n\t}\n}\n", x)
+		}
+	case NullableType:
+		if g.nilIsNull(t) {
+			return g.readJSON(t.Type, x, depth, quoted)
+		}
+		return fmt.Sprintf(`if r.null() {
+	%[1]s = nil
+} else {
+	if %[1]s == nil {
+		%[1]s = new(%[2]s)
+	}
+%[3]s}
+`, x, g.goType(t.Type), indent(g.readJSON(t.Type, "(*"+x+")", depth, quoted), "\t"))
+	case ArrayType:
+		e := fmt.Sprintf("e%d", depth)
+		return fmt.Sprintf(`if r.null() {
+	%[1]s = nil
+} else {
+	%[1]s = %[2]s{}
+	err := r.array(func() error {
+		var %[3]s %[4]s
+%[5]s		%[1]s = append(%[1]s, %[3]s)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+}
+`, x, g.goType(t), e, g.goType(t.Type), indent(g.readJSON(t.Type, e, depth+1, false), "\t\t"))
+	case ObjectType:
+		e := fmt.Sprintf("e%d", depth)
+		return fmt.Sprintf(`if r.null() {
+	%[1]s = nil
+} else {
+	if %[1]s == nil {
+		%[1]s = %[2]s{}
+	}
+	err := r.object(func(key []byte) error {
+		var %[3]s %[4]s
+%[5]s		%[1]s[string(key)] = %[3]s
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+}
+`, x, g.goType(t), e, g.goType(t.Value), indent(g.readJSON(t.Value, e, depth+1, false), "\t\t"))
+	case IdentType:
+		switch {
+		case g.structs[t.Name].Name != "":
+			return fmt.Sprintf("if !r.null() {\n\tif err := %s.readJSON(r); err != nil {\n\t\treturn err\n\t}\n}\n", x)
+		case g.ints[t.Name].Name != "":
+			return read("r.int(0, false)")
+		default:
+			return read("r.str()")
+		}
+	}
+	panic(genError{fmt.Errorf("no JSON decoding for type %s", g.goType(t))})
+}
+
+// indent returns code with prefix added to each non-empty line.
+func indent(code, prefix string) string {
+	lines := strings.SplitAfter(code, "\n")
+	for i, line := range lines {
+		if line != "" && line != "\n" {
+			lines[i] = prefix + line
+		}
+	}
+	return strings.Join(lines, "")
+}
@@ -0,0 +1,179 @@
+package sherpago
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// GenerateMobile reads sherpadoc from in and writes a Go file to out with a
+// Mobile type, wrapping the client for use with "gomobile bind". Its methods
+// have no context parameter, and parameters and results with types that
+// gomobile cannot represent, like slices, maps and structs, are JSON text, as in
+// sherpa requests and responses. Functions with multiple results return a JSON
+// array. The file must be placed in the package generated by Generate, with the
+// same packageName.
+func GenerateMobile(in io.Reader, out io.Writer, packageName string) (retErr error) {
+	defer recoverGenError(&retErr)
+
+	g := newGenerator(readDoc(in), out, Options{PackageName: packageName, Mobile: true})
+	g.generateMobile()
+	return nil
+}
+
+func (g *generator) generateMobile() {
+	if g.opts.Unexported {
+		panic(genError{fmt.Errorf("cannot generate mobile wrapper for unexported client")})
+	}
+	g.checkNames()
+
+	errorType := "sherpa.Error"
+	imports := []string{"context", "encoding/json", "errors", "fmt", "time"}
+	if g.opts.NoSherpaDep {
+		errorType = "Error"
+	} else {
+		imports = append(imports, "github.com/mjl-/sherpa")
+	}
+	g.printf("package %s\n\n", g.opts.PackageName)
+	g.printImports(imports)
+	g.printf(`var _ time.Time // in case "timestamp" is used
+var _ = json.Marshal
+var _ = fmt.Errorf
+
+// Mobile wraps %[1]s for use with gomobile bind. Its methods have no context
+// parameter, and parameters and results of types gomobile cannot represent
+// are JSON text, as in sherpa requests and responses.
+type Mobile struct {
+	c *%[1]s
+}
+
+// NewMobile returns a Mobile with a new client for baseURL, or for the default
+// base URL if empty.
+func NewMobile(baseURL string) *Mobile {
+	c := %[2]s()
+	if baseURL != "" {
+		c.BaseURL = baseURL
+	}
+	return &Mobile{c}
+}
+
+// MobileErrorCode returns the sherpa error code of err, e.g. "user:notFound",
+// or the empty string if err is not a sherpa error.
+func MobileErrorCode(err error) string {
+	var e *%[3]s
+	if errors.As(err, &e) {
+		return e.Code
+	}
+	return ""
+}
+
+`, g.clientName(), g.newClientName(), errorType)
+
+	for _, sec := range g.sections() {
+		for _, fn := range sec.Functions {
+			whatParam := "parameter for " + fn.Name
+			name := g.goName(fn.Name)
+
+			// Single results of types gomobile can represent are returned directly,
+			// others as JSON.
+			var resultType, zero string
+			direct := false
+			if len(fn.Returns) == 1 {
+				resultType, _ = g.mobileType(parseType(whatParam, fn.Returns[0].Typewords))
+				direct = resultType != ""
+			}
+			if len(fn.Returns) > 0 && !direct {
+				resultType = "string"
+			}
+			switch resultType {
+			case "":
+			case "bool":
+				zero = "false, "
+			case "string":
+				zero = `"", `
+			default:
+				zero = "0, "
+			}
+
+			var params, args []string
+			decodes := ""
+			locals := g.goParamNames(fn)
+			for i, p := range fn.Params {
+				typ := parseType(whatParam, p.Typewords)
+				local := locals[i]
+				if mt, conv := g.mobileType(typ); mt != "" {
+					params = append(params, local+" "+mt)
+					args = append(args, fmt.Sprintf(conv, local))
+					continue
+				}
+				params = append(params, local+"JSON string")
+				args = append(args, local)
+				decodes += fmt.Sprintf(`	var %[1]s %[2]s
+	if err := json.Unmarshal([]byte(%[1]sJSON), %[3]s); err != nil {
+		return %[4]sfmt.Errorf("parsing parameter %[5]s: %%w", err)
+	}
+`, local, g.goType(typ), jsonRef(typ, local), zero, p.Name)
+			}
+			call := fmt.Sprintf("c.c.%s(%s)", name, strings.Join(append([]string{"context.Background()"}, args...), ", "))
+
+			g.printf("// %s calls %s.%s, see its documentation.\n", name, g.clientName(), name)
+			if resultType == "" {
+				g.printf("func (c *Mobile) %s(%s) error {\n%s\treturn %s\n}\n\n", name, strings.Join(params, ", "), decodes, call)
+				continue
+			}
+			g.printf("func (c *Mobile) %s(%s) (%s, error) {\n%s", name, strings.Join(params, ", "), resultType, decodes)
+			if direct {
+				g.printf("\tr0, err := %s\n\treturn %s(r0), err\n}\n\n", call, resultType)
+				continue
+			}
+
+			var fields, names, values []string
+			for i, r := range fn.Returns {
+				typ := parseType(whatParam, r.Typewords)
+				fields = append(fields, fmt.Sprintf("R%d %s", i, g.goType(typ)))
+				names = append(names, fmt.Sprintf("result.R%d", i))
+				values = append(values, jsonValue(typ, fmt.Sprintf("result.R%d", i)))
+			}
+			value := values[0]
+			if len(values) > 1 {
+				value = "[]interface{}{" + strings.Join(values, ", ") + "}"
+			}
+			g.printf(`	var result struct {
+		%s
+	}
+	var err error
+	%s, err = %s
+	if err != nil {
+		return "", err
+	}
+	r0, err := json.Marshal(%s)
+	return string(r0), err
+}
+
+`, strings.Join(fields, "\n\t\t"), strings.Join(names, ", "), call, value)
+		}
+	}
+
+	g.flush()
+}
+
+// mobileType returns the Go type for t in the signatures of Mobile methods, with
+// a format string converting a value of that type to t, or the empty string if
+// gomobile cannot represent t and JSON must be used.
+func (g *generator) mobileType(t Type) (string, string) {
+	switch t := t.(type) {
+	case BaseType:
+		switch t.Name {
+		case "bool", "int8", "int16", "int32", "int64", "int64s", "float32", "float64", "string":
+			return g.goType(t), "%s"
+		}
+	case IdentType:
+		if _, ok := g.ints[t.Name]; ok {
+			return "int", g.goType(t) + "(%s)"
+		}
+		if _, ok := g.strs[t.Name]; ok {
+			return "string", g.goType(t) + "(%s)"
+		}
+	}
+	return "", ""
+}
@@ -0,0 +1,41 @@
+package sherpago
+
+// Version of github.com/mjl-/sherpa required by generated modules, with the
+// go.sum lines for it and its dependency github.com/mjl-/sherpadoc.
+const (
+	sherpaModuleVersion = "v0.6.0"
+	sherpaModuleSum     = `github.com/mjl-/sherpa v0.6.0 h1:lNu86b3htqJVhftOOxAxJwfIZ5Xuo6lz1ifiZZ096Do=
+github.com/mjl-/sherpa v0.6.0/go.mod h1:dSpAOdgpwdqQZ72O4n3EHo/tR68eKyan8tYYraUMPNc=
+github.com/mjl-/sherpadoc v0.0.0-20190505200843-c0a7f43f5f1d h1:Y7GWrib5DOJYNlJkP4Dmq/nlR1hRDya86Xa2rg8N/vI=
+github.com/mjl-/sherpadoc v0.0.0-20190505200843-c0a7f43f5f1d/go.mod h1:5khTKxoKKNXcB8bkVUO6GlzC7PFtMmkHq578lPbmnok=
+`
+)
+
+// generateGoMod writes a go.mod for a module with the generated package at its
+// root.
+func (g *generator) generateGoMod() {
+	// The generated code uses standard library functions added in Go 1.16,
+	// package net/netip of Go 1.18 for fields with format "ip", and iterators of
+	// Go 1.23 for IterMethods.
+	version := "1.16"
+	for _, imp := range g.formatImports() {
+		if imp == "net/netip" {
+			version = "1.18"
+		}
+	}
+	if g.opts.IterMethods {
+		version = "1.23"
+	}
+	g.printf("module %s\n\ngo %s\n", g.opts.ModulePath, version)
+	if !g.opts.NoSherpaDep {
+		g.printf("\nrequire github.com/mjl-/sherpa %s\n", sherpaModuleVersion)
+	}
+	g.flush()
+}
+
+// generateGoSum writes the go.sum for the go.mod from generateGoMod, only
+// needed when the sherpa package is required.
+func (g *generator) generateGoSum() {
+	g.printf("%s", sherpaModuleSum)
+	g.flush()
+}
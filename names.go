@@ -0,0 +1,714 @@
+package sherpago
+
+import (
+	"fmt"
+	"path"
+	"strings"
+	"unicode"
+
+	"github.com/mjl-/sherpadoc"
+)
+
+// Predeclared identifiers in Go. Unexported names and parameters must not shadow
+// them.
+var predeclared = map[string]struct{}{
+	"any": {}, "append": {}, "bool": {}, "byte": {}, "cap": {}, "clear": {}, "close": {},
+	"comparable": {}, "complex": {}, "complex128": {}, "complex64": {}, "copy": {}, "delete": {},
+	"error": {}, "false": {}, "float32": {}, "float64": {}, "imag": {}, "int": {}, "int16": {},
+	"int32": {}, "int64": {}, "int8": {}, "iota": {}, "len": {}, "make": {}, "max": {}, "min": {},
+	"new": {}, "nil": {}, "panic": {}, "print": {}, "println": {}, "real": {}, "recover": {},
+	"rune": {}, "string": {}, "true": {}, "uint": {}, "uint16": {}, "uint32": {}, "uint64": {},
+	"uint8": {}, "uintptr": {},
+}
+
+func goExportedName(name string) string {
+	return lintName(strings.ToUpper(name[:1]) + name[1:])
+}
+
+// exportedName returns name as exported Go identifier like goExportedName, or
+// with only the first letter changed to upper case with Options.NoLintNames.
+func (g *generator) exportedName(name string) string {
+	if g.opts.NoLintNames {
+		return strings.ToUpper(name[:1]) + name[1:]
+	}
+	return goExportedName(name)
+}
+
+// Local variables, and packages, used in the generated client methods,
+// parameters must not use these names.
+var methodLocals = map[string]struct{}{
+	"c":        {},
+	"ctx":      {},
+	"err":      {},
+	"r0":       {},
+	"result":   {},
+	"e":        {}, // For the iterator methods, see Options.IterMethods.
+	"yield":    {},
+	"zero":     {},
+	"context":  {}, // Package, for the NoCtx and Await methods, see Options.NoCtxMethods.
+	"pollOpts": {}, // For the Await methods, see the "await" annotation.
+	"raw":      {}, // For the Raw methods, see Options.RawMethods.
+	"json":     {}, // Package, for the Raw and Mobile methods.
+	"fmt":      {}, // Package, for the Mobile methods, see Options.Mobile.
+	"time":     {}, // Package, for results of type timestamp.
+}
+
+// goParamNames returns the names of the parameters of fn as local Go
+// identifiers. Local names could be Go keywords, predeclared identifiers, local
+// variables of client methods, names of types with Options.Unexported, or the
+// same as the name of another parameter. If they are, a number is appended,
+// making them unique among the parameters and not reserved.
+func (g *generator) goParamNames(fn *sherpadoc.Function) []string {
+	names := make([]string, len(fn.Params))
+	taken := map[string]bool{}
+	for i, p := range fn.Params {
+		if r := strings.ToLower(p.Name[:1]) + p.Name[1:]; !taken[r] && !g.isReservedLocal(r) {
+			names[i] = r
+			taken[r] = true
+		}
+	}
+	for i, p := range fn.Params {
+		if names[i] != "" {
+			continue
+		}
+		r := strings.ToLower(p.Name[:1]) + p.Name[1:]
+		for j := 0; names[i] == ""; j++ {
+			if nr := fmt.Sprintf("%s%d", r, j); !taken[nr] && !g.isReservedLocal(nr) {
+				names[i] = nr
+				taken[nr] = true
+			}
+		}
+	}
+	return names
+}
+
+// isReservedLocal returns whether name cannot be used for a parameter of a
+// method, see goParamNames.
+func (g *generator) isReservedLocal(name string) bool {
+	_, isKeyword := keywords[name]
+	_, isPredeclared := predeclared[name]
+	_, isLocal := methodLocals[name]
+	return isKeyword || isPredeclared || isLocal || g.isTypeName(name)
+}
+
+// unexportedName returns name, an exported Go identifier, with its leading upper
+// case letters turned to lower case, keeping initialisms together, e.g.
+// "HTTPServer" becomes "httpServer" and "IDs" becomes "ids". Names that would be
+// keywords or predeclared identifiers get a "0" appended.
+func unexportedName(name string) string {
+	r := lowerInitial(name)
+	_, isKeyword := keywords[r]
+	_, isPredeclared := predeclared[r]
+	if isKeyword || isPredeclared {
+		r += "0"
+	}
+	return r
+}
+
+// lowerInitial returns name with its leading upper case letters turned to lower
+// case, as unexportedName does.
+func lowerInitial(name string) string {
+	runes := []rune(name)
+	n := 0
+	for n < len(runes) && unicode.IsUpper(runes[n]) {
+		n++
+	}
+	if n > 1 && n < len(runes) && unicode.IsLower(runes[n]) {
+		// The last upper case letter starts the next word, unless the whole run is an
+		// initialism followed by e.g. a plural "s".
+		if commonInitialisms[string(runes[:n-1])] || !commonInitialisms[string(runes[:n])] {
+			n--
+		}
+	}
+	return strings.ToLower(string(runes[:n])) + string(runes[n:])
+}
+
+// fieldName returns the Go name of a struct field from the sherpadoc, see
+// Options.FieldNames.
+func (g *generator) fieldName(name string) string {
+	switch g.opts.FieldNames {
+	case FieldNamesCamel, FieldNamesLowerCamel:
+		return camelName(name, !g.opts.NoLintNames)
+	}
+	return g.exportedName(name)
+}
+
+// camelName returns the words in name, separated by other characters than
+// letters and digits, as an exported Go identifier, for FieldNamesCamel.
+func camelName(name string, lint bool) string {
+	s := joinWords(name, lint)
+	if s == "" || !unicode.IsLetter([]rune(s)[0]) {
+		s = "X" + s
+	}
+	return s
+}
+
+// lowerCamelName returns name in lower camel case, for FieldNamesLowerCamel.
+func lowerCamelName(name string, lint bool) string {
+	return lowerInitial(joinWords(name, lint))
+}
+
+// joinWords returns the words in name, separated by other characters than
+// letters and digits, joined with each starting with an upper case letter, with
+// changes like golint if lint is set.
+func joinWords(name string, lint bool) string {
+	words := strings.FieldsFunc(name, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	s := ""
+	for _, w := range words {
+		runes := []rune(w)
+		s += string(unicode.ToUpper(runes[0])) + string(runes[1:])
+	}
+	if !lint {
+		return s
+	}
+	return lintName(s)
+}
+
+// goName returns the Go identifier for a function from the sherpadoc. It is
+// exported, unless Options.Unexported is set.
+func (g *generator) goName(name string) string {
+	r := g.exportedName(stripPrefix(name, g.opts.StripPrefix))
+	if g.opts.Unexported {
+		r = unexportedName(r)
+	}
+	return r
+}
+
+// isTypeName returns whether name is the Go identifier of a type from the
+// sherpadoc. Only unexported type names can be the same as local names.
+func (g *generator) isTypeName(name string) bool {
+	if !g.opts.Unexported {
+		return false
+	}
+	var names []string
+	for n := range g.structs {
+		names = append(names, n)
+	}
+	for n := range g.ints {
+		names = append(names, n)
+	}
+	for n := range g.strs {
+		names = append(names, n)
+	}
+	for _, n := range names {
+		if g.typeName(n) == name {
+			return true
+		}
+	}
+	return false
+}
+
+// stripPrefix returns function name without prefix, e.g. "addDomain" for
+// "adminAddDomain" with prefix "admin". Name is returned unchanged if the rest
+// does not start with an upper case letter, as for "administer", or is empty.
+func stripPrefix(name, prefix string) string {
+	rest := strings.TrimPrefix(name, prefix)
+	if prefix == "" || rest == name || rest == "" || !unicode.IsUpper([]rune(rest)[0]) {
+		return name
+	}
+	return rest
+}
+
+// sectionPrefix returns the prefix for the Go names of types in section name,
+// for Options.SectionPrefix. Each word in name starts with an upper case letter,
+// other characters than letters and digits are removed.
+func sectionPrefix(name string) string {
+	words := strings.FieldsFunc(name, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	s := ""
+	for _, w := range words {
+		s += strings.ToUpper(w[:1]) + w[1:]
+	}
+	if s == "" {
+		return ""
+	}
+	return lintName(s)
+}
+
+// exportedTypeName returns the exported Go name of a type or enum value, as
+// typeName does without Options.Unexported.
+func (g *generator) exportedTypeName(name string) string {
+	return g.typePrefixes[name] + g.exportedName(name)
+}
+
+// typeName returns the Go identifier for a type or enum value from the
+// sherpadoc, like goName, but prefixed with the names of its sections with
+// Options.SectionPrefix. All references to types must use this name.
+func (g *generator) typeName(name string) string {
+	r := g.exportedTypeName(name)
+	if g.opts.Unexported {
+		r = unexportedName(r)
+	}
+	return r
+}
+
+// Exported identifiers of the generated client, in addition to the types from
+// the sherpadoc. They are unexported with Options.Unexported, see clientIdent.
+var clientIdents = []string{
+	"Client",
+	"NewClient",
+	"NewClientFromEnv",
+	"ClientOption",
+	"TransportTuning",
+	"WithTransportTuning",
+	"WithDialContext",
+	"WithResolvedAddr",
+	"WithProxy",
+	"WithNoProxy",
+	"WithStrictTLS",
+	"WithDebugLog",
+	"WithRedaction",
+	"AuditHook",
+	"AuditEvent",
+	"WithAudit",
+	"AuditContext",
+	"ValidationError",
+	"WithHeaders",
+	"HeaderContext",
+	"WithLocale",
+	"WithTimeoutHeader",
+	"ContentEncoding",
+	"GzipEncoding",
+	"WithContentEncodings",
+	"WithSingleFlight",
+	"WithHedging",
+	"RetryPolicy",
+	"WithRetries",
+	"FunctionStats",
+	"WithStats",
+	"WithExpvar",
+	"WithMaxConcurrent",
+	"WithUnauthorized",
+	"WithStatusHandler",
+	"WithDrainLimit",
+	"Deprecation",
+	"WithDeprecationHook",
+	"RedirectPolicy",
+	"WithRedirectPolicy",
+	"PollOptions",
+	"WithWebSocket",
+	"Transport",
+	"WithTransport",
+	"NATSTransport",
+	"NewNATSTransport",
+	"Codec",
+	"CBORCodec",
+	"MessagePackCodec",
+	"WithCodec",
+	"WithErrorTranslation",
+	"BaseURLContext",
+	"WithOrigin",
+	"CredentialProvider",
+	"WithCredentials",
+	"Credentials",
+	"CredentialFile",
+	"DefaultCredentialFile",
+	"WriteCredentialFile",
+	"KeyringCredentials",
+	"FunctionInfo",
+	"ParamInfo",
+	"SchemaDrift",
+	"WithSchemaDrift",
+}
+
+// checkNames checks that the names for types, enum values and functions do not
+// conflict with identifiers of the generated client, or with names of other
+// APIs in the package, see Options.APIs.
+func (g *generator) checkNames() {
+	// Methods of the client, besides those for the functions.
+	methods := map[string]struct{}{
+		"call":                 {},
+		"functionURL":          {},
+		"requestHeader":        {},
+		"Close":                {},
+		"CloseIdleConnections": {},
+		"withTransport":        {},
+		"With":                 {},
+		"subscribe":            {},
+		"connectEvents":        {},
+		"Stats":                {},
+	}
+	reserved := map[string]struct{}{
+		"callInfo":            {},
+		"jsonInt64s":          {},
+		"jsonUint64s":         {},
+		"requestParams":       {},
+		"requestBuffer":       {},
+		"requestBuffers":      {},
+		"bufferBody":          {},
+		"encodeRequest":       {},
+		"decodeResult":        {},
+		"redactJSON":          {},
+		"redactValue":         {},
+		"redactEntry":         {},
+		"auditCallerKey":      {},
+		"auditCaller":         {},
+		"headerContextKey":    {},
+		"setHeaders":          {},
+		"timeoutValue":        {},
+		"contentEncodings":    {},
+		"compressBody":        {},
+		"flightGroup":         {},
+		"flight":              {},
+		"doHedged":            {},
+		"callAttempt":         {},
+		"retrier":             {},
+		"retryBudget":         {},
+		"callStats":           {},
+		"functionCounters":    {},
+		"latencyBucket":       {},
+		"cancelBody":          {},
+		"awaitPoll":           {},
+		"readEvents":          {},
+		"webSocket":           {},
+		"wsConn":              {},
+		"natsHandshake":       {},
+		"codecFromJSON":       {},
+		"codecToJSON":         {},
+		"codecDecoder":        {},
+		"appendBigEndian":     {},
+		"cborHead":            {},
+		"cborAppend":          {},
+		"msgpackHead":         {},
+		"msgpackAppend":       {},
+		"halfFloat":           {},
+		"unauthorized":        {},
+		"fileProvider":        {},
+		"clientCloser":        {},
+		"keyringProvider":     {},
+		"baseURLContextKey":   {},
+		"schemaValue":         {},
+		"driftResult":         {},
+		"responseDeprecation": {},
+	}
+	if g.mainClient != "" {
+		// The other identifiers are those of the main client, in pkgNames.
+		reserved[g.clientName()] = struct{}{}
+		reserved[g.newClientName()] = struct{}{}
+	} else {
+		for _, name := range clientIdents {
+			reserved[g.clientIdent(name)] = struct{}{}
+		}
+	}
+	for name := range g.pkgNames {
+		reserved[name] = struct{}{}
+	}
+	if g.opts.FastJSON {
+		// Helpers, and local variables of the generated methods.
+		for _, name := range []string{"appendJSONString", "appendJSONFloat", "appendJSONTime", "appendJSONValue", "jsonReader", "b", "e0", "i", "k", "key", "keys", "r", "v", "val"} {
+			reserved[name] = struct{}{}
+		}
+	}
+	if g.opts.Mobile {
+		for _, name := range []string{"Mobile", "NewMobile", "MobileErrorCode"} {
+			reserved[name] = struct{}{}
+		}
+	}
+	if g.opts.Validate {
+		// Local variables of the validate methods.
+		for _, name := range []string{"v", "verr", "i0", "e0"} {
+			reserved[name] = struct{}{}
+		}
+	}
+	if g.opts.OrZero {
+		// Receiver of the OrZero methods.
+		reserved["v"] = struct{}{}
+	}
+	if g.opts.ExtraFields {
+		g.checkExtraFields()
+		reserved["appendExtraJSON"] = struct{}{}
+		reserved["plain"] = struct{}{}
+	}
+	conversions := g.hasConversions(!g.opts.FastJSON)
+	if (g.opts.NullableSlices || g.opts.OmitZeroTime || conversions) && !g.opts.FastJSON {
+		reserved["plain"] = struct{}{}
+		reserved["v"] = struct{}{}
+	}
+	if conversions {
+		// Local variables of the methods decoding converted fields.
+		reserved["x"] = struct{}{}
+		reserved["d"] = struct{}{}
+		reserved["mac"] = struct{}{}
+		reserved["u"] = struct{}{}
+	}
+	if g.opts.OmitZeroTime {
+		reserved["omitZeroTime"] = struct{}{}
+	}
+	for option, s := range g.typeOptions() {
+		if imp, _ := g.optionType(option, s); imp != "" {
+			reserved[path.Base(imp)] = struct{}{}
+		}
+	}
+	g.checkPlainEmbeds()
+	if g.opts.SchemaDrift {
+		reserved[g.driftStructsVar()] = struct{}{}
+		reserved["checkDrift"] = struct{}{}
+	}
+	if g.opts.Catalog {
+		methods["Functions"] = struct{}{}
+		methods["DynamicCall"] = struct{}{}
+		reserved[g.catalogVar()] = struct{}{}
+		reserved["dynamicParams"] = struct{}{}
+		reserved["dynamicCall"] = struct{}{}
+	}
+	for _, sec := range g.sections() {
+		for _, fn := range sec.Functions {
+			reserved["params"+g.funcSuffix(fn.Name)] = struct{}{}
+			reserved["result"+g.funcSuffix(fn.Name)] = struct{}{}
+			if g.opts.Validate {
+				reserved["validateParams"+g.funcSuffix(fn.Name)] = struct{}{}
+				reserved["validateResult"+g.funcSuffix(fn.Name)] = struct{}{}
+			}
+			if g.opts.NoCtxMethods {
+				methods[g.goName(fn.Name)+"NoCtx"] = struct{}{}
+			}
+			if g.opts.RawMethods {
+				methods[g.goName(fn.Name)+"Raw"] = struct{}{}
+			}
+			if g.await(fn) != "" {
+				methods[g.awaitName(fn)] = struct{}{}
+			}
+			if path, _ := g.events(fn); path != "" {
+				methods[g.subscribeName(fn.Name)] = struct{}{}
+			}
+			if g.hasIter(fn) {
+				methods[g.iterName(fn)] = struct{}{}
+			}
+		}
+	}
+	check := func(goName, name string, names map[string]struct{}) {
+		if _, ok := names[goName]; ok {
+			panic(genError{fmt.Errorf("name %q for %q conflicts with generated client", goName, name)})
+		}
+	}
+	// Different sherpadoc names can become the same Go name, e.g. with
+	// SectionPrefix.
+	types := map[string]string{}
+	funcs := map[string]string{}
+	var defaults []string // Structs with a function returning a value with defaults.
+	var enums []string    // Enums with helper functions.
+	var unknowns []string // Enums with an Unknown constant.
+	var unions []string   // Unions with an interface for their variants.
+	var events []string   // Functions with an Event type.
+	checkType := func(name string) {
+		if g.isType(name) {
+			g.typeAnnotations(name)
+		}
+		goName := g.typeName(name)
+		check(goName, name, reserved)
+		if other, ok := types[goName]; ok {
+			panic(genError{fmt.Errorf("name %q for %q conflicts with the name for %q", goName, name, other)})
+		}
+		types[goName] = name
+	}
+	for _, sec := range g.sections() {
+		for _, t := range sec.Structs {
+			if g.sharedTypes[t.Name] {
+				continue
+			}
+			checkType(t.Name)
+			hasDefaults := g.fieldDefaults(t) != ""
+			for _, f := range t.Fields {
+				if g.opts.OrZero && g.fieldName(f.Name) == "OrZero" {
+					panic(genError{fmt.Errorf("field %q of type %q conflicts with method OrZero", f.Name, t.Name)})
+				}
+				if hasDefaults && g.fieldName(f.Name) == "SetDefaults" {
+					panic(genError{fmt.Errorf("field %q of type %q conflicts with method SetDefaults", f.Name, t.Name)})
+				}
+			}
+			if hasDefaults {
+				defaults = append(defaults, t.Name)
+			}
+			if g.union(t.Name) != nil {
+				unions = append(unions, t.Name)
+			}
+		}
+		for _, t := range sec.Ints {
+			if g.sharedTypes[t.Name] {
+				continue
+			}
+			checkType(t.Name)
+			if g.opts.EnumHelpers {
+				enums = append(enums, t.Name)
+			}
+			if g.opts.EnumUnknown && !g.isBitmask(t.Name) {
+				unknowns = append(unknowns, t.Name)
+			}
+			for _, v := range t.Values {
+				checkType(v.Name)
+			}
+		}
+		for _, t := range sec.Strings {
+			if g.sharedTypes[t.Name] {
+				continue
+			}
+			checkType(t.Name)
+			if g.opts.EnumHelpers {
+				enums = append(enums, t.Name)
+			}
+			if g.opts.EnumUnknown {
+				unknowns = append(unknowns, t.Name)
+			}
+			for _, v := range t.Values {
+				checkType(v.Name)
+				if g.opts.EnumUnknown && v.Value == "" {
+					panic(genError{fmt.Errorf("value %q of type %q is the empty string, which is the value for unknown values", v.Name, t.Name)})
+				}
+			}
+		}
+		for _, fn := range sec.Functions {
+			goName := g.goName(fn.Name)
+			check(goName, fn.Name, methods)
+			if other, ok := funcs[goName]; ok {
+				panic(genError{fmt.Errorf("name %q for function %q conflicts with the name for %q", goName, fn.Name, other)})
+			}
+			funcs[goName] = fn.Name
+			if path, _ := g.events(fn); path != "" {
+				events = append(events, fn.Name)
+			}
+		}
+	}
+	for _, name := range defaults {
+		goName := g.defaultsFuncName(name)
+		check(goName, name, reserved)
+		if other, ok := types[goName]; ok {
+			panic(genError{fmt.Errorf("name %q for the defaults of %q conflicts with the name for %q", goName, name, other)})
+		}
+		types[goName] = name
+	}
+	for _, name := range unions {
+		goName := g.unionVariantName(name)
+		check(goName, name, reserved)
+		if other, ok := types[goName]; ok {
+			panic(genError{fmt.Errorf("name %q for the variants of %q conflicts with the name for %q", goName, name, other)})
+		}
+		types[goName] = name
+	}
+	for _, name := range events {
+		goName := g.eventName(name)
+		check(goName, name, reserved)
+		if other, ok := types[goName]; ok {
+			panic(genError{fmt.Errorf("name %q for the events of function %q conflicts with the name for %q", goName, name, other)})
+		}
+		types[goName] = name
+	}
+	for _, name := range enums {
+		for _, goName := range []string{g.enumValuesName(name), g.enumByNameName(name)} {
+			check(goName, name, reserved)
+			if other, ok := types[goName]; ok {
+				panic(genError{fmt.Errorf("name %q for the helpers of %q conflicts with the name for %q", goName, name, other)})
+			}
+			types[goName] = name
+		}
+	}
+	for _, name := range unknowns {
+		goName := g.enumUnknownName(name)
+		check(goName, name, reserved)
+		if other, ok := types[goName]; ok {
+			panic(genError{fmt.Errorf("name %q for unknown values of %q conflicts with the name for %q", goName, name, other)})
+		}
+		types[goName] = name
+	}
+	if g.pkgNames != nil {
+		for name := range reserved {
+			g.pkgNames[name] = struct{}{}
+		}
+		for name := range types {
+			g.pkgNames[name] = struct{}{}
+		}
+	}
+}
+
+// clientIdent returns the name of an identifier of the generated client, one of
+// clientIdents, with "Client" replaced by Options.ClientName if set, and
+// unexported if Options.Unexported is set.
+func (g *generator) clientIdent(name string) string {
+	if g.opts.ClientName != "" {
+		name = strings.Replace(name, "Client", g.opts.ClientName, 1)
+	}
+	if g.opts.Unexported {
+		return unexportedName(name)
+	}
+	return name
+}
+
+// envPrefix returns the prefix of the environment variables for package name,
+// in upper case, with characters other than letters and digits replaced by an
+// underscore.
+func envPrefix(name string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z':
+			return r - 'a' + 'A'
+		case r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+			return r
+		}
+		return '_'
+	}, name)
+}
+
+// clientName returns the name of the generated client type.
+func (g *generator) clientName() string {
+	return g.clientIdent("Client")
+}
+
+// newClientName returns the name of the generated function returning a new client.
+func (g *generator) newClientName() string {
+	return g.clientIdent("NewClient")
+}
+
+// nilIsNull returns whether nullable type t is a Go slice or map without
+// pointer, with nil for null, see Options.NullableSlices.
+func (g *generator) nilIsNull(t NullableType) bool {
+	switch t.Type.(type) {
+	case ArrayType, ObjectType:
+		return g.opts.NullableSlices
+	}
+	return false
+}
+
+// isSliceOrMap returns whether t is a non-nullable array or object. With
+// Options.NullableSlices, nil values for these types are encoded as an empty
+// array or object instead of null.
+func isSliceOrMap(t Type) bool {
+	switch t.(type) {
+	case ArrayType, ObjectType:
+		return true
+	}
+	return false
+}
+
+// goType returns the Go type for t in the generated package.
+func (g *generator) goType(t Type) string {
+	return g.qualifiedGoType(t, "")
+}
+
+// qualifiedGoType returns the Go type for t like goType, but with named types
+// qualified with package pkg if not empty, for use outside the generated package.
+func (g *generator) qualifiedGoType(t Type, pkg string) string {
+	switch t := t.(type) {
+	case NullableType:
+		if g.nilIsNull(t) {
+			return g.qualifiedGoType(t.Type, pkg)
+		}
+		return "*" + g.qualifiedGoType(t.Type, pkg)
+	case ArrayType:
+		return "[]" + g.qualifiedGoType(t.Type, pkg)
+	case ObjectType:
+		return "map[string]" + g.qualifiedGoType(t.Value, pkg)
+	case IdentType:
+		if pkg == "" {
+			return g.typeName(t.Name)
+		}
+		return pkg + "." + g.typeName(t.Name)
+	}
+	return t.GoType()
+}
+
+// goTypewords returns the Go type for the typewords of what.
+func (g *generator) goTypewords(what string, typewords []string) string {
+	return g.goType(parseType(what, typewords))
+}
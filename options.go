@@ -0,0 +1,409 @@
+package sherpago
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/token"
+	"io"
+
+	"github.com/mjl-/sherpadoc"
+)
+
+// Snippet is a part of the client package, generated without package clause,
+// imports and package documentation.
+type Snippet string
+
+const (
+	SnippetTypes  Snippet = "types"  // Only the types.
+	SnippetClient Snippet = "client" // Only the Client type and its methods.
+)
+
+// FieldNamePolicy determines the Go names of struct fields from their names in
+// the sherpadoc, which are used in JSON.
+type FieldNamePolicy string
+
+const (
+	// The first letter in upper case, with changes like golint, e.g. "userId" and
+	// "user_id" become UserID.
+	FieldNamesDefault FieldNamePolicy = ""
+
+	// The words of the name, separated by other characters than letters and
+	// digits, each starting with an upper case letter, with changes like golint,
+	// e.g. "user-id" and "user.id" become UserID. For APIs with names that are not
+	// Go identifiers.
+	FieldNamesCamel FieldNamePolicy = "camel"
+
+	// Like FieldNamesCamel, but the names in JSON are also changed to lower camel
+	// case, e.g. "UserID" and "user_id" become "userID". For APIs with a
+	// sherpadoc that does not have the names used in JSON.
+	FieldNamesLowerCamel FieldNamePolicy = "lowercamel"
+)
+
+// API is an additional API for the client package, see Options.APIs.
+type API struct {
+	Doc        io.Reader // Sherpadoc of the API, as JSON.
+	ClientName string    // Name of the client type, e.g. "AdminClient", required.
+	BaseURL    string    // Default URL of the API, used by the function creating a client.
+}
+
+// Options configure code generation by GenerateFiles.
+type Options struct {
+	PackageName string // Name of the generated Go package.
+	BaseURL     string // Default URL of the API, used by NewClient in the generated package.
+
+	Benchmarks bool // Also generate benchmarks, see GenerateBenchmarks.
+	Fakes      bool // Also generate NewFake functions, see GenerateFakes.
+	Markdown   bool // Also generate a markdown API reference, see GenerateMarkdown.
+	Mobile     bool // Also generate a wrapper for gomobile bind, see GenerateMobile.
+	NATS       bool // Also generate a transport for NATS, see GenerateNATS.
+	Postman    bool // Also generate a Postman collection, see GeneratePostman.
+
+	// If set, only a snippet of the client package is generated, for inclusion in
+	// an existing package. The package must import the packages the snippet uses,
+	// e.g. by running goimports on it.
+	Snippet Snippet
+
+	// If set, all generated identifiers are unexported, including the client type
+	// and the function creating one, for embedding the generated code in a package
+	// with its own API. Struct fields remain exported for JSON encoding. A
+	// command-line program cannot be generated in this mode.
+	Unexported bool
+
+	// If set, the generated package does not import github.com/mjl-/sherpa, but
+	// has its own Error type and error code constants, so it only depends on the
+	// standard library.
+	NoSherpaDep bool
+
+	// If set, MarshalJSON and UnmarshalJSON methods are generated for the struct
+	// types. They produce and parse the same JSON as encoding/json, but without
+	// reflection, making encoding and decoding of large responses faster. Unlike
+	// with encoding/json, object keys must match the field names exactly.
+	FastJSON bool
+
+	// If set, struct types get a field Extra with the fields of JSON objects that
+	// are not in the sherpadoc, e.g. added to the API after the client was
+	// generated, which are encoded again with the struct, so values from a newer
+	// server survive a round trip. Struct types get MarshalJSON and UnmarshalJSON
+	// methods. Types with the "embeds" annotation require FastJSON.
+	ExtraFields bool
+
+	// If set, struct fields with non-nullable timestamps are left out of the JSON
+	// when they have the zero time, instead of being sent as
+	// "0001-01-01T00:00:00Z", which many servers reject. Decoding a missing field
+	// gives the zero time again. Struct types with timestamps get a MarshalJSON
+	// method. Parameters and values in arrays and objects are still sent.
+	OmitZeroTime bool
+
+	// Go type for string struct fields with annotation "format=uuid", as import
+	// path and type name, e.g. "github.com/google/uuid.UUID", or only a type name
+	// for a type in another file of the generated package. The package name must
+	// be the last element of the import path. The type must implement
+	// encoding.TextMarshaler and encoding.TextUnmarshaler, so values are checked
+	// when decoding. Parameters have no documentation in a sherpadoc, so cannot be
+	// annotated. With ModulePath, the module of the type must be added to the
+	// generated go.mod.
+	UUIDType string
+
+	// Go type for struct fields with annotation "format=decimal" or
+	// "format=money", as import path and type name like UUIDType, e.g.
+	// "github.com/shopspring/decimal.Decimal", for exact arithmetic on amounts.
+	// The annotations are for string fields, with decimals as text, e.g. "12.50",
+	// and float fields, with decimals as JSON numbers, decoded without rounding
+	// to a float64. The type must implement encoding.TextMarshaler and
+	// encoding.TextUnmarshaler with decimals as text. For string fields, the type
+	// is encoded by encoding/json, so its MarshalJSON method, if any, must give a
+	// JSON string.
+	DecimalType string
+
+	// If set, sherpa types "nullable []T" and "nullable {}T" become Go slices and
+	// maps, with nil for null, instead of pointers to slices and maps. Nil values
+	// for the non-nullable array and object types are then sent as empty array and
+	// object instead of null, in parameters and struct fields. So nil and empty
+	// values survive a round trip for the nullable types, and only nullable types
+	// are ever sent as null.
+	NullableSlices bool
+
+	// If set, the generated client is suitable for TinyGo, e.g. for embedded and
+	// WebAssembly targets. It implies FastJSON and NoSherpaDep, parameters are
+	// encoded without encoding/json, and the options for the HTTP transport, which
+	// need parts of net and net/http that TinyGo lacks, are left out.
+	TinyGo bool
+
+	// Name of the client type, instead of "Client", e.g. "AdminClient". The
+	// function creating a client and the option type are named after it, e.g.
+	// NewAdminClient and AdminClientOption. It must be an exported identifier.
+	ClientName string
+
+	// Additional APIs with a client in the same package, each in file
+	// "<PackageName>_<client name in lower case>.go", e.g. for a daemon with an
+	// API for accounts and one for admins. Their client types have the fields and
+	// take the options of the main client. Types with the same name in multiple
+	// APIs are generated once, and must have the same Go names and structure.
+	// The files for benchmarks, fakes, etc., are only generated for the main API.
+	APIs []API
+
+	// If set, the client checks parameters before sending a request, and results,
+	// against the sherpadoc, returning a ValidationError for an enum value that is
+	// not documented, or nil or null for a type that is not nullable. For failing
+	// early on invalid calls, and for noticing when a server has changed its API.
+	Validate bool
+
+	// If set, the struct and enum types get an OrZero method, returning the value
+	// a pointer points to, or the zero value for a nil pointer. Nullable values,
+	// e.g. results and fields, are pointers that are nil for null, so code using
+	// them can call OrZero instead of checking for nil.
+	OrZero bool
+
+	// If set, each enum type gets a function listing its values, e.g.
+	// StatusValues, a Name method returning the name of a value in the sherpadoc,
+	// and a function looking up a value by that name, e.g. StatusByName. For
+	// enumerating the allowed values, e.g. in user interfaces.
+	EnumHelpers bool
+
+	// If set, each enum type gets a constant for values that are not documented,
+	// e.g. StatusUnknown, and an OrUnknown method returning it for such values,
+	// for switching over values added to the API after the client was generated.
+	// Values are still decoded and sent as is. The constant is the empty string
+	// for string enums, and below the lowest value for int enums. Not for
+	// bitmasks.
+	EnumUnknown bool
+
+	// How Go names of struct fields are made from the names in the sherpadoc.
+	FieldNames FieldNamePolicy
+
+	// If set, the Go names of functions, types, enum values and struct fields are
+	// the names in the sherpadoc with only the first letter changed to upper case,
+	// without changes like golint, e.g. "userId" becomes UserId instead of UserID,
+	// so they match the documentation of the API verbatim.
+	NoLintNames bool
+
+	// If set, this prefix is removed from function names for the Go method names,
+	// e.g. "admin" for method AddDomain for function "adminAddDomain". Only if the
+	// rest starts with an upper case letter.
+	StripPrefix string
+
+	// If set, the Go names of types and enum values defined in subsections are
+	// prefixed with the names of the subsections, e.g. type "Domain" in section
+	// "Admin" becomes AdminDomain. Useful for APIs with similar types in
+	// different sections.
+	SectionPrefix bool
+
+	// If set, the client also gets a method without context parameter for each
+	// function, with "NoCtx" appended to its name, that calls the function with
+	// context.Background(). For scripts, where passing a context is noise.
+	NoCtxMethods bool
+
+	// If set, the client also gets a method for each function with "Raw" appended
+	// to its name, returning the result as json.RawMessage, without decoding it.
+	// For multiple return values, it is a JSON array. For forwarding results
+	// verbatim, e.g. in proxies and caches.
+	RawMethods bool
+
+	// If set, the client also gets a method for each function with an array as
+	// single result, with "All" appended to its name, returning an iterator over
+	// the elements, an iter.Seq2 with an error. Functions with annotation
+	// "pages=<param>:<items>:<next>" are called for each page, with parameter
+	// param set to the field next of the previous result, until it is zero, with
+	// an iterator over the array in field items. Requires Go 1.23.
+	IterMethods bool
+
+	// If set, the client gets a Functions method returning descriptions of the
+	// functions, with their names, documentation, and types of parameters and
+	// return values, in FunctionInfo types, and a DynamicCall method calling a
+	// function by name with parameters and results as JSON. For generic user
+	// interfaces, command-line programs, scripting and bridges over the client,
+	// without reading the sherpadoc.
+	Catalog bool
+
+	// If set, the client gets an option WithSchemaDrift, with a hook called with
+	// the differences between results and the types in the sherpadoc: fields that
+	// are not in the sherpadoc, and null for types that are not nullable. Calls do
+	// not fail on them. For monitoring drift between client and server, e.g. a
+	// server with a newer API.
+	SchemaDrift bool
+
+	// If set, the client gets an option WithExpvar, publishing counters of calls
+	// and errors by function with package expvar, for Go services that already
+	// serve /debug/vars. Not the default: importing expvar registers its handler
+	// on http.DefaultServeMux.
+	Expvar bool
+
+	// If set, the client gets an option WithWebSocket, for sending calls over a
+	// single WebSocket connection instead of an HTTP request each. Not the
+	// default: it needs a server implementing the protocol described at
+	// WithWebSocket, which sherpa servers do not.
+	WebSocket bool
+
+	// If set, the client gets an option WithCodec, with codecs CBORCodec and
+	// MessagePackCodec, for sending requests and getting responses in an encoding
+	// other than JSON. Not the default: the encoders and decoders are a large part
+	// of the generated client, and most servers only speak JSON.
+	Codec bool
+
+	// If set, the client gets a function KeyringCredentials, with a provider of
+	// credentials from the keyring of the OS. Not the default: it runs a command,
+	// "security" on macOS and "secret-tool" on other systems, so the generated
+	// package imports os/exec.
+	Keyring bool
+
+	// If set, functions with a deprecation notice in their documentation, a line
+	// starting with "Deprecated:", are left out of all generated files.
+	SkipDeprecated bool
+
+	// If > 0, paragraphs and list items in the generated doc comments are wrapped
+	// at this many characters, not counting the comment marker and indent.
+	DocWidth int
+
+	// If set, also generate a command-line program, see GenerateCLI. It imports the
+	// client package from this path.
+	CLIImportPath string
+
+	// If set, also generate a go.mod and go.sum (unless NoSherpaDep) for a module
+	// with this path, with the client package at its root, so it can be published
+	// as its own module.
+	ModulePath string
+
+	// BeforeGenerate, if set, is called with the parsed sherpadoc before generating
+	// code. It can modify the sherpadoc, e.g. to add types or change names. The
+	// sherpadoc is checked again after the call.
+	BeforeGenerate func(doc *sherpadoc.Section) error
+
+	// VendorHook, if set, is called after BeforeGenerate, with the parsed
+	// sherpadoc and its vendor extension fields, see VendorFields, so custom
+	// generation can be driven by annotations in the sherpadoc. It can modify the
+	// sherpadoc like BeforeGenerate. The paths of the vendor fields are those of
+	// the sherpadoc as read.
+	VendorHook func(doc *sherpadoc.Section, fields VendorFields) error
+
+	// ASTHook, if set, is called for each generated Go file, with its syntax tree,
+	// before it is printed, e.g. to add, change or remove declarations. The
+	// comments are in file.Comments, see go/ast.CommentMap for keeping them with
+	// changed declarations. Not called for a snippet, see Snippet.
+	ASTHook func(name string, fset *token.FileSet, file *ast.File) error
+
+	// AfterGenerate, if set, is called with the generated files, keyed by file name.
+	// It can modify, add or remove files, e.g. to append custom code.
+	AfterGenerate func(files map[string][]byte) error
+}
+
+// GenerateFiles reads sherpadoc from in and returns the generated files, keyed
+// by file name. The client package is always generated, in file
+// "<PackageName>.go". Depending on opts, the files may also include
+// "<PackageName>_bench_test.go", "<PackageName>_fake.go", "API.md",
+// "<PackageName>_mobile.go", "<PackageName>_nats.go",
+// "<PackageName>.postman_collection.json", "cmd/<PackageName>/main.go", "go.mod",
+// "go.sum", and a file for each of Options.APIs. The Go files are parsed and
+// printed as by gofmt, see Options.ASTHook.
+func GenerateFiles(in io.Reader, opts Options) (files map[string][]byte, retErr error) {
+	defer recoverGenError(&retErr)
+
+	if opts.TinyGo {
+		opts.FastJSON = true
+		opts.NoSherpaDep = true
+	}
+	if opts.Unexported && opts.CLIImportPath != "" {
+		return nil, fmt.Errorf("cannot generate command-line program for unexported client")
+	}
+	if opts.Unexported && opts.Mobile {
+		return nil, fmt.Errorf("cannot generate mobile wrapper for unexported client")
+	}
+
+	doc := prepareDoc(in, opts)
+
+	files = map[string][]byte{}
+	generate := func(name string, fn func(g *generator)) {
+		var buf bytes.Buffer
+		fn(newGenerator(doc, &buf, opts))
+		files[name] = buf.Bytes()
+	}
+	// Go names in the client package, for conflicts with those of the other APIs.
+	names := map[string]struct{}{}
+	generate(opts.PackageName+".go", func(g *generator) {
+		g.pkgNames = names
+		g.generateClient()
+	})
+	if len(opts.APIs) > 0 {
+		generateAPIFiles(files, doc, opts, names)
+	}
+	if opts.Benchmarks {
+		generate(opts.PackageName+"_bench_test.go", (*generator).generateBenchmarks)
+	}
+	if opts.Fakes {
+		generate(opts.PackageName+"_fake.go", (*generator).generateFakes)
+	}
+	if opts.Markdown {
+		generate("API.md", (*generator).generateMarkdown)
+	}
+	if opts.Mobile {
+		generate(opts.PackageName+"_mobile.go", (*generator).generateMobile)
+	}
+	if opts.NATS {
+		generate(opts.PackageName+"_nats.go", (*generator).generateNATS)
+	}
+	if opts.Postman {
+		generate(opts.PackageName+".postman_collection.json", (*generator).generatePostman)
+	}
+	if opts.CLIImportPath != "" {
+		generate("cmd/"+opts.PackageName+"/main.go", (*generator).generateCLI)
+	}
+	if opts.ModulePath != "" {
+		generate("go.mod", (*generator).generateGoMod)
+		if !opts.NoSherpaDep {
+			generate("go.sum", (*generator).generateGoSum)
+		}
+	}
+
+	formatFiles(files, opts)
+
+	if opts.AfterGenerate != nil {
+		err := opts.AfterGenerate(files)
+		if err != nil {
+			return nil, fmt.Errorf("after generate hook: %s", err)
+		}
+	}
+	return files, nil
+}
+
+// prepareDoc reads sherpadoc from in, and calls the hooks of opts and removes
+// deprecated functions, as configured.
+func prepareDoc(in io.Reader, opts Options) *sherpadoc.Section {
+	buf, err := io.ReadAll(in)
+	if err != nil {
+		panic(genError{fmt.Errorf("reading sherpadoc: %s", err)})
+	}
+	doc := readDoc(bytes.NewReader(buf))
+	if opts.BeforeGenerate != nil {
+		err := opts.BeforeGenerate(doc)
+		if err != nil {
+			panic(genError{fmt.Errorf("before generate hook: %s", err)})
+		}
+		checkDoc(doc)
+	}
+	if opts.VendorHook != nil {
+		err := opts.VendorHook(doc, parseVendorFields(buf))
+		if err != nil {
+			panic(genError{fmt.Errorf("vendor hook: %s", err)})
+		}
+		checkDoc(doc)
+	}
+	if opts.SkipDeprecated {
+		removeDeprecated(doc)
+	}
+	return doc
+}
+
+// removeDeprecated removes the functions with a deprecation notice from doc and
+// its subsections.
+func removeDeprecated(doc *sherpadoc.Section) {
+	var l []*sherpadoc.Function
+	for _, fn := range doc.Functions {
+		if !isDeprecated(fn.Docs) {
+			l = append(l, fn)
+		}
+	}
+	doc.Functions = l
+	for _, subsec := range doc.Sections {
+		removeDeprecated(subsec)
+	}
+}
@@ -0,0 +1,192 @@
+package sherpago
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/mjl-/sherpadoc"
+)
+
+// GeneratePostman reads sherpadoc from in and writes a Postman collection to out,
+// with a POST request for each function, with example parameters derived from
+// their types, in a folder for each section. The base URL is the collection
+// variable "baseUrl", with baseURL as value. Insomnia can import the collection
+// too.
+func GeneratePostman(in io.Reader, out io.Writer, baseURL string) (retErr error) {
+	defer recoverGenError(&retErr)
+
+	g := newGenerator(readDoc(in), out, Options{BaseURL: baseURL})
+	g.generatePostman()
+	return nil
+}
+
+// Types of the Postman collection format, version 2.1.
+type postmanCollection struct {
+	Info     postmanInfo       `json:"info"`
+	Item     []postmanItem     `json:"item"`
+	Variable []postmanVariable `json:"variable"`
+}
+
+type postmanInfo struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	Schema      string `json:"schema"`
+}
+
+// postmanItem is a folder with items, or a request.
+type postmanItem struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description,omitempty"`
+	Item        []postmanItem   `json:"item,omitempty"`
+	Request     *postmanRequest `json:"request,omitempty"`
+}
+
+type postmanRequest struct {
+	Method      string            `json:"method"`
+	Header      []postmanVariable `json:"header"`
+	Body        postmanBody       `json:"body"`
+	URL         postmanURL        `json:"url"`
+	Description string            `json:"description,omitempty"`
+}
+
+type postmanBody struct {
+	Mode    string `json:"mode"`
+	Raw     string `json:"raw"`
+	Options struct {
+		Raw struct {
+			Language string `json:"language"`
+		} `json:"raw"`
+	} `json:"options"`
+}
+
+type postmanURL struct {
+	Raw  string   `json:"raw"`
+	Host []string `json:"host"`
+	Path []string `json:"path"`
+}
+
+type postmanVariable struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+func (g *generator) generatePostman() {
+	var section func(sec *sherpadoc.Section) []postmanItem
+	section = func(sec *sherpadoc.Section) []postmanItem {
+		var items []postmanItem
+		for _, fn := range sec.Functions {
+			var params []interface{}
+			for _, p := range fn.Params {
+				what := fmt.Sprintf("parameter %s of function %s", p.Name, fn.Name)
+				params = append(params, g.jsonSample(parseType(what, p.Typewords), 0))
+			}
+			if params == nil {
+				params = []interface{}{}
+			}
+			body, err := json.MarshalIndent(map[string]interface{}{"params": params}, "", "\t")
+			if err != nil {
+				panic(genError{err})
+			}
+			req := &postmanRequest{
+				Method:      "POST",
+				Header:      []postmanVariable{{"Content-Type", "application/json; charset=utf-8"}},
+				Body:        postmanBody{Mode: "raw", Raw: string(body)},
+				URL:         postmanURL{Raw: "{{baseUrl}}" + fn.Name, Host: []string{"{{baseUrl}}"}, Path: []string{fn.Name}},
+				Description: fn.Docs,
+			}
+			req.Body.Options.Raw.Language = "json"
+			items = append(items, postmanItem{Name: fn.Name, Request: req})
+		}
+		for _, subsec := range sec.Sections {
+			items = append(items, postmanItem{Name: subsec.Name, Description: subsec.Docs, Item: section(subsec)})
+		}
+		return items
+	}
+
+	c := postmanCollection{
+		Info: postmanInfo{
+			Name:        g.doc.Name,
+			Description: g.doc.Docs,
+			Schema:      "https://schema.getpostman.com/json/collection/v2.1.0/collection.json",
+		},
+		Item:     section(g.doc),
+		Variable: []postmanVariable{{"baseUrl", g.opts.BaseURL}},
+	}
+	enc := json.NewEncoder(g.out)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "\t")
+	if err := enc.Encode(c); err != nil {
+		panic(genError{err})
+	}
+	g.flush()
+}
+
+// jsonSample returns an example value of type t, as in JSON, like goSample.
+func (g *generator) jsonSample(t Type, depth int) interface{} {
+	switch t := t.(type) {
+	case BaseType:
+		switch t.Name {
+		case "any", "string":
+			return "example"
+		case "bool":
+			return true
+		case "float32", "float64":
+			return 1.5
+		case "timestamp":
+			return "2019-05-05T20:08:43Z"
+		case "int64s", "uint64s":
+			return "1"
+		default:
+			return 1
+		}
+	case NullableType:
+		if depth >= sampleDepth {
+			return nil
+		}
+		return g.jsonSample(t.Type, depth)
+	case ArrayType:
+		if depth >= sampleDepth {
+			return []interface{}{}
+		}
+		return []interface{}{g.jsonSample(t.Type, depth)}
+	case ObjectType:
+		if depth >= sampleDepth {
+			return map[string]interface{}{}
+		}
+		return map[string]interface{}{"example": g.jsonSample(t.Value, depth)}
+	case IdentType:
+		if st, ok := g.structs[t.Name]; ok {
+			if depth >= sampleDepth {
+				return map[string]interface{}{}
+			}
+			if u := g.union(t.Name); u != nil {
+				v := g.jsonSample(IdentType{Name: u.variants[0].typ}, depth+1)
+				if m, ok := v.(map[string]interface{}); ok {
+					m[u.field] = u.variants[0].kind
+				}
+				return v
+			}
+			// The fields of embedded structs are in the sherpadoc too.
+			m := map[string]interface{}{}
+			for _, f := range st.Fields {
+				what := fmt.Sprintf("field %s for type %s", f.Name, st.Name)
+				m[f.Name] = g.jsonSample(parseType(what, f.Typewords), depth+1)
+			}
+			return m
+		}
+		if it, ok := g.ints[t.Name]; ok {
+			if len(it.Values) > 0 {
+				return it.Values[0].Value
+			}
+			return 1
+		}
+		if st, ok := g.strs[t.Name]; ok {
+			if len(st.Values) > 0 {
+				return st.Values[0].Value
+			}
+			return "example"
+		}
+	}
+	panic(genError{fmt.Errorf("no sample value for type %s", g.goType(t))})
+}
@@ -0,0 +1,87 @@
+package sherpago
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Maximum depth of nested structs in sample values. Deeper structs are left
+// empty, which also stops recursion for self-referencing types.
+const sampleDepth = 3
+
+// goSample returns a Go expression with an example value of type t. The
+// expression has the exact type of t, so it can be used as an interface{} value.
+func (g *generator) goSample(t Type, depth int) string {
+	switch t := t.(type) {
+	case BaseType:
+		switch t.Name {
+		case "any", "string":
+			return `"example"`
+		case "bool":
+			return "true"
+		case "float32", "float64":
+			return g.goType(t) + "(1.5)"
+		case "timestamp":
+			return "time.Date(2019, 5, 5, 20, 8, 43, 0, time.UTC)"
+		default:
+			return g.goType(t) + "(1)"
+		}
+	case NullableType:
+		if depth >= sampleDepth {
+			return fmt.Sprintf("(%s)(nil)", g.goType(t))
+		}
+		if g.nilIsNull(t) {
+			return g.goSample(t.Type, depth)
+		}
+		return fmt.Sprintf("func() %s { v := %s; return &v }()", g.goType(t), g.goSample(t.Type, depth))
+	case ArrayType:
+		if depth >= sampleDepth {
+			return g.goType(t) + "{}"
+		}
+		return fmt.Sprintf("%s{%s}", g.goType(t), g.goSample(t.Type, depth))
+	case ObjectType:
+		if depth >= sampleDepth {
+			return g.goType(t) + "{}"
+		}
+		return fmt.Sprintf(`%s{"example": %s}`, g.goType(t), g.goSample(t.Value, depth))
+	case IdentType:
+		if st, ok := g.structs[t.Name]; ok {
+			if depth >= sampleDepth {
+				return g.goType(t) + "{}"
+			}
+			if u := g.union(t.Name); u != nil {
+				return fmt.Sprintf("%s{Value: %s}", g.goType(t), g.goSample(IdentType{Name: u.variants[0].typ}, depth+1))
+			}
+			fields := []string{}
+			for _, name := range g.embeds(st) {
+				fields = append(fields, fmt.Sprintf("%s: %s", g.typeName(name), g.goSample(IdentType{Name: name}, depth)))
+			}
+			embedded := g.embeddedFields(st)
+			for _, f := range st.Fields {
+				if embedded[f.Name] != "" {
+					continue
+				}
+				what := fmt.Sprintf("field %s for type %s", f.Name, st.Name)
+				sample := g.goSample(parseType(what, f.Typewords), depth+1)
+				if c := g.fieldConversion(st, f); c != nil {
+					sample = c.sample
+				}
+				fields = append(fields, fmt.Sprintf("%s: %s", g.fieldName(f.Name), sample))
+			}
+			return fmt.Sprintf("%s{%s}", g.goType(t), strings.Join(fields, ", "))
+		}
+		if it, ok := g.ints[t.Name]; ok {
+			if len(it.Values) > 0 {
+				return g.typeName(it.Values[0].Name)
+			}
+			return g.goType(t) + "(1)"
+		}
+		if st, ok := g.strs[t.Name]; ok {
+			if len(st.Values) > 0 {
+				return g.typeName(st.Values[0].Name)
+			}
+			return g.goType(t) + `("example")`
+		}
+	}
+	panic(genError{fmt.Errorf("no sample value for type %s", g.goType(t))})
+}
@@ -5,8 +5,10 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"sort"
 	"strconv"
 	"strings"
+	"unicode"
 
 	"github.com/mjl-/sherpadoc"
 )
@@ -40,143 +42,322 @@ var keywords = map[string]struct{}{
 	"var":         {},
 }
 
-type sherpaType interface {
-	GoType() string
-}
+type genError struct{ error }
 
-// baseType, one of: "any", "bool", "int16", etc.
-type baseType struct {
-	Name string
+// recoverGenError turns a panic with a genError into an error in retErr.
+// It must be called through defer.
+func recoverGenError(retErr *error) {
+	e := recover()
+	if e == nil {
+		return
+	}
+	g, ok := e.(genError)
+	if !ok {
+		panic(e)
+	}
+	*retErr = error(g)
 }
 
-// nullableType is: "nullable" <type>.
-type nullableType struct {
-	Type sherpaType
+// generator holds the parsed sherpadoc and the output for one of the kinds of
+// files sherpago generates.
+type generator struct {
+	opts    Options
+	doc     *sherpadoc.Section
+	out     *bufio.Writer
+	structs map[string]sherpadoc.Struct
+	ints    map[string]sherpadoc.Ints
+	strs    map[string]sherpadoc.Strings
+
+	// Prefix for the Go names of types and enum values, for Options.SectionPrefix.
+	typePrefixes map[string]string
+
+	// For an additional API of Options.APIs: the names of the client type and
+	// option type of the main API, the Go names defined for earlier APIs, and the
+	// types that were generated for them already.
+	mainClient  string
+	mainOption  string
+	pkgNames    map[string]struct{}
+	sharedTypes map[string]bool
 }
 
-// arrayType is: "[]" <type>
-type arrayType struct {
-	Type sherpaType
-}
+// readDoc reads and checks sherpadoc from in.
+func readDoc(in io.Reader) *sherpadoc.Section {
+	var doc sherpadoc.Section
+	err := json.NewDecoder(in).Decode(&doc)
+	if err != nil {
+		panic(genError{fmt.Errorf("parsing sherpadoc json: %s", err)})
+	}
+
+	const sherpadocVersion = 1
+	if doc.SherpadocVersion != sherpadocVersion {
+		panic(genError{fmt.Errorf("unexpected sherpadoc version %d, expected %d", doc.SherpadocVersion, sherpadocVersion)})
+	}
 
-// objectType is: "{}" <type>
-type objectType struct {
-	Value sherpaType
+	checkDoc(&doc)
+	return &doc
 }
 
-// identType is: [a-zA-Z][a-zA-Z0-9]*
-type identType struct {
-	Name string
+// checkDoc validates the contents of doc.
+func checkDoc(doc *sherpadoc.Section) {
+	err := sherpadoc.Check(doc)
+	if err != nil {
+		panic(genError{err})
+	}
+	checkTypeCycles(doc)
 }
 
-func (t baseType) GoType() string {
-	switch t.Name {
-	case "any":
-		return "interface{}"
-	case "timestamp":
-		return "time.Time"
-	case "int64s":
-		return "int64"
-	case "uint64s":
-		return "uint64"
-	default:
-		return t.Name
+// checkTypeCycles checks that no struct contains itself through fields that are
+// not nullable, arrays or objects. Such types cannot be declared in Go, and have
+// no finite values. Self-references through the other types are fine.
+func checkTypeCycles(doc *sherpadoc.Section) {
+	structs := map[string]sherpadoc.Struct{}
+	var gather func(sec *sherpadoc.Section)
+	gather = func(sec *sherpadoc.Section) {
+		for _, t := range sec.Structs {
+			structs[t.Name] = t
+		}
+		for _, subsec := range sec.Sections {
+			gather(subsec)
+		}
+	}
+	gather(doc)
+
+	const (
+		visiting = 1
+		done     = 2
+	)
+	state := map[string]int{}
+	var visit func(name string, path []string)
+	visit = func(name string, path []string) {
+		switch state[name] {
+		case visiting:
+			for i, elem := range path {
+				if strings.HasPrefix(elem, name+".") {
+					path = path[i:]
+					break
+				}
+			}
+			panic(genError{fmt.Errorf("type %s contains itself through fields that are not nullable: %s", name, strings.Join(append(path, name), " -> "))})
+		case done:
+			return
+		}
+		state[name] = visiting
+		for _, f := range structs[name].Fields {
+			if len(f.Typewords) == 1 {
+				if _, ok := structs[f.Typewords[0]]; ok {
+					visit(f.Typewords[0], append(path, name+"."+f.Name))
+				}
+			}
+		}
+		state[name] = done
+	}
+	var names []string
+	for name := range structs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		visit(name, nil)
 	}
 }
 
-func (t nullableType) GoType() string {
-	return "*" + t.Type.GoType()
+// newGenerator returns a generator for doc, writing to out.
+func newGenerator(doc *sherpadoc.Section, out io.Writer, opts Options) *generator {
+	g := &generator{
+		opts:    opts,
+		doc:     doc,
+		out:     bufio.NewWriter(out),
+		structs: map[string]sherpadoc.Struct{},
+		ints:    map[string]sherpadoc.Ints{},
+		strs:    map[string]sherpadoc.Strings{},
+
+		typePrefixes: map[string]string{},
+	}
+	for _, sec := range g.sections() {
+		for _, t := range sec.Structs {
+			g.structs[t.Name] = t
+		}
+		for _, t := range sec.Ints {
+			g.ints[t.Name] = t
+		}
+		for _, t := range sec.Strings {
+			g.strs[t.Name] = t
+		}
+	}
+	if opts.FieldNames == FieldNamesLowerCamel {
+		for _, sec := range g.sections() {
+			for _, t := range sec.Structs {
+				for i, f := range t.Fields {
+					t.Fields[i].Name = lowerCamelName(f.Name, !opts.NoLintNames)
+				}
+			}
+		}
+	}
+	if opts.SectionPrefix {
+		var walk func(sec *sherpadoc.Section, prefix string)
+		walk = func(sec *sherpadoc.Section, prefix string) {
+			for _, t := range sec.Structs {
+				g.typePrefixes[t.Name] = prefix
+			}
+			for _, t := range sec.Ints {
+				g.typePrefixes[t.Name] = prefix
+				for _, v := range t.Values {
+					g.typePrefixes[v.Name] = prefix
+				}
+			}
+			for _, t := range sec.Strings {
+				g.typePrefixes[t.Name] = prefix
+				for _, v := range t.Values {
+					g.typePrefixes[v.Name] = prefix
+				}
+			}
+			for _, subsec := range sec.Sections {
+				walk(subsec, prefix+sectionPrefix(subsec.Name))
+			}
+		}
+		walk(doc, "")
+	}
+	return g
 }
 
-func (t arrayType) GoType() string {
-	return "[]" + t.Type.GoType()
+// isType returns whether name is a struct or enum type in the sherpadoc.
+func (g *generator) isType(name string) bool {
+	_, isStruct := g.structs[name]
+	_, isInts := g.ints[name]
+	_, isStrings := g.strs[name]
+	return isStruct || isInts || isStrings
 }
 
-func (t objectType) GoType() string {
-	return fmt.Sprintf("map[string]%s", t.Value.GoType())
+// sections returns the top-level section and all its subsections, depth-first.
+func (g *generator) sections() []*sherpadoc.Section {
+	var l []*sherpadoc.Section
+	var walk func(sec *sherpadoc.Section)
+	walk = func(sec *sherpadoc.Section) {
+		l = append(l, sec)
+		for _, subsec := range sec.Sections {
+			walk(subsec)
+		}
+	}
+	walk(g.doc)
+	return l
 }
 
-func (t identType) GoType() string {
-	return t.Name
+func (g *generator) printf(format string, args ...interface{}) {
+	_, err := fmt.Fprintf(g.out, format, args...)
+	if err != nil {
+		panic(genError{err})
+	}
 }
 
-type genError struct{ error }
+// removeString returns l without the elements equal to s.
+func removeString(l []string, s string) []string {
+	var r []string
+	for _, e := range l {
+		if e != s {
+			r = append(r, e)
+		}
+	}
+	return r
+}
 
-// Generate reads sherpadoc from in and writes a Go file containing a client
-// package to out.  It requires two parameters: the package name to use and the
-// baseURL for the API.
-func Generate(in io.Reader, out io.Writer, packageName, baseURL string) (retErr error) {
-	defer func() {
-		e := recover()
-		if e == nil {
-			return
+// printImports writes an import declaration for the packages in imports, with
+// the standard library packages first.
+func (g *generator) printImports(imports []string) {
+	var std, other []string
+	for _, imp := range imports {
+		if strings.Contains(imp, ".") {
+			other = append(other, imp)
+		} else {
+			std = append(std, imp)
 		}
-		g, ok := e.(genError)
-		if !ok {
-			panic(e)
+	}
+	sort.Strings(std)
+	sort.Strings(other)
+	g.printf("import (\n")
+	for i, imp := range std {
+		if i > 0 && imp == std[i-1] {
+			// E.g. for FastJSON, which needs some of the same packages.
+			continue
 		}
-		retErr = error(g)
-	}()
-
-	var doc sherpadoc.Section
-	err := json.NewDecoder(in).Decode(&doc)
-	if err != nil {
-		panic(genError{fmt.Errorf("parsing sherpadoc json: %s", err)})
+		g.printf("\t%s\n", strconv.Quote(imp))
 	}
-
-	const sherpadocVersion = 1
-	if doc.SherpadocVersion != sherpadocVersion {
-		panic(genError{fmt.Errorf("unexpected sherpadoc version %d, expected %d", doc.SherpadocVersion, sherpadocVersion)})
+	if len(std) > 0 && len(other) > 0 {
+		g.printf("\n")
 	}
+	for i, imp := range other {
+		if i > 0 && imp == other[i-1] {
+			continue
+		}
+		g.printf("\t%s\n", strconv.Quote(imp))
+	}
+	g.printf(")\n\n")
+}
 
-	// Validate contents.
-	err = sherpadoc.Check(&doc)
+func (g *generator) flush() {
+	err := g.out.Flush()
 	if err != nil {
 		panic(genError{err})
 	}
+}
 
-	goExportedName := func(name string) string {
-		return lintName(strings.ToUpper(name[:1]) + name[1:])
+// Generate reads sherpadoc from in and writes a Go file containing a client
+// package to out.  It requires two parameters: the package name to use and the
+// baseURL for the API. The file is formatted, as the files of GenerateFiles.
+func Generate(in io.Reader, out io.Writer, packageName, baseURL string) error {
+	files, err := GenerateFiles(in, Options{PackageName: packageName, BaseURL: baseURL})
+	if err != nil {
+		return err
 	}
+	_, err = out.Write(files[packageName+".go"])
+	return err
+}
 
-	// Local names could be Go keywords. If they are, make a unique non-reserved name.
-	localNames := map[string]string{}
-	goLocalName := func(name string) string {
-		r := strings.ToLower(name[:1]) + name[1:]
-		if _, ok := keywords[r]; !ok {
-			return r
-		}
-		nr := localNames[r]
-		if nr != "" {
-			return nr
-		}
-		for i := 0; ; i++ {
-			nr = fmt.Sprintf("%s%d", r, i)
-			if _, ok := localNames[nr]; ok {
-				continue
+// generateClient writes the client package, or a part of it for a snippet.
+func (g *generator) generateClient() {
+	doc := g.doc
+
+	switch g.opts.Snippet {
+	case "", SnippetTypes, SnippetClient:
+	default:
+		panic(genError{fmt.Errorf("unknown snippet %q", g.opts.Snippet)})
+	}
+	if name := g.opts.ClientName; name != "" {
+		for i, r := range name {
+			if i == 0 && !unicode.IsUpper(r) || !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '_' {
+				panic(genError{fmt.Errorf("client name %q is not an exported Go identifier", name)})
 			}
-			localNames[r] = nr
-			return nr
 		}
+		if _, ok := keywords[name]; ok {
+			panic(genError{fmt.Errorf("client name %q is not an exported Go identifier", name)})
+		}
+	}
+	switch g.opts.FieldNames {
+	case FieldNamesDefault, FieldNamesCamel, FieldNamesLowerCamel:
+	default:
+		panic(genError{fmt.Errorf("unknown field name policy %q", g.opts.FieldNames)})
 	}
+	g.checkNames()
 
-	bout := bufio.NewWriter(out)
-	xprintf := func(format string, args ...interface{}) {
-		_, err := fmt.Fprintf(out, format, args...)
-		if err != nil {
-			panic(genError{err})
+	xprintf := g.printf
+
+	xprintLines := func(indent string, lines []string) {
+		for _, line := range lines {
+			if line == "" || strings.HasPrefix(line, "\t") {
+				xprintf("%s//%s\n", indent, line)
+			} else {
+				xprintf("%s// %s\n", indent, line)
+			}
 		}
 	}
 
+	// The lines are returned if they were not printed, for a trailing comment.
 	xprintMultiline := func(indent, docs string, always bool) []string {
-		lines := docLines(docs)
+		lines := goDocLines(docs, g.opts.DocWidth)
 		if len(lines) == 1 && !always {
 			return lines
 		}
-		for _, line := range lines {
-			xprintf("%s// %s\n", indent, line)
-		}
-		return lines
+		xprintLines(indent, lines)
+		return nil
 	}
 
 	xprintSingleline := func(lines []string) {
@@ -191,108 +372,156 @@ func Generate(in io.Reader, out io.Writer, packageName, baseURL string) (retErr
 		xprintMultiline("", sec.Docs, true)
 		depth++
 		for _, subsec := range sec.Sections {
-			xprintf("//\n// %s %s\n//\n", strings.Repeat("#", depth), subsec.Name)
+			xprintf("//\n// %s %s\n//\n", strings.Repeat("#", depth), strings.Join(strings.Fields(sanitizeDoc(subsec.Name)), " "))
 			generateSectionDocs(subsec, depth)
 		}
 	}
-	generateSectionDocs(&doc, 0)
-
-	xprintf(`package %s
-
-import (
-	"bytes"
-	"context"
-	"encoding/json"
-	"net/http"
-	"time"
+	if g.opts.Snippet == "" && g.mainClient == "" {
+		generateSectionDocs(doc, 0)
 
-	"github.com/mjl-/sherpa"
-)
-
-var _ time.Time // in case "timestamp" is used
-
-type Client struct {
-	BaseURL string
-	Client *http.Client
-}
-
-func NewClient() *Client {
-	return &Client{
-		BaseURL: "%s",
-		Client: http.DefaultClient,
-	}
-}
-
-func (c *Client) call(ctx context.Context, functionName string, params []interface{}, result []interface{}) error {
-	sherpaReq := map[string]interface{}{
-		"params": params,
-	}
-	buf := &bytes.Buffer{}
-	err := json.NewEncoder(buf).Encode(sherpaReq)
-	if err != nil {
-		return &sherpa.Error{Code: "sherpa:parameter encode error", Message: "encoding request parameters: " + err.Error()}
-	}
-
-	url := c.BaseURL + functionName
-	req, err := http.NewRequest("POST", url, buf)
-	if err != nil {
-		return &sherpa.Error{Code: "sherpa:http", Message: "constructing request: " + err.Error()}
-	}
-	req = req.WithContext(ctx)
-	req.Header.Set("Content-Type", "application/json; charset=utf-8")
-
-	resp, err := c.Client.Do(req)
-	if err != nil {
-		return &sherpa.Error{Code: sherpa.SherpaHTTPError, Message: "sending POST request: " + err.Error()}
+		xprintf("package %s\n\n", g.opts.PackageName)
+		imports := []string{"bufio", "bytes", "compress/gzip", "context", "crypto/sha256", "encoding/hex", "encoding/json", "fmt", "io", "math", "net", "net/http", "net/url", "os", "strconv", "strings", "sync", "time"}
+		if !g.opts.NoSherpaDep {
+			imports = append(imports, "github.com/mjl-/sherpa")
+		}
+		if g.opts.FastJSON {
+			imports = append(imports, fastJSONImports...)
+		}
+		if g.opts.TinyGo {
+			imports = removeString(imports, "net")
+		} else {
+			imports = append(imports, "crypto/tls", "encoding/base64", "path/filepath")
+			if g.opts.WebSocket {
+				imports = append(imports, "crypto/rand", "crypto/sha1", "encoding/binary")
+			}
+			if g.opts.Keyring {
+				imports = append(imports, "os/exec", "runtime")
+			}
+		}
+		imports = append(imports, g.formatImports()...)
+		if g.opts.Codec || g.opts.ExtraFields || g.opts.SchemaDrift {
+			// For the keys of objects in a fixed order.
+			imports = append(imports, "sort")
+		}
+		if g.opts.IterMethods {
+			imports = append(imports, "iter")
+		}
+		if g.opts.Expvar {
+			imports = append(imports, "expvar")
+		}
+		g.printImports(imports)
 	}
-	defer resp.Body.Close()
-
-	switch resp.StatusCode {
-	case 200:
-		var response struct {
-			Result json.RawMessage "json:\"result\""
-			Error  *sherpa.Error   "json:\"error\""
+	if g.mainClient != "" {
+		// The documentation of the API is that of its client type.
+		xprintf("// %s calls the functions of the %s API. It has the fields of\n// %s, takes the same options, and is safe for concurrent use in the same\n// way.\n", g.clientName(), doc.Name, g.mainClient)
+		if doc.Docs != "" || len(doc.Sections) > 0 {
+			xprintf("//\n")
+			generateSectionDocs(doc, 0)
 		}
-		err = json.NewDecoder(resp.Body).Decode(&response)
-		if err != nil {
-			return &sherpa.Error{Code: sherpa.SherpaBadResponse, Message: "parsing response: " + err.Error()}
+		xprintf(apiClientCode, g.clientName(), g.newClientName(), g.opts.BaseURL, g.mainClient, g.mainOption, g.clientIdent("FunctionStats"))
+	} else if g.opts.Snippet != SnippetTypes {
+		codecField, codecRequest, codecAccept, codecResponse := g.codecCallCode()
+		code := fmt.Sprintf(clientCode, g.clientName(), g.newClientName(), g.opts.BaseURL, g.clientIdent("ClientOption"), g.clientIdent("AuditHook"), g.clientIdent("AuditEvent"), g.clientIdent("BaseURLContext"), g.clientIdent("Transport"), codecField, g.clientIdent("WithOrigin"), g.clientIdent("CredentialProvider"), g.clientIdent("Deprecation"), codecRequest, codecAccept, codecResponse)
+		code += fmt.Sprintf(debugCode, g.clientName(), g.clientIdent("ClientOption"), g.clientIdent("WithDebugLog"), g.clientIdent("WithRedaction"))
+		code += fmt.Sprintf(auditCode, g.clientName(), g.clientIdent("ClientOption"), g.clientIdent("AuditHook"), g.clientIdent("AuditEvent"), g.clientIdent("WithAudit"), g.clientIdent("AuditContext"))
+		code += fmt.Sprintf(translateCode, g.clientName(), g.clientIdent("ClientOption"), g.clientIdent("WithErrorTranslation"))
+		code += fmt.Sprintf(headerCode, g.clientName(), g.clientIdent("ClientOption"), g.clientIdent("WithHeaders"), g.clientIdent("HeaderContext"), g.clientIdent("WithLocale"), g.clientIdent("WithTimeoutHeader"))
+		code += fmt.Sprintf(encodingCode, g.clientName(), g.clientIdent("ClientOption"), g.clientIdent("ContentEncoding"), g.clientIdent("GzipEncoding"), g.clientIdent("WithContentEncodings"))
+		code += fmt.Sprintf(flightCode, g.clientName(), g.clientIdent("ClientOption"), g.clientIdent("WithSingleFlight"))
+		code += fmt.Sprintf(hedgeCode, g.clientName(), g.clientIdent("ClientOption"), g.clientIdent("WithHedging"))
+		code += fmt.Sprintf(statsCode, g.clientName(), g.clientIdent("ClientOption"), g.clientIdent("FunctionStats"), g.clientIdent("WithStats"))
+		code += fmt.Sprintf(retryCode, g.clientName(), g.clientIdent("ClientOption"), g.clientIdent("RetryPolicy"), g.clientIdent("WithRetries"), g.clientIdent("Transport"))
+		code += fmt.Sprintf(limitCode, g.clientName(), g.clientIdent("ClientOption"), g.clientIdent("WithMaxConcurrent"))
+		code += fmt.Sprintf(credentialCode, g.clientName(), g.clientIdent("ClientOption"), g.clientIdent("CredentialProvider"), g.clientIdent("WithCredentials"))
+		code += fmt.Sprintf(envCode, g.clientName(), g.clientIdent("ClientOption"), g.clientIdent("NewClientFromEnv"), envPrefix(g.opts.PackageName), g.clientIdent("WithHeaders"), g.clientIdent("WithDebugLog"), g.newClientName())
+		code += fmt.Sprintf(statusCode, g.clientName(), g.clientIdent("ClientOption"), g.clientIdent("WithStatusHandler"), g.clientIdent("WithUnauthorized"))
+		code += fmt.Sprintf(unauthorizedCode, g.clientName(), g.clientIdent("ClientOption"), g.clientIdent("WithUnauthorized"), g.clientIdent("WithHeaders"), g.clientIdent("WithCredentials"), g.clientIdent("HeaderContext"))
+		code += fmt.Sprintf(drainCode, g.clientName(), g.clientIdent("ClientOption"), g.clientIdent("WithDrainLimit"))
+		code += fmt.Sprintf(deprecationCode, g.clientName(), g.clientIdent("ClientOption"), g.clientIdent("Deprecation"), g.clientIdent("WithDeprecationHook"), g.clientIdent("Transport"))
+		code += fmt.Sprintf(closeCode, g.clientName(), g.clientIdent("Transport"))
+		code += fmt.Sprintf(redirectCode, g.clientName(), g.clientIdent("ClientOption"), g.clientIdent("RedirectPolicy"), g.clientIdent("WithRedirectPolicy"))
+		code += fmt.Sprintf(pollCode, g.clientIdent("PollOptions"))
+		code += fmt.Sprintf(sseCode, g.clientName())
+		code += fmt.Sprintf(callTransportCode, g.clientName(), g.clientIdent("ClientOption"), g.clientIdent("Transport"), g.clientIdent("WithTransport"))
+		if g.opts.Codec {
+			code += fmt.Sprintf(codecCode, g.clientName(), g.clientIdent("ClientOption"), g.clientIdent("Codec"), g.clientIdent("CBORCodec"), g.clientIdent("MessagePackCodec"), g.clientIdent("WithCodec"), g.clientIdent("WithTransport"))
 		}
-		if response.Error != nil {
-			return response.Error
+		if g.opts.Validate {
+			code += fmt.Sprintf(validationCode, g.validationErrorName())
 		}
-
-		var r interface{} = &result
-		if len(result) == 1 {
-			r = &result[0]
+		if g.opts.Catalog {
+			code += fmt.Sprintf(catalogCode, g.clientIdent("FunctionInfo"), g.clientIdent("ParamInfo"))
 		}
-		err = json.Unmarshal(response.Result, r)
-		if err != nil {
-			return &sherpa.Error{Code: sherpa.SherpaBadResponse, Message: "parsing result: " + err.Error()}
+		if g.opts.Expvar {
+			code += fmt.Sprintf(expvarCode, g.clientName(), g.clientIdent("ClientOption"), g.clientIdent("WithExpvar"))
 		}
-		return nil
-	case 404:
-		return &sherpa.Error{Code: sherpa.SherpaBadFunction, Message: "no such function"}
-	default:
-		return &sherpa.Error{Code: sherpa.SherpaHTTPError, Message: "HTTP error from server: " + resp.Status}
+		if g.opts.SchemaDrift {
+			code += fmt.Sprintf(driftCode, g.clientName(), g.clientIdent("ClientOption"), g.clientIdent("SchemaDrift"), g.clientIdent("WithSchemaDrift"))
+		}
+		if !g.opts.TinyGo {
+			code += fmt.Sprintf(credentialStoreCode, g.clientIdent("CredentialProvider"), g.clientIdent("Credentials"), g.clientIdent("CredentialFile"), g.clientIdent("DefaultCredentialFile"), g.clientIdent("WriteCredentialFile"), g.opts.PackageName)
+			if g.opts.Keyring {
+				code += fmt.Sprintf(keyringCode, g.clientIdent("CredentialProvider"), g.clientIdent("Credentials"), g.clientIdent("KeyringCredentials"))
+			}
+			if g.opts.WebSocket {
+				code += fmt.Sprintf(webSocketCode, g.clientName(), g.clientIdent("ClientOption"), g.clientIdent("WithWebSocket"))
+			}
+			code += fmt.Sprintf(transportCode, g.clientName(), g.clientIdent("ClientOption"), g.clientIdent("TransportTuning"), g.clientIdent("WithTransportTuning"), g.clientIdent("WithDialContext"), g.clientIdent("WithResolvedAddr"), g.clientIdent("WithProxy"), g.clientIdent("WithNoProxy"), g.clientIdent("WithStrictTLS"))
+		}
+		if g.opts.NoSherpaDep {
+			if g.isType("Error") {
+				panic(genError{fmt.Errorf("type Error conflicts with the Error type generated for NoSherpaDep")})
+			}
+			code = strings.Replace(code, "sherpa.", "", -1) + sherpaErrorCode
+		}
+		xprintf("%s", code)
+	}
+	if g.opts.FastJSON && g.opts.Snippet != SnippetClient && g.mainClient == "" {
+		xprintf("%s", fastJSONCode)
+	}
+	if g.opts.ExtraFields && g.opts.Snippet != SnippetClient && g.mainClient == "" {
+		xprintf("%s", extraCode)
+	}
+	if g.opts.OmitZeroTime && !g.opts.FastJSON && g.opts.Snippet != SnippetClient && g.mainClient == "" {
+		xprintf("%s", zeroTimeCode)
 	}
-}
-
-`, packageName, baseURL)
 
 	generateTypes := func(sec *sherpadoc.Section) {
 		for _, t := range sec.Structs {
+			if g.sharedTypes[t.Name] {
+				continue
+			}
+			if u := g.union(t.Name); u != nil {
+				if len(goDocLines(t.Docs, g.opts.DocWidth)) > 0 {
+					xprintMultiline("", t.Docs, true)
+					xprintf("//\n")
+				}
+				g.generateUnion(t, u)
+				if g.opts.OrZero {
+					g.generateOrZero(t.Name, g.typeName(t.Name)+"{}")
+				}
+				continue
+			}
 			xprintMultiline("", t.Docs, true)
-			xprintf("type %s struct {\n", goExportedName(t.Name))
+			xprintf("type %s struct {\n", g.typeName(t.Name))
+			for _, name := range g.embeds(t) {
+				xprintf("\t%s\n", g.typeName(name))
+			}
+			embedded := g.embeddedFields(t)
 			for _, f := range t.Fields {
-				lines := xprintMultiline("\t", f.Docs, false)
-				what := fmt.Sprintf("field %s for type %s", f.Name, t.Name)
+				if embedded[f.Name] != "" {
+					continue
+				}
+				// A deprecation notice is only recognized in a doc comment
+				// above the field.
+				lines := xprintMultiline("\t", f.Docs, isDeprecated(f.Docs))
 				jsonStr := ""
 				switch f.Typewords[len(f.Typewords)-1] {
 				case "int64s", "uint64s":
 					jsonStr = ",string"
 				}
-				goFieldName := goExportedName(f.Name)
-				xprintf("\t%s %s", goFieldName, goType(what, f.Typewords))
+				goFieldName := g.fieldName(f.Name)
+				xprintf("\t%s %s", goFieldName, g.fieldGoType(t, f))
 				if goFieldName != f.Name || jsonStr != "" {
 					xprintf(" `json:\"")
 					if goFieldName != f.Name {
@@ -304,134 +533,325 @@ func (c *Client) call(ctx context.Context, functionName string, params []interfa
 				xprintSingleline(lines)
 				xprintf("\n")
 			}
+			if g.opts.ExtraFields {
+				xprintf("%s", extraField)
+			}
 			xprintf("}\n\n")
+			if g.opts.FastJSON {
+				g.generateFastJSON(t)
+			} else if g.opts.ExtraFields {
+				g.generateExtraJSON(t)
+			} else {
+				g.generatePlainJSON(t)
+			}
+			if g.opts.Validate {
+				g.generateValidateStruct(t)
+			}
+			if g.opts.OrZero {
+				g.generateOrZero(t.Name, g.typeName(t.Name)+"{}")
+			}
+			g.generateDefaults(t)
 		}
 
 		for _, t := range sec.Ints {
+			if g.sharedTypes[t.Name] {
+				continue
+			}
 			xprintMultiline("", t.Docs, true)
-			typeName := goExportedName(t.Name)
+			typeName := g.typeName(t.Name)
 			xprintf("type %s int\n", typeName)
-			if len(t.Values) == 0 {
-				continue
+			var values, names, keys []string
+			if len(t.Values) > 0 {
+				xprintf("const (\n")
+				for _, v := range t.Values {
+					lines := xprintMultiline("\t", v.Docs, isDeprecated(v.Docs))
+					xprintf("\t%s %s = %d", g.typeName(v.Name), typeName, v.Value)
+					xprintSingleline(lines)
+					xprintf("\n")
+					values = append(values, g.typeName(v.Name))
+					names = append(names, v.Name)
+					keys = append(keys, fmt.Sprint(v.Value))
+				}
+				xprintf(")\n\n")
 			}
-			xprintf("const (\n")
-			for _, v := range t.Values {
-				lines := xprintMultiline("\t", v.Docs, false)
-				xprintf("\t%s %s = %d", goExportedName(v.Name), typeName, v.Value)
-				xprintSingleline(lines)
-				xprintf("\n")
+			if g.isBitmask(t.Name) {
+				g.generateBitmask(t)
+				if g.opts.Validate {
+					g.generateValidateBitmask(t.Name, values)
+				}
+			} else if g.opts.Validate {
+				g.generateValidateEnum(t.Name, values, keys, "%d")
+			}
+			if g.opts.OrZero {
+				g.generateOrZero(t.Name, "0")
+			}
+			if g.opts.EnumHelpers {
+				g.generateEnumHelpers(t.Name, values, names, keys)
+			}
+			if g.opts.EnumUnknown && !g.isBitmask(t.Name) {
+				// Below the lowest value, so it is never documented.
+				unknown := -1
+				for _, v := range t.Values {
+					if v.Value <= unknown {
+						unknown = v.Value - 1
+					}
+				}
+				g.generateEnumUnknown(t.Name, fmt.Sprint(unknown), values, keys)
 			}
-			xprintf(")\n\n")
 		}
 
 		for _, t := range sec.Strings {
+			if g.sharedTypes[t.Name] {
+				continue
+			}
 			xprintMultiline("", t.Docs, true)
-			typeName := goExportedName(t.Name)
+			typeName := g.typeName(t.Name)
 			xprintf("type %s string\n", typeName)
-			if len(t.Values) == 0 {
-				continue
+			var values, names, keys []string
+			if len(t.Values) > 0 {
+				xprintf("const (\n")
+				for _, v := range t.Values {
+					lines := xprintMultiline("\t", v.Docs, isDeprecated(v.Docs))
+					xprintf("\t%s %s = %s", g.typeName(v.Name), typeName, strconv.Quote(v.Value))
+					xprintSingleline(lines)
+					xprintf("\n")
+					values = append(values, g.typeName(v.Name))
+					names = append(names, v.Name)
+					keys = append(keys, fmt.Sprint(v.Value))
+				}
+				xprintf(")\n\n")
 			}
-			xprintf("const (\n")
-			for _, v := range t.Values {
-				lines := xprintMultiline("\t", v.Docs, false)
-				xprintf("\t%s %s = %s", goExportedName(v.Name), typeName, strconv.Quote(v.Value))
-				xprintSingleline(lines)
-				xprintf("\n")
+			if g.opts.Validate {
+				g.generateValidateEnum(t.Name, values, keys, "%q")
+			}
+			if g.opts.OrZero {
+				g.generateOrZero(t.Name, `""`)
+			}
+			if g.opts.EnumHelpers {
+				g.generateEnumHelpers(t.Name, values, names, keys)
+			}
+			if g.opts.EnumUnknown {
+				g.generateEnumUnknown(t.Name, `""`, values, keys)
 			}
-			xprintf(")\n\n")
 		}
 	}
 
 	generateFunctions := func(sec *sherpadoc.Section) {
 		for _, fn := range sec.Functions {
-			whatParam := "pararameter for " + fn.Name
-			paramNames := []string{}
-			params := []string{}
+			whatParam := "parameter for " + fn.Name
+			paramNames := g.goParamNames(fn)
+			paramFields := ""
 			for _, p := range fn.Params {
-				paramType := goType(whatParam, p.Typewords)
-				paramName := goLocalName(p.Name)
-				paramNames = append(paramNames, paramName)
-				params = append(params, fmt.Sprintf("%s %s", paramName, paramType))
+				paramType := g.goTypewords(whatParam, p.Typewords)
+				paramFields += fmt.Sprintf("\t%s %s\n", goExportedName(p.Name), paramType)
+			}
+
+			// The parameters are written as JSON array. Encoding pointers to the fields
+			// into an interface does not allocate.
+			suffix := g.funcSuffix(fn.Name)
+			xprintf("type params%s struct {\n%s}\n\n", suffix, paramFields)
+			if g.opts.TinyGo {
+				// Without encoding/json, like the methods of the struct types with FastJSON.
+				xprintf("func (p *params%s) writeJSON(enc *json.Encoder, buf *bytes.Buffer) error {\n\tb, err := p.appendJSON(nil)\n\tbuf.Write(b)\n\treturn err\n}\n\n", suffix)
+				xprintf("func (p *params%s) appendJSON(b []byte) (_ []byte, err error) {\n\tb = append(b, '[')\n", suffix)
+				for i, p := range fn.Params {
+					if i > 0 {
+						xprintf("\tb = append(b, ',')\n")
+					}
+					xprintf("%s", indent(g.appendJSON(parseType(whatParam, p.Typewords), "p."+goExportedName(p.Name), 0, true), "\t"))
+				}
+				xprintf("\treturn append(b, ']'), nil\n}\n\n")
+			} else {
+				xprintf("func (p *params%s) writeJSON(enc *json.Encoder, buf *bytes.Buffer) error {\n\tbuf.WriteByte('[')\n", suffix)
+				for i, p := range fn.Params {
+					if i > 0 {
+						xprintf("\tbuf.WriteByte(',')\n")
+					}
+					typ := parseType(whatParam, p.Typewords)
+					x := "p." + goExportedName(p.Name)
+					if g.opts.NullableSlices && isSliceOrMap(typ) {
+						xprintf("\tif %s == nil {\n\t\tbuf.WriteString(%s)\n\t} else ", x, g.nilJSON(typ))
+					} else {
+						xprintf("\t")
+					}
+					xprintf("if err := enc.Encode(%s); err != nil {\n\t\treturn err\n\t}\n", jsonRef(typ, x))
+				}
+				xprintf("\tbuf.WriteByte(']')\n\treturn nil\n}\n\n")
 			}
 
-			returnVars := ""
 			returnTypes := ""
-			returnNames := ""
-			returnRefNames := []string{}
+			returnNames := []string{}
+			resultFields := ""
+			resultDecodes := ""
 			for i, t := range fn.Returns {
-				typ := goType(whatParam, t.Typewords)
-				name := fmt.Sprintf("r%d", i)
-				returnVars += fmt.Sprintf("\t\t%s %s\n", name, typ)
+				typ := g.goTypewords(whatParam, t.Typewords)
 				returnTypes += typ + ", "
-				returnNames += name + ", "
-				returnRefNames = append(returnRefNames, "&"+name)
-			}
-			if returnVars != "" {
-				returnVars = "\tvar (\n" + returnVars + "\t)\n"
+				resultFields += fmt.Sprintf("\tR%d %s\n", i, typ)
+				ref := jsonRef(parseType(whatParam, t.Typewords), fmt.Sprintf("r.R%d", i))
+				resultDecodes += fmt.Sprintf("\tif err := json.Unmarshal(l[%d], %s); err != nil {\n\t\treturn fmt.Errorf(\"result %d: %%w\", err)\n\t}\n", i, ref, i)
 			}
-			xprintMultiline("", fn.Docs, true)
-			xprintf(`func (c *Client) %s(ctx context.Context, %s) (%serror) {
-%s	err := c.call(ctx, "%s", []interface{}{%s}, []interface{}{%s})
-	return %serr
+			var resultVars, resultArg string
+			switch len(fn.Returns) {
+			case 0:
+				resultArg = "nil"
+			case 1:
+				resultVars = fmt.Sprintf("\tvar r0 %s\n", strings.TrimSuffix(returnTypes, ", "))
+				resultArg = jsonRef(parseType(whatParam, fn.Returns[0].Typewords), "r0")
+				returnNames = append(returnNames, "r0")
+			default:
+				// Multiple results are a JSON array, each element is decoded into the field
+				// of its type.
+				xprintf("type result%s struct {\n%s}\n\n", suffix, resultFields)
+				xprintf(`func (r *result%s) UnmarshalJSON(buf []byte) error {
+	var l []json.RawMessage
+	if err := json.Unmarshal(buf, &l); err != nil {
+		return err
+	}
+	if len(l) != %d {
+		return fmt.Errorf("got %%d results, expected %d", len(l))
+	}
+%s	return nil
 }
 
-`, goExportedName(fn.Name), strings.Join(params, ", "), returnTypes, returnVars, fn.Name, strings.Join(paramNames, ", "), strings.Join(returnRefNames, ", "), returnNames)
+`, suffix, len(fn.Returns), len(fn.Returns), resultDecodes)
+				resultVars = fmt.Sprintf("\tvar result result%s\n", suffix)
+				resultArg = "&result"
+				for i := range fn.Returns {
+					returnNames = append(returnNames, fmt.Sprintf("result.R%d", i))
+				}
+			}
+
+			var validateParams, validateResults string
+			if g.opts.Validate {
+				zero := ""
+				for _, name := range returnNames {
+					zero += name + ", "
+				}
+				validateParams = g.generateValidateParams(fn, zero)
+				if len(fn.Returns) > 0 {
+					validateResults = g.generateValidateResults(fn, returnNames)
+				}
+			}
+
+			callInfoFields := functionCallInfo(fn) + g.driftCallInfo(fn)
+
+			xprintLines("", g.exampleDocLines(fn, goDocLines(fn.Docs, g.opts.DocWidth)))
+			xprintf("func (c *%s) %s {\n%s%s", g.clientName(), g.goSignature(fn), resultVars, validateParams)
+			call := fmt.Sprintf(`c.call(ctx, callInfo{name: "%s"%s}, &params%s{%s}, %s)`, fn.Name, callInfoFields, suffix, strings.Join(paramNames, ", "), resultArg)
+			if len(returnNames) == 0 {
+				xprintf("\treturn %s\n}\n\n", call)
+			} else {
+				xprintf("\terr := %s\n%s\treturn %s, err\n}\n\n", call, validateResults, strings.Join(returnNames, ", "))
+			}
+
+			if g.opts.NoCtxMethods {
+				name := g.goName(fn.Name)
+				args := append([]string{"context.Background()"}, paramNames...)
+				xprintf("// %sNoCtx calls %s with context.Background().\n", name, name)
+				xprintf("func (c *%s) %s {\n\treturn c.%s(%s)\n}\n\n", g.clientName(), g.goSignatureName(fn, name+"NoCtx", false), name, strings.Join(args, ", "))
+			}
+			if g.opts.RawMethods {
+				name := g.goName(fn.Name)
+				params := []string{"ctx context.Context"}
+				for i, p := range fn.Params {
+					params = append(params, fmt.Sprintf("%s %s", paramNames[i], g.goTypewords(whatParam, p.Typewords)))
+				}
+				var validate string
+				if validateParams != "" {
+					validate = g.validateParamsCall(fn, "nil, ")
+				}
+				xprintf("// %sRaw calls %s, returning the result as JSON, without decoding it.\n", name, name)
+				xprintf("func (c *%s) %sRaw(%s) (json.RawMessage, error) {\n%s\tvar raw json.RawMessage\n", g.clientName(), name, strings.Join(params, ", "), validate)
+				xprintf("\terr := c.call(ctx, callInfo{name: \"%s\"%s}, &params%s{%s}, &raw)\n\treturn raw, err\n}\n\n", fn.Name, callInfoFields, suffix, strings.Join(paramNames, ", "))
+			}
+			if done := g.await(fn); done != "" {
+				g.generateAwait(fn, done)
+			}
+			if path, events := g.events(fn); path != "" {
+				g.generateSubscribe(fn, path, events)
+			}
+			if g.hasIter(fn) {
+				g.generateIter(fn)
+			}
 		}
 	}
 
 	var generateSection func(sec *sherpadoc.Section)
 	generateSection = func(sec *sherpadoc.Section) {
-		generateTypes(sec)
-		generateFunctions(sec)
+		if g.opts.Snippet != SnippetClient {
+			generateTypes(sec)
+		}
+		if g.opts.Snippet != SnippetTypes {
+			generateFunctions(sec)
+		}
 		for _, subsec := range sec.Sections {
 			generateSection(subsec)
 		}
 	}
-	generateSection(&doc)
+	generateSection(doc)
+	if g.opts.Catalog && g.opts.Snippet != SnippetTypes {
+		g.generateCatalog()
+	}
+	if g.opts.SchemaDrift && g.opts.Snippet != SnippetTypes {
+		g.generateDriftStructs()
+	}
 
-	err = bout.Flush()
-	if err != nil {
-		panic(genError{err})
+	g.flush()
+}
+
+// generateOrZero writes an OrZero method for type name, with zero as its zero
+// value, see Options.OrZero.
+func (g *generator) generateOrZero(name, zero string) {
+	typeName := g.typeName(name)
+	g.printf(`// OrZero returns the value v points to, or the zero value if v is nil, e.g.
+// for a null result or field.
+func (v *%s) OrZero() %s {
+	if v == nil {
+		return %s
 	}
-	return nil
+	return *v
 }
 
-func goType(what string, typeTokens []string) string {
-	t := parseType(what, typeTokens)
-	return t.GoType()
+`, typeName, typeName, zero)
 }
 
-func parseType(what string, tokens []string) sherpaType {
-	checkOK := func(ok bool, v interface{}, msg string) {
-		if !ok {
-			panic(genError{fmt.Errorf("invalid type for %s: %s, saw %q", what, msg, v)})
-		}
-	}
-	checkOK(len(tokens) > 0, tokens, "need at least one element")
-	s := tokens[0]
-	tokens = tokens[1:]
-	switch s {
-	case "any", "bool", "int8", "uint8", "int16", "uint16", "int32", "uint32", "int64", "uint64", "int64s", "uint64s", "float32", "float64", "string", "timestamp":
-		if len(tokens) != 0 {
-			checkOK(false, tokens, "leftover tokens after base type")
-		}
-		return baseType{s}
-	case "nullable":
-		return nullableType{parseType(what, tokens)}
-	case "[]":
-		return arrayType{parseType(what, tokens)}
-	case "{}":
-		return objectType{parseType(what, tokens)}
-	default:
-		if len(tokens) != 0 {
-			checkOK(false, tokens, "leftover tokens after identifier type")
+// jsonRef returns a Go expression with a pointer to x, of type t, for encoding
+// and decoding as JSON. For sherpa types "int64s" and "uint64s", x is converted
+// to the generated types jsonInt64s and jsonUint64s that use JSON strings.
+func jsonRef(t Type, x string) string {
+	if bt, ok := t.(BaseType); ok {
+		switch bt.Name {
+		case "int64s":
+			return "(*jsonInt64s)(&" + x + ")"
+		case "uint64s":
+			return "(*jsonUint64s)(&" + x + ")"
 		}
-		return identType{s}
 	}
+	return "&" + x
 }
 
+// jsonValue is like jsonRef, but returns an expression with the value of x.
+func jsonValue(t Type, x string) string {
+	if bt, ok := t.(BaseType); ok {
+		switch bt.Name {
+		case "int64s":
+			return "jsonInt64s(" + x + ")"
+		case "uint64s":
+			return "jsonUint64s(" + x + ")"
+		}
+	}
+	return x
+}
+
+// docLines returns the lines of documentation s, without annotations.
 func docLines(s string) []string {
-	s = strings.TrimSpace(s)
+	var lines []string
+	for _, line := range strings.Split(s, "\n") {
+		if !isAnnotation(line) {
+			lines = append(lines, line)
+		}
+	}
+	s = strings.TrimSpace(strings.Join(lines, "\n"))
 	if s == "" {
 		return nil
 	}
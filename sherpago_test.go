@@ -0,0 +1,198 @@
+package sherpago
+
+import (
+	"bytes"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/printer"
+	"go/token"
+	"strings"
+	"testing"
+
+	"github.com/mjl-/sherpadoc"
+)
+
+// signatureDoc has functions with 0, 1 and many parameters and results, and
+// with parameters that must be renamed.
+const signatureDoc = `{
+	"Name": "Test",
+	"Docs": "",
+	"Functions": [
+		{"Name": "none", "Docs": "", "Params": [], "Returns": []},
+		{"Name": "one", "Docs": "", "Params": [{"Name": "s", "Typewords": ["string"]}], "Returns": [{"Name": "r", "Typewords": ["string"]}]},
+		{"Name": "many", "Docs": "", "Params": [{"Name": "s", "Typewords": ["string"]}, {"Name": "n", "Typewords": ["int32"]}, {"Name": "c", "Typewords": ["[]", "bool"]}], "Returns": [{"Name": "r0", "Typewords": ["string"]}, {"Name": "r1", "Typewords": ["nullable", "int32"]}, {"Name": "r2", "Typewords": ["timestamp"]}]},
+		{"Name": "manyParams", "Docs": "", "Params": [{"Name": "a", "Typewords": ["string"]}, {"Name": "b", "Typewords": ["int64s"]}], "Returns": []},
+		{"Name": "manyResults", "Docs": "", "Params": [], "Returns": [{"Name": "a", "Typewords": ["string"]}, {"Name": "b", "Typewords": ["{}", "any"]}]},
+		{"Name": "renamed", "Docs": "", "Params": [{"Name": "c", "Typewords": ["string"]}, {"Name": "c0", "Typewords": ["string"]}, {"Name": "type", "Typewords": ["string"]}], "Returns": [{"Name": "r", "Typewords": ["string"]}]}
+	],
+	"Sections": [],
+	"Structs": [],
+	"Ints": [],
+	"Strings": [],
+	"SherpaVersion": 0,
+	"SherpadocVersion": 1
+}`
+
+// signatureMethods are the expected declarations of the client methods for
+// signatureDoc.
+var signatureMethods = map[string]string{
+	"None":        "func (c *Client) None(ctx context.Context) error",
+	"One":         "func (c *Client) One(ctx context.Context, s string) (string, error)",
+	"Many":        "func (c *Client) Many(ctx context.Context, s string, n int32, c0 []bool) (string, *int32, time.Time, error)",
+	"ManyParams":  "func (c *Client) ManyParams(ctx context.Context, a string, b int64) error",
+	"ManyResults": "func (c *Client) ManyResults(ctx context.Context) (string, map[string]interface{}, error)",
+	"Renamed":     "func (c *Client) Renamed(ctx context.Context, c1 string, c0 string, type0 string) (string, error)",
+}
+
+func TestSignatures(t *testing.T) {
+	opts := Options{PackageName: "example", BaseURL: "http://localhost/example/"}
+	files, err := GenerateFiles(strings.NewReader(signatureDoc), opts)
+	if err != nil {
+		t.Fatalf("generating client: %v", err)
+	}
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, "example.go", files["example.go"], 0)
+	if err != nil {
+		t.Fatalf("parsing client: %v", err)
+	}
+	seen := map[string]bool{}
+	for _, decl := range f.Decls {
+		fd, ok := decl.(*ast.FuncDecl)
+		if !ok || fd.Recv == nil || signatureMethods[fd.Name.Name] == "" {
+			continue
+		}
+		fd.Body = nil
+		var b bytes.Buffer
+		if err := printer.Fprint(&b, fset, fd); err != nil {
+			t.Fatal(err)
+		}
+		if s, exp := b.String(), signatureMethods[fd.Name.Name]; s != exp {
+			t.Errorf("got method declaration\n\t%s\nexpected\n\t%s", s, exp)
+		}
+		seen[fd.Name.Name] = true
+	}
+	for name := range signatureMethods {
+		if !seen[name] {
+			t.Errorf("no method %s", name)
+		}
+	}
+
+	// The methods compile, and can be called.
+	testGeneratedDoc(t, signatureDoc, Options{}, `import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+var (
+	_ func(context.Context) error                                                     = (*Client)(nil).None
+	_ func(context.Context, string) (string, error)                                   = (*Client)(nil).One
+	_ func(context.Context, string, int32, []bool) (string, *int32, time.Time, error) = (*Client)(nil).Many
+	_ func(context.Context, string, int64) error                                      = (*Client)(nil).ManyParams
+	_ func(context.Context) (string, map[string]interface{}, error)                   = (*Client)(nil).ManyResults
+	_ func(context.Context, string, string, string) (string, error)                   = (*Client)(nil).Renamed
+)
+
+func TestSignatures(t *testing.T) {
+	srv := newServer(t, func(r *http.Request, function string, params []string) (string, error) {
+		if function == "renamed" {
+			return strings.Join(params, ","), nil
+		}
+		return "", nil
+	})
+	c := NewClient()
+	c.BaseURL = srv.URL + "/"
+	if err := c.None(context.Background()); err != nil {
+		t.Fatalf("calling none: %v", err)
+	}
+	if r, err := c.One(context.Background(), "x"); err != nil || r != "" {
+		t.Fatalf("calling one: %q, %v", r, err)
+	}
+	if r, err := c.Renamed(context.Background(), "a", "b", "c"); err != nil || r != "a,b,c" {
+		t.Fatalf("calling renamed: %q, %v", r, err)
+	}
+}
+`)
+}
+
+func TestGenerate(t *testing.T) {
+	// The legacy Generate writes formatted code, as GenerateFiles.
+	var b bytes.Buffer
+	if err := Generate(strings.NewReader(signatureDoc), &b, "example", "http://localhost/example/"); err != nil {
+		t.Fatalf("generating client: %v", err)
+	}
+	buf, err := format.Source(b.Bytes())
+	if err != nil {
+		t.Fatalf("formatting client: %v", err)
+	}
+	if !bytes.Equal(buf, b.Bytes()) {
+		t.Fatalf("generated client is not formatted")
+	}
+}
+
+func TestTypeCycles(t *testing.T) {
+	type fields map[string][]string
+	tests := []struct {
+		name    string
+		structs map[string]fields
+		sub     map[string]fields // In a subsection.
+		err     string            // Expected path in error, or empty if valid.
+	}{
+		{"direct", map[string]fields{"A": {"a": {"A"}}}, nil, "A.a -> A"},
+		{"mutual", map[string]fields{"A": {"b": {"B"}}, "B": {"a": {"A"}}}, nil, "A.b -> B.a -> A"},
+		{"subsection", map[string]fields{"A": {"b": {"B"}}}, map[string]fields{"B": {"a": {"A"}}}, "A.b -> B.a -> A"},
+		{"path", map[string]fields{"A": {"b": {"B"}}, "B": {"b": {"B"}}}, nil, "B.b -> B"},
+		{"nullable", map[string]fields{"A": {"a": {"nullable", "A"}}}, nil, ""},
+		{"array", map[string]fields{"A": {"l": {"[]", "A"}}}, nil, ""},
+		{"object", map[string]fields{"A": {"m": {"{}", "A"}}}, nil, ""},
+		{"mutual nullable", map[string]fields{"A": {"b": {"B"}}, "B": {"a": {"nullable", "A"}}}, nil, ""},
+		{"mutual array", map[string]fields{"A": {"b": {"B"}}, "B": {"l": {"[]", "A"}}}, nil, ""},
+		{"shared", map[string]fields{"A": {"b": {"C"}, "c": {"C"}}, "C": {"s": {"string"}}}, nil, ""},
+	}
+	structs := func(l map[string]fields) []sherpadoc.Struct {
+		var r []sherpadoc.Struct
+		for name, fields := range l {
+			st := sherpadoc.Struct{Name: name}
+			for fname, tw := range fields {
+				st.Fields = append(st.Fields, sherpadoc.Field{Name: fname, Typewords: tw})
+			}
+			r = append(r, st)
+		}
+		return r
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			doc := &sherpadoc.Section{Name: "Test", Structs: structs(test.structs)}
+			if test.sub != nil {
+				doc.Sections = []*sherpadoc.Section{{Name: "Sub", Structs: structs(test.sub)}}
+			}
+			err := func() (err error) {
+				defer recoverGenError(&err)
+				checkTypeCycles(doc)
+				return nil
+			}()
+			if test.err == "" && err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			} else if test.err != "" && (err == nil || !strings.HasSuffix(err.Error(), ": "+test.err)) {
+				t.Fatalf("got error %v, expected one for %s", err, test.err)
+			}
+		})
+	}
+}
+
+func TestUndeclaredType(t *testing.T) {
+	// Sherpadoc only has structs and enums as named types. References to other
+	// names, e.g. to a named array type, are rejected instead of generating code
+	// with undeclared identifiers.
+	doc := strings.Replace(signatureDoc, `"Typewords": ["int32"]}, {"Name": "c"`, `"Typewords": ["IDs"]}, {"Name": "c"`, 1)
+	if doc == signatureDoc {
+		t.Fatal("no parameter replaced")
+	}
+	_, err := GenerateFiles(strings.NewReader(doc), Options{PackageName: "example", BaseURL: "http://localhost/example/"})
+	if err == nil || !strings.Contains(err.Error(), `"IDs"`) {
+		t.Fatalf("got error %v, expected error about type IDs", err)
+	}
+}
@@ -0,0 +1,270 @@
+package sherpago
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/mjl-/sherpadoc"
+)
+
+// sseCode is the Go code for receiving server-sent events, for the Subscribe
+// methods of functions with the "events" annotation. It is a format string with
+// the name of the client type as parameter.
+const sseCode = `// subscribe connects to the server-sent events at path, relative to the base
+// URL, and calls deliver for each event from a new goroutine, reconnecting
+// when the connection is lost, until the context is done, deliver returns
+// false, or reconnecting fails with an error that is not temporary, which is
+// delivered, or the client is closed. Then done is called. The error of the
+// first connection is returned.
+func (c *%[1]s) subscribe(ctx context.Context, path string, query url.Values, deliver func(name, id string, data []byte, err error) bool, done func()) error {
+	ctx, cancel := context.WithCancel(ctx)
+	remove := c.closer.add(cancel)
+	resp, _, err := c.connectEvents(ctx, path, query, "")
+	if err != nil {
+		remove()
+		cancel()
+		return err
+	}
+	go func() {
+		defer done()
+		defer remove()
+		defer cancel()
+		var lastID string
+		retry := time.Second
+		wait := retry
+		for {
+			if resp != nil {
+				var ok bool
+				lastID, retry, ok = readEvents(resp.Body, lastID, retry, deliver)
+				resp.Body.Close()
+				if !ok {
+					return
+				}
+				wait = retry
+			} else if wait *= 2; wait > time.Minute {
+				wait = time.Minute
+			}
+			t := time.NewTimer(wait)
+			select {
+			case <-ctx.Done():
+				t.Stop()
+				return
+			case <-t.C:
+			}
+			var temporary bool
+			resp, temporary, err = c.connectEvents(ctx, path, query, lastID)
+			if err != nil && ctx.Err() != nil {
+				return
+			} else if err != nil && !temporary {
+				deliver("", "", nil, err)
+				return
+			}
+		}
+	}()
+	return nil
+}
+
+// connectEvents makes the request for the server-sent events at path, see
+// subscribe, returning the response if the server accepted it, or an error and
+// whether it is temporary.
+func (c *%[1]s) connectEvents(ctx context.Context, path string, query url.Values, lastID string) (*http.Response, bool, error) {
+	baseURL := c.BaseURL
+	if u, ok := ctx.Value(baseURLContextKey{}).(string); ok {
+		baseURL = u
+	}
+	u, err := url.Parse(baseURL)
+	if err != nil {
+		return nil, false, &sherpa.Error{Code: "sherpa:http", Message: "parsing base url: " + err.Error()}
+	}
+	if !u.IsAbs() && c.origin != nil {
+		u = c.origin.ResolveReference(u)
+	}
+	u = u.ResolveReference(&url.URL{Path: path})
+	user := u.User
+	u.User = nil
+	if len(query) > 0 {
+		u.RawQuery = query.Encode()
+	}
+	req, err := http.NewRequest("GET", u.String(), nil)
+	if err != nil {
+		return nil, false, &sherpa.Error{Code: "sherpa:http", Message: "constructing request: " + err.Error()}
+	}
+	req.Header.Set("Accept", "text/event-stream")
+	if lastID != "" {
+		req.Header.Set("Last-Event-ID", lastID)
+	}
+	setHeaders(req.Header, c.headers)
+	if c.credentials != nil {
+		h, err := c.credentials.Credentials(ctx)
+		if err != nil {
+			return nil, false, &sherpa.Error{Code: "sherpa:http", Message: "getting credentials: " + err.Error()}
+		}
+		setHeaders(req.Header, h)
+	}
+	if h, ok := ctx.Value(headerContextKey{}).(http.Header); ok {
+		setHeaders(req.Header, h)
+	}
+	if user != nil {
+		password, _ := user.Password()
+		req.SetBasicAuth(user.Username(), password)
+	}
+	resp, err := c.Client.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, true, &sherpa.Error{Code: sherpa.SherpaHTTPError, Message: "connecting for events: " + err.Error()}
+	}
+	if resp.StatusCode != 200 {
+		resp.Body.Close()
+		temporary := resp.StatusCode >= 500 || resp.StatusCode == 429
+		return nil, temporary, &sherpa.Error{Code: sherpa.SherpaHTTPError, Message: "HTTP error from server for events: " + resp.Status}
+	}
+	return resp, true, nil
+}
+
+// readEvents reads server-sent events from r and calls deliver for each, until
+// r fails or deliver returns false. It returns the ID of the last event and the
+// time to wait before reconnecting, updated from the events, and whether to
+// reconnect.
+func readEvents(r io.Reader, lastID string, retry time.Duration, deliver func(name, id string, data []byte, err error) bool) (string, time.Duration, bool) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 16<<20)
+	var name string
+	var data []byte
+	for scanner.Scan() {
+		line := strings.TrimSuffix(scanner.Text(), "\r")
+		if line == "" {
+			if data != nil {
+				if name == "" {
+					name = "message"
+				}
+				if !deliver(name, lastID, bytes.TrimSuffix(data, []byte("\n")), nil) {
+					return lastID, retry, false
+				}
+			}
+			name = ""
+			data = nil
+			continue
+		}
+		t := strings.SplitN(line, ":", 2)
+		value := ""
+		if len(t) == 2 {
+			value = strings.TrimPrefix(t[1], " ")
+		}
+		switch t[0] {
+		case "event":
+			name = value
+		case "data":
+			data = append(append(data, value...), '\n')
+		case "id":
+			lastID = value
+		case "retry":
+			if ms, err := strconv.Atoi(value); err == nil && ms >= 0 {
+				retry = time.Duration(ms) * time.Millisecond
+			}
+		}
+	}
+	return lastID, retry, true
+}
+
+`
+
+// sseEvent is an event of a function with the "events" annotation.
+type sseEvent struct {
+	name  string // Event name in the stream.
+	field string // Go name of the field of the Event type.
+	typ   string // Sherpadoc name of the struct type.
+}
+
+// events returns the path of the server-sent events for fn, from its "events"
+// annotation, and the events, by its results, or the empty string if fn has no
+// such annotation. The name of an event is that of its result, or of its type
+// for results without name.
+func (g *generator) events(fn *sherpadoc.Function) (string, []sseEvent) {
+	what := "function " + fn.Name
+	path, ok := annotations(what, fn.Docs, functionAnnotations)["events"]
+	if !ok {
+		return "", nil
+	}
+	if len(fn.Returns) == 0 {
+		panic(genError{fmt.Errorf("sherpago annotation \"events\" for %s requires results with the types of the events", what)})
+	}
+	var l []sseEvent
+	names := map[string]bool{}
+	fields := map[string]bool{"ID": true, "Err": true}
+	for _, r := range fn.Returns {
+		tw := r.Typewords
+		if len(tw) != 1 || g.structs[tw[0]].Name == "" {
+			panic(genError{fmt.Errorf("result %q of %s must be a struct type for sherpago annotation \"events\"", r.Name, what)})
+		}
+		ev := sseEvent{r.Name, g.typeName(tw[0]), tw[0]}
+		if ev.name == "" {
+			ev.name = tw[0]
+		}
+		if names[ev.name] || fields[ev.field] {
+			panic(genError{fmt.Errorf("duplicate event %q or type %q in results of %s for sherpago annotation \"events\"", ev.name, tw[0], what)})
+		}
+		names[ev.name] = true
+		fields[ev.field] = true
+		l = append(l, ev)
+	}
+	return path, l
+}
+
+// subscribeName and eventName return the names of the Subscribe method and
+// the Event type for function name.
+func (g *generator) subscribeName(name string) string {
+	return "Subscribe" + g.goName(name)
+}
+
+func (g *generator) eventName(name string) string {
+	return g.goName(name) + "Event"
+}
+
+// generateSubscribe writes the Event type and Subscribe method for fn, for the
+// server-sent events at path.
+func (g *generator) generateSubscribe(fn *sherpadoc.Function, path string, events []sseEvent) {
+	eventName := g.eventName(fn.Name)
+	var fields, cases string
+	for _, ev := range events {
+		fields += fmt.Sprintf("\t%s *%s // Event %s.\n", ev.field, g.typeName(ev.typ), strconv.Quote(ev.name))
+		cases += fmt.Sprintf("\t\tcase %s:\n\t\t\te.%s = new(%s)\n\t\t\terr = json.Unmarshal(data, e.%s)\n", strconv.Quote(ev.name), ev.field, g.typeName(ev.typ), ev.field)
+	}
+	g.printf(`// %[1]s is an event received by %[2]s, with the field
+// for the event set.
+type %[1]s struct {
+	ID  string // ID of the last event from the server, if any.
+	Err error  // If set, the event could not be decoded, or the subscription ended.
+%[3]s}
+
+// %[2]s connects to the server-sent events at %[4]s,
+// relative to the base URL, with the parameters in query, and returns a
+// channel with the events. It reconnects when the connection is lost, and the
+// channel is closed when ctx is done. Unknown events are skipped.
+func (c *%[5]s) %[2]s(ctx context.Context, query url.Values) (<-chan %[1]s, error) {
+	events := make(chan %[1]s)
+	deliver := func(name, id string, data []byte, err error) bool {
+		e := %[1]s{ID: id, Err: err}
+		if err == nil {
+			switch name {
+%[6]s		default:
+				return true
+			}
+			if err != nil {
+				e = %[1]s{ID: id, Err: fmt.Errorf("decoding event %%q: %%w", name, err)}
+			}
+		}
+		select {
+		case events <- e:
+			return true
+		case <-ctx.Done():
+			return false
+		}
+	}
+	err := c.subscribe(ctx, %[7]s, query, deliver, func() { close(events) })
+	if err != nil {
+		return nil, err
+	}
+	return events, nil
+}
+
+`, eventName, g.subscribeName(fn.Name), fields, strconv.Quote(path), g.clientName(), cases, strconv.Quote(path))
+}
@@ -0,0 +1,150 @@
+package sherpago
+
+// statsCode is the Go code with the option for keeping statistics of calls. It
+// is a format string with the names of the client type, the option type, the
+// FunctionStats type and the WithStats function as parameters.
+const statsCode = `// %[3]s are statistics of the calls of a function, see %[4]s.
+type %[3]s struct {
+	Calls  int64            // Completed calls, including those that failed.
+	Errors map[string]int64 // Failed calls by error code, e.g. "sherpa:http", "" for errors that are not sherpa errors.
+
+	// Durations of the calls. The quantiles are estimates, off by at most 10%%.
+	Mean, P50, P90, P99, Max time.Duration
+}
+
+// %[4]s returns an option that makes the client keep statistics of its calls,
+// and those of its copies made with With, by function, returned by Stats. For
+// programs without a metrics system. A call with retries counts once, with the
+// duration of all attempts.
+func %[4]s() %[2]s {
+	return func(c *%[1]s) {
+		c.stats = &callStats{functions: map[string]*functionCounters{}}
+	}
+}
+
+// Stats returns the statistics of the calls made since %[4]s, by function
+// name as in the API, or nil without %[4]s.
+func (c *%[1]s) Stats() map[string]%[3]s {
+	if c.stats == nil {
+		return nil
+	}
+	return c.stats.snapshot()
+}
+
+// callStats keeps the statistics of the calls of a client, see %[4]s.
+type callStats struct {
+	sync.Mutex
+	functions map[string]*functionCounters
+}
+
+type functionCounters struct {
+	calls      int64
+	errors     map[string]int64
+	total, max time.Duration
+	buckets    [128]int64 // Calls by duration, see latencyBucket.
+}
+
+// latencyBucket returns the index of the histogram bucket for d: 0 for
+// durations up to 1µs, then buckets growing by a factor 2^(1/4), the last also
+// for longer durations.
+func latencyBucket(d time.Duration) int {
+	if d <= time.Microsecond {
+		return 0
+	}
+	i := 1 + int(4*math.Log2(float64(d)/float64(time.Microsecond)))
+	if i > 127 {
+		return 127
+	}
+	return i
+}
+
+func (s *callStats) record(function string, d time.Duration, err error) {
+	s.Lock()
+	defer s.Unlock()
+	fs := s.functions[function]
+	if fs == nil {
+		fs = &functionCounters{errors: map[string]int64{}}
+		s.functions[function] = fs
+	}
+	fs.calls++
+	fs.total += d
+	if d > fs.max {
+		fs.max = d
+	}
+	fs.buckets[latencyBucket(d)]++
+	if err != nil {
+		var code string
+		if serr, ok := err.(*sherpa.Error); ok {
+			code = serr.Code
+		}
+		fs.errors[code]++
+	}
+}
+
+func (s *callStats) snapshot() map[string]%[3]s {
+	s.Lock()
+	defer s.Unlock()
+	r := map[string]%[3]s{}
+	for name, fs := range s.functions {
+		st := %[3]s{Calls: fs.calls, Errors: map[string]int64{}, Mean: fs.total / time.Duration(fs.calls), Max: fs.max}
+		for code, n := range fs.errors {
+			st.Errors[code] = n
+		}
+		// The middle of the bucket with the quantile, on a log scale.
+		quantile := func(q float64) time.Duration {
+			n := int64(math.Ceil(q * float64(fs.calls)))
+			var sum int64
+			for i, count := range fs.buckets {
+				sum += count
+				if sum < n {
+					continue
+				}
+				d := time.Microsecond
+				if i > 0 {
+					d = time.Duration(float64(time.Microsecond) * math.Exp2((float64(i)-0.5)/4))
+				}
+				if d > fs.max {
+					d = fs.max
+				}
+				return d
+			}
+			return fs.max
+		}
+		st.P50, st.P90, st.P99 = quantile(0.5), quantile(0.9), quantile(0.99)
+		r[name] = st
+	}
+	return r
+}
+
+`
+
+// expvarCode is the Go code with the option for publishing counters of calls
+// with expvar, see Options.Expvar. It is a format string with the names of the
+// client type, the option type and the WithExpvar function as parameters.
+const expvarCode = `// %[3]s returns an option that makes the client count its calls, and those
+// of its copies made with With, in the expvar.Map published as name prefix, e.g.
+// "api", with keys "<function>.calls", "<function>.errors" and
+// "<function>.errors.<code>" for sherpa errors, with function the name in the
+// API. Clients with the same prefix share the map. Package expvar serves the
+// variables at /debug/vars of http.DefaultServeMux. It panics if prefix was
+// published with a variable that is not an expvar.Map.
+func %[3]s(prefix string) %[2]s {
+	m, ok := expvar.Get(prefix).(*expvar.Map)
+	if !ok {
+		m = expvar.NewMap(prefix)
+	}
+	return func(c *%[1]s) {
+		c.expvars = func(function string, err error) {
+			m.Add(function+".calls", 1)
+			if err == nil {
+				return
+			}
+			m.Add(function+".errors", 1)
+			if serr, ok := err.(*sherpa.Error); ok {
+				m.Add(function+".errors."+serr.Code, 1)
+			}
+		}
+	}
+}
+
+`
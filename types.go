@@ -0,0 +1,115 @@
+package sherpago
+
+import (
+	"fmt"
+)
+
+// Type is a sherpa type from the typewords in a sherpadoc, as parsed by
+// ParseType. It is one of BaseType, NullableType, ArrayType, ObjectType or
+// IdentType.
+type Type interface {
+	// GoType returns the Go type as used in the generated package. Named types
+	// are not qualified with a package.
+	GoType() string
+}
+
+// BaseType is one of: "any", "bool", "int8", "uint8", "int16", "uint16",
+// "int32", "uint32", "int64", "uint64", "int64s", "uint64s", "float32", "float64",
+// "string", "timestamp".
+type BaseType struct {
+	Name string
+}
+
+// NullableType is: "nullable" <type>.
+type NullableType struct {
+	Type Type
+}
+
+// ArrayType is: "[]" <type>
+type ArrayType struct {
+	Type Type
+}
+
+// ObjectType is: "{}" <type>
+type ObjectType struct {
+	Value Type
+}
+
+// IdentType is: [a-zA-Z][a-zA-Z0-9]*, a reference to a named struct or enum type.
+type IdentType struct {
+	Name string
+}
+
+// GoType returns the Go type for t. The "any" type becomes interface{},
+// "timestamp" time.Time and "int64s" and "uint64s" int64 and uint64, which
+// are encoded as strings in JSON.
+func (t BaseType) GoType() string {
+	switch t.Name {
+	case "any":
+		return "interface{}"
+	case "timestamp":
+		return "time.Time"
+	case "int64s":
+		return "int64"
+	case "uint64s":
+		return "uint64"
+	default:
+		return t.Name
+	}
+}
+
+// GoType returns a pointer to the Go type of t.Type.
+func (t NullableType) GoType() string {
+	return "*" + t.Type.GoType()
+}
+
+// GoType returns a slice of the Go type of t.Type.
+func (t ArrayType) GoType() string {
+	return "[]" + t.Type.GoType()
+}
+
+// GoType returns a map with string keys and values of the Go type of t.Value.
+func (t ObjectType) GoType() string {
+	return fmt.Sprintf("map[string]%s", t.Value.GoType())
+}
+
+// GoType returns the name of the named type.
+func (t IdentType) GoType() string {
+	return t.Name
+}
+
+// ParseType parses typewords, as found in sherpadoc function parameters, return
+// values and struct fields. Named types are not checked for existence.
+func ParseType(typewords []string) (t Type, retErr error) {
+	defer recoverGenError(&retErr)
+	return parseType("typewords", typewords), nil
+}
+
+func parseType(what string, tokens []string) Type {
+	checkOK := func(ok bool, v interface{}, msg string) {
+		if !ok {
+			panic(genError{fmt.Errorf("invalid type for %s: %s, saw %q", what, msg, v)})
+		}
+	}
+	checkOK(len(tokens) > 0, tokens, "need at least one element")
+	s := tokens[0]
+	tokens = tokens[1:]
+	switch s {
+	case "any", "bool", "int8", "uint8", "int16", "uint16", "int32", "uint32", "int64", "uint64", "int64s", "uint64s", "float32", "float64", "string", "timestamp":
+		if len(tokens) != 0 {
+			checkOK(false, tokens, "leftover tokens after base type")
+		}
+		return BaseType{s}
+	case "nullable":
+		return NullableType{parseType(what, tokens)}
+	case "[]":
+		return ArrayType{parseType(what, tokens)}
+	case "{}":
+		return ObjectType{parseType(what, tokens)}
+	default:
+		if len(tokens) != 0 {
+			checkOK(false, tokens, "leftover tokens after identifier type")
+		}
+		return IdentType{s}
+	}
+}
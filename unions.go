@@ -0,0 +1,145 @@
+package sherpago
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/mjl-/sherpadoc"
+)
+
+// union is a struct type with the "union" and "variants" annotations. In Go,
+// it has a single field Value with one of the variants, struct types that are
+// told apart by the value of a string field.
+type union struct {
+	field    string // JSON name of the discriminator field in the variants.
+	variants []unionVariant
+}
+
+type unionVariant struct {
+	kind string // Value of the discriminator field.
+	typ  string // Name of the struct type.
+}
+
+// union returns the union for struct type name, or nil if it is not a union.
+func (g *generator) union(name string) *union {
+	l := g.typeAnnotations(name)
+	field, isUnion := l["union"]
+	variants, hasVariants := l["variants"]
+	if !isUnion && !hasVariants {
+		return nil
+	}
+	what := "type " + name
+	if !isUnion || !hasVariants {
+		panic(genError{fmt.Errorf("sherpago annotations \"union\" and \"variants\" for %s must be used together", what)})
+	}
+	if _, ok := g.structs[name]; !ok {
+		panic(genError{fmt.Errorf("sherpago annotation \"union\" for %s is only for struct types", what)})
+	}
+	if g.opts.FastJSON {
+		panic(genError{fmt.Errorf("union %s is not supported with FastJSON or TinyGo", what)})
+	}
+	if g.opts.FieldNames == FieldNamesLowerCamel {
+		field = lowerCamelName(field, !g.opts.NoLintNames)
+	}
+	u := &union{field: field}
+	kinds := map[string]bool{}
+	for _, s := range strings.Split(variants, ",") {
+		t := strings.SplitN(s, ":", 2)
+		if len(t) != 2 || t[0] == "" || kinds[t[0]] {
+			panic(genError{fmt.Errorf("bad variant %q in sherpago annotation for %s, must be unique kind:type", s, what)})
+		}
+		kinds[t[0]] = true
+		st, ok := g.structs[t[1]]
+		if !ok || t[1] == name {
+			panic(genError{fmt.Errorf("variant %q in sherpago annotation for %s is not another struct type", t[1], what)})
+		}
+		var found bool
+		for _, f := range st.Fields {
+			if f.Name == field {
+				tw := f.Typewords
+				found = len(tw) == 1 && (tw[0] == "string" || g.strs[tw[0]].Name != "")
+			}
+		}
+		if !found {
+			panic(genError{fmt.Errorf("variant %s of %s has no string field %q", t[1], what, field)})
+		}
+		u.variants = append(u.variants, unionVariant{t[0], t[1]})
+	}
+	return u
+}
+
+// unionVariantName returns the name of the interface for the variants of
+// union type name.
+func (g *generator) unionVariantName(name string) string {
+	return g.typeName(name) + "Variant"
+}
+
+// generateUnion writes the Go type for union t, the interface for its
+// variants, and the methods for encoding and decoding it as JSON.
+func (g *generator) generateUnion(t sherpadoc.Struct, u *union) {
+	typeName := g.typeName(t.Name)
+	variantName := g.unionVariantName(t.Name)
+	method := "is" + g.exportedTypeName(t.Name)
+
+	var kinds, isMethods, marshalCases, unmarshalCases string
+	for i, v := range u.variants {
+		vt := g.typeName(v.typ)
+		if i > 0 {
+			kinds += ", "
+		}
+		kinds += fmt.Sprintf("%s for %s", vt, strconv.Quote(v.kind))
+		isMethods += fmt.Sprintf("func (%s) %s() {}\n", vt, method)
+		marshalCases += fmt.Sprintf("\tcase %s:\n\t\tx.%s = %s\n\t\treturn json.Marshal(x)\n", vt, g.fieldName(u.field), strconv.Quote(v.kind))
+		unmarshalCases += fmt.Sprintf("\tcase %s:\n\t\tvar x %s\n\t\tif err := json.Unmarshal(buf, &x); err != nil {\n\t\t\treturn err\n\t\t}\n\t\tv.Value = x\n", strconv.Quote(v.kind), vt)
+	}
+	g.printf(`// Value is one of the variants, with field %[7]s set to its kind:
+// %[4]s.
+type %[1]s struct {
+	Value %[2]s
+}
+
+// %[2]s is implemented by the variants of %[1]s.
+type %[2]s interface {
+	%[3]s()
+}
+
+%[5]s
+// MarshalJSON encodes the variant in v.Value, with its field %[7]s set.
+func (v %[1]s) MarshalJSON() ([]byte, error) {
+	switch x := v.Value.(type) {
+	case nil:
+		return []byte("null"), nil
+%[6]s	}
+	return nil, fmt.Errorf("unknown variant %%T for %[1]s", v.Value)
+}
+
+// UnmarshalJSON decodes the variant for the value of field %[7]s into v.Value.
+func (v *%[1]s) UnmarshalJSON(buf []byte) error {
+	if string(buf) == "null" {
+		v.Value = nil
+		return nil
+	}
+	var kind struct {
+		Kind string `+"`json:%[7]s`"+`
+	}
+	if err := json.Unmarshal(buf, &kind); err != nil {
+		return err
+	}
+	switch kind.Kind {
+%[8]s	default:
+		return fmt.Errorf("unknown kind %%q for %[1]s", kind.Kind)
+	}
+	return nil
+}
+
+`, typeName, variantName, method, kinds, isMethods, marshalCases, strconv.Quote(u.field), unmarshalCases)
+
+	if g.opts.Validate {
+		var cases string
+		for _, v := range u.variants {
+			cases += fmt.Sprintf("\tcase %s:\n\t\treturn x.validate()\n", g.typeName(v.typ))
+		}
+		g.printf("func (v *%s) validate() *%s {\n\tswitch x := v.Value.(type) {\n%s\tcase nil:\n\t\treturn &%s{Message: \"no variant for union\"}\n\t}\n\treturn &%s{Message: fmt.Sprintf(\"unknown variant %%T\", v.Value)}\n}\n\n", typeName, g.validationErrorName(), cases, g.validationErrorName(), g.validationErrorName())
+	}
+}
@@ -0,0 +1,219 @@
+package sherpago
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/mjl-/sherpadoc"
+)
+
+// validationCode is the Go code for the error returned for parameters and
+// results that do not match the sherpadoc, with Options.Validate. It is a format string with the
+// name of the ValidationError type as parameter.
+const validationCode = `// %[1]s is returned by the client for a parameter or result that does not
+// match the API, e.g. with a value for an enum that is not in the API
+// documentation, or null for a value that is not nullable. Invalid parameters
+// are not sent. For results, it typically indicates the server runs a newer or
+// older version of the API than the client was generated for.
+type %[1]s struct {
+	Function string // Name of the sherpa function.
+	Path     string // Location of the value, starting with the name of the parameter or result, e.g. "user.groups[1]".
+	Message  string // What is wrong with the value.
+}
+
+func (e *%[1]s) Error() string {
+	return fmt.Sprintf("%%s: invalid value at %%s: %%s", e.Function, e.Path, e.Message)
+}
+
+// at returns e with path p prepended to its path.
+func (e *%[1]s) at(p string) *%[1]s {
+	e.Path = p + e.Path
+	return e
+}
+
+`
+
+// generateValidateStruct writes a validate method for struct type t, checking its
+// fields against the sherpadoc, see Options.Validate.
+func (g *generator) generateValidateStruct(t sherpadoc.Struct) {
+	var code string
+	for _, f := range t.Fields {
+		what := fmt.Sprintf("field %s for type %s", f.Name, t.Name)
+		code += g.validateCode(parseType(what, f.Typewords), "v."+g.fieldName(f.Name), 0, fmt.Sprintf(".at(%q)", "."+f.Name))
+	}
+	g.printf("func (v *%s) validate() *%s {\n%s\treturn nil\n}\n\n", g.typeName(t.Name), g.validationErrorName(), indent(code, "\t"))
+}
+
+// generateValidateEnum writes a validate method for enum type name, checking the
+// value is one of values, Go expressions for the enum values, with keys their
+// values as text.
+func (g *generator) generateValidateEnum(name string, values, keys []string, verb string) {
+	g.printf("func (v %s) validate() *%s {\n", g.typeName(name), g.validationErrorName())
+	if len(values) > 0 {
+		// Values with multiple names can only be listed once.
+		var cases []string
+		seen := map[string]bool{}
+		for i, v := range values {
+			if !seen[keys[i]] {
+				seen[keys[i]] = true
+				cases = append(cases, v)
+			}
+		}
+		g.printf("\tswitch v {\n\tcase %s:\n\t\treturn nil\n\t}\n", strings.Join(cases, ", "))
+		g.printf("\treturn &%s{Message: fmt.Sprintf(\"unknown value %s for %s\", v)}\n}\n\n", g.validationErrorName(), verb, name)
+		return
+	}
+	g.printf("\treturn nil\n}\n\n")
+}
+
+// generateValidateBitmask writes a validate method for int enum type name with
+// the "bitmask" annotation, checking the value only has bits of the flags in
+// values, Go expressions for the enum values.
+func (g *generator) generateValidateBitmask(name string, values []string) {
+	mask := "0"
+	if len(values) > 0 {
+		mask = "(" + strings.Join(values, " | ") + ")"
+	}
+	g.printf("func (v %s) validate() *%s {\n", g.typeName(name), g.validationErrorName())
+	g.printf("\tif v&^%s == 0 {\n\t\treturn nil\n\t}\n", mask)
+	g.printf("\treturn &%s{Message: fmt.Sprintf(\"unknown flags %%d for %s\", int(v&^%s))}\n}\n\n", g.validationErrorName(), name, mask)
+}
+
+// generateValidateResults writes a function validating the results of fn, and
+// returns the statements for the client method calling it, or the empty string
+// if the results have nothing to check.
+func (g *generator) generateValidateResults(fn *sherpadoc.Function, resultNames []string) string {
+	whatParam := "parameter for " + fn.Name
+	var params, refs []string
+	code := ""
+	for i, r := range fn.Returns {
+		typ := parseType(whatParam, r.Typewords)
+		name := r.Name
+		if name == "" {
+			name = fmt.Sprintf("result%d", i)
+		}
+		params = append(params, fmt.Sprintf("r%d *%s", i, g.goType(typ)))
+		refs = append(refs, "&"+resultNames[i])
+		code += g.validateCode(typ, fmt.Sprintf("*r%d", i), 0, fmt.Sprintf(".at(%q)", name))
+	}
+	if code == "" {
+		return ""
+	}
+	suffix := g.funcSuffix(fn.Name)
+	g.printf("func validateResult%s(%s) *%s {\n%s\treturn nil\n}\n\n", suffix, strings.Join(params, ", "), g.validationErrorName(), indent(code, "\t"))
+	return fmt.Sprintf(`	if err == nil {
+		if verr := validateResult%s(%s); verr != nil {
+			verr.Function = %q
+			err = verr
+		}
+	}
+`, suffix, strings.Join(refs, ", "), fn.Name)
+}
+
+// generateValidateParams writes a function validating the parameters of fn, and
+// returns the statements for the client method calling it before sending the
+// request, returning zero, the zero values of the results followed by a comma,
+// or the empty string if the parameters have nothing to check.
+func (g *generator) generateValidateParams(fn *sherpadoc.Function, zero string) string {
+	whatParam := "parameter for " + fn.Name
+	var params []string
+	code := ""
+	locals := g.goParamNames(fn)
+	for i, p := range fn.Params {
+		typ := parseType(whatParam, p.Typewords)
+		local := locals[i]
+		params = append(params, local+" "+g.goType(typ))
+		code += g.validateCode(typ, local, 0, fmt.Sprintf(".at(%q)", p.Name))
+	}
+	if code == "" {
+		return ""
+	}
+	g.printf("func validateParams%s(%s) *%s {\n%s\treturn nil\n}\n\n", g.funcSuffix(fn.Name), strings.Join(params, ", "), g.validationErrorName(), indent(code, "\t"))
+	return g.validateParamsCall(fn, zero)
+}
+
+// validateParamsCall returns the Go statements calling the function generated
+// by generateValidateParams, returning zero followed by the error.
+func (g *generator) validateParamsCall(fn *sherpadoc.Function, zero string) string {
+	args := g.goParamNames(fn)
+	return fmt.Sprintf(`	if verr := validateParams%s(%s); verr != nil {
+		verr.Function = %q
+		return %sverr
+	}
+`, g.funcSuffix(fn.Name), strings.Join(args, ", "), fn.Name, zero)
+}
+
+// validateCode returns Go statements checking value x of type t against the
+// sherpadoc, returning a *ValidationError from the enclosing function for an
+// invalid value, with at applied to it for its path. Depth is used for unique
+// local variables in nested loops. The code is empty if there is nothing to
+// check, e.g. for base types.
+func (g *generator) validateCode(t Type, x string, depth int, at string) string {
+	switch t := t.(type) {
+	case NullableType:
+		var code string
+		switch t.Type.(type) {
+		case ArrayType, ObjectType:
+			// Null is allowed, so only the elements are checked.
+			if g.nilIsNull(t) {
+				return g.validateElems(t.Type, x, depth, at)
+			}
+			code = g.validateElems(t.Type, "*"+x, depth, at)
+		default:
+			code = g.validateCode(t.Type, "(*"+x+")", depth, at)
+		}
+		if code == "" {
+			return ""
+		}
+		return fmt.Sprintf("if %s != nil {\n%s}\n", x, indent(code, "\t"))
+	case ArrayType, ObjectType:
+		// With NullableSlices, nil is an empty array or object.
+		if g.opts.NullableSlices {
+			return g.validateElems(t, x, depth, at)
+		}
+		kind := "array"
+		if _, ok := t.(ObjectType); ok {
+			kind = "object"
+		}
+		return fmt.Sprintf("if %s == nil {\n\treturn (&%s{Message: \"null for non-nullable %s\"})%s\n}\n", x, g.validationErrorName(), kind, at) + g.validateElems(t, x, depth, at)
+	case IdentType:
+		// Pointers have the validate methods too.
+		var ptr string
+		if strings.HasPrefix(x, "(*") && strings.HasSuffix(x, ")") {
+			ptr = x[2 : len(x)-1]
+		} else if strings.HasPrefix(x, "*") {
+			ptr = x[1:]
+		}
+		if ptr != "" {
+			x = ptr
+			if strings.HasPrefix(x, "*") {
+				x = "(" + x + ")"
+			}
+		}
+		return fmt.Sprintf("if verr := %s.validate(); verr != nil {\n\treturn verr%s\n}\n", x, at)
+	}
+	return ""
+}
+
+// validateElems returns Go statements checking the elements of slice or map x,
+// of array or object type t, like validateCode.
+func (g *generator) validateElems(t Type, x string, depth int, at string) string {
+	var code string
+	i := fmt.Sprintf("i%d", depth)
+	e := fmt.Sprintf("e%d", depth)
+	switch t := t.(type) {
+	case ArrayType:
+		code = g.validateCode(t.Type, e, depth+1, fmt.Sprintf(`.at("[" + strconv.Itoa(%s) + "]")%s`, i, at))
+	case ObjectType:
+		code = g.validateCode(t.Value, e, depth+1, fmt.Sprintf(`.at("[" + strconv.Quote(%s) + "]")%s`, i, at))
+	}
+	if code == "" {
+		return ""
+	}
+	return fmt.Sprintf("for %s, %s := range %s {\n%s}\n", i, e, x, indent(code, "\t"))
+}
+
+// validationErrorName returns the name of the ValidationError type.
+func (g *generator) validationErrorName() string {
+	return g.clientIdent("ValidationError")
+}
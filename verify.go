@@ -0,0 +1,101 @@
+package sherpago
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// TestingT is the part of testing.TB used by VerifyGenerated.
+type TestingT interface {
+	Helper()
+	Errorf(format string, args ...interface{})
+	Fatalf(format string, args ...interface{})
+}
+
+// VerifyGenerated generates files from the sherpadoc at inputPath with opts, and
+// fails t if they differ from the committed files at goldenPath, for a test in a
+// repository with a generated client:
+//
+//	func TestClient(t *testing.T) {
+//		sherpago.VerifyGenerated(t, "myapi.json", "myapi.go", sherpago.Options{PackageName: "myapi", BaseURL: "https://example.org/myapi/"})
+//	}
+//
+// If goldenPath is a directory, all generated files are compared with the files
+// in it, by name, otherwise only the client package. If environment variable
+// SHERPAGO_UPDATE is set, the files are written instead of compared.
+func VerifyGenerated(t TestingT, inputPath, goldenPath string, opts Options) {
+	t.Helper()
+
+	f, err := os.Open(inputPath)
+	if err != nil {
+		t.Fatalf("opening sherpadoc: %s", err)
+	}
+	defer f.Close()
+	files, err := GenerateFiles(f, opts)
+	if err != nil {
+		t.Fatalf("generating: %s", err)
+	}
+
+	paths := map[string]string{} // File name to path of golden file.
+	if fi, err := os.Stat(goldenPath); err == nil && fi.IsDir() {
+		for name := range files {
+			paths[name] = filepath.Join(goldenPath, filepath.FromSlash(name))
+		}
+	} else {
+		name := opts.PackageName + ".go"
+		files = map[string][]byte{name: files[name]}
+		paths[name] = goldenPath
+	}
+	var names []string
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	update := os.Getenv("SHERPAGO_UPDATE") != ""
+	for _, name := range names {
+		path := paths[name]
+		if update {
+			if err := os.MkdirAll(filepath.Dir(path), 0777); err != nil {
+				t.Fatalf("creating directory for %s: %s", path, err)
+			}
+			if err := os.WriteFile(path, files[name], 0666); err != nil {
+				t.Fatalf("writing %s: %s", path, err)
+			}
+			continue
+		}
+		buf, err := os.ReadFile(path)
+		if err != nil {
+			t.Errorf("reading committed file for %s: %s", name, err)
+			continue
+		}
+		if diff := firstDifference(buf, files[name]); diff != "" {
+			t.Errorf("%s differs from generated %s, regenerate or run with SHERPAGO_UPDATE=1: %s", path, name, diff)
+		}
+	}
+}
+
+// firstDifference returns a description of the first line that differs
+// between a and b, or the empty string if they are the same.
+func firstDifference(a, b []byte) string {
+	if bytes.Equal(a, b) {
+		return ""
+	}
+	al := strings.Split(string(a), "\n")
+	bl := strings.Split(string(b), "\n")
+	for i := 0; ; i++ {
+		if i >= len(al) || i >= len(bl) || al[i] != bl[i] {
+			line := func(l []string) string {
+				if i >= len(l) {
+					return "end of file"
+				}
+				return fmt.Sprintf("%q", l[i])
+			}
+			return fmt.Sprintf("line %d is %s, generated %s", i+1, line(al), line(bl))
+		}
+	}
+}
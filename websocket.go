@@ -0,0 +1,301 @@
+package sherpago
+
+// webSocketCode is the Go code with the option for making calls over a
+// WebSocket connection, for Options.WebSocket. It is a format string with the
+// names of the client type, the option type, and the WithWebSocket function as
+// parameters.
+const webSocketCode = `// %[3]s returns an option that makes the client send calls as messages over
+// a single WebSocket connection to wsURL, e.g. "wss://example.org/api/ws",
+// instead of sending an HTTP request for each call, for lower latency, e.g. in
+// interactive tools making many small calls. The connection is made with the
+// http.Client and headers of the client on the first call, and made again
+// after it is lost.
+//
+// The server must implement this protocol: a call is a text message with a
+// JSON object with the "id" of the call, a number, the name of the "function",
+// and the "params" as in requests. The server answers with a text message with
+// an object with the "id" of the call and the "result" or "error" as in
+// responses. Calls are answered in any order.
+func %[3]s(wsURL string) %[2]s {
+	return func(c *%[1]s) {
+		ws := &webSocket{url: wsURL}
+		c.webSocket = ws.call
+		c.closer.add(ws.close)
+	}
+}
+
+// close closes the connection, if any, for Close of the client.
+func (ws *webSocket) close() {
+	ws.Lock()
+	defer ws.Unlock()
+	if ws.conn != nil {
+		ws.conn.fail(fmt.Errorf("client closed"))
+	}
+}
+
+// webSocket is the connection for %[3]s, made when needed.
+type webSocket struct {
+	url string
+
+	sync.Mutex
+	conn *wsConn
+}
+
+// wsConn is a WebSocket connection with calls in progress.
+type wsConn struct {
+	rwc io.ReadWriteCloser
+	br  *bufio.Reader
+	wmu sync.Mutex // For writing frames.
+
+	sync.Mutex
+	nextID  int64
+	pending map[int64]chan []byte // By call ID, for the response message.
+	err     error                 // Set when the connection failed.
+}
+
+// call sends a call of function with request body, as for an HTTP request, and
+// returns the response message.
+func (ws *webSocket) call(ctx context.Context, c *%[1]s, function string, body []byte) ([]byte, error) {
+	conn, err := ws.connect(ctx, c)
+	if err != nil {
+		return nil, &sherpa.Error{Code: sherpa.SherpaHTTPError, Message: "websocket connection: " + err.Error()}
+	}
+	ch := make(chan []byte, 1)
+	conn.Lock()
+	if conn.err != nil {
+		err := conn.err
+		conn.Unlock()
+		return nil, &sherpa.Error{Code: sherpa.SherpaHTTPError, Message: "websocket connection: " + err.Error()}
+	}
+	conn.nextID++
+	id := conn.nextID
+	conn.pending[id] = ch
+	conn.Unlock()
+
+	name, _ := json.Marshal(function)
+	msg := []byte("{\"id\":" + strconv.FormatInt(id, 10) + ",\"function\":" + string(name) + ",")
+	msg = append(msg, bytes.TrimPrefix(body, []byte("{"))...)
+	if err := conn.writeFrame(0x1, msg); err != nil {
+		conn.fail(err)
+	}
+	select {
+	case resp, ok := <-ch:
+		if !ok {
+			return nil, &sherpa.Error{Code: sherpa.SherpaHTTPError, Message: "websocket connection: " + conn.err.Error()}
+		}
+		return resp, nil
+	case <-ctx.Done():
+		conn.Lock()
+		delete(conn.pending, id)
+		conn.Unlock()
+		return nil, &sherpa.Error{Code: sherpa.SherpaHTTPError, Message: "waiting for websocket response: " + ctx.Err().Error()}
+	}
+}
+
+// connect returns the connection, connecting if there is none, or it failed.
+func (ws *webSocket) connect(ctx context.Context, c *%[1]s) (*wsConn, error) {
+	ws.Lock()
+	defer ws.Unlock()
+	if ws.conn != nil {
+		ws.conn.Lock()
+		err := ws.conn.err
+		ws.conn.Unlock()
+		if err == nil {
+			return ws.conn, nil
+		}
+	}
+
+	u, err := url.Parse(ws.url)
+	if err != nil {
+		return nil, err
+	}
+	switch u.Scheme {
+	case "ws":
+		u.Scheme = "http"
+	case "wss":
+		u.Scheme = "https"
+	}
+	user := u.User
+	u.User = nil
+	var key [16]byte
+	if _, err := rand.Read(key[:]); err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest("GET", u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	setHeaders(req.Header, c.headers)
+	if c.credentials != nil {
+		h, err := c.credentials.Credentials(ctx)
+		if err != nil {
+			return nil, err
+		}
+		setHeaders(req.Header, h)
+	}
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", "websocket")
+	req.Header.Set("Sec-WebSocket-Version", "13")
+	req.Header.Set("Sec-WebSocket-Key", base64.StdEncoding.EncodeToString(key[:]))
+	if user != nil {
+		password, _ := user.Password()
+		req.SetBasicAuth(user.Username(), password)
+	}
+	// With a timeout, the http.Client would close the connection after it, and
+	// the body of the response could not be written to. The handshake is bounded
+	// by ctx.
+	hc := *c.Client
+	hc.Timeout = 0
+	resp, err := hc.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		resp.Body.Close()
+		return nil, fmt.Errorf("HTTP error from server: %%s", resp.Status)
+	}
+	rwc, ok := resp.Body.(io.ReadWriteCloser)
+	if !ok {
+		resp.Body.Close()
+		return nil, fmt.Errorf("cannot write to connection, response body of type %%T from the transport of the http.Client is not an io.ReadWriteCloser", resp.Body)
+	}
+	sum := sha1.Sum([]byte(base64.StdEncoding.EncodeToString(key[:]) + "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"))
+	if resp.Header.Get("Sec-WebSocket-Accept") != base64.StdEncoding.EncodeToString(sum[:]) {
+		rwc.Close()
+		return nil, fmt.Errorf("bad Sec-WebSocket-Accept header from server")
+	}
+	ws.conn = &wsConn{rwc: rwc, br: bufio.NewReader(rwc), pending: map[int64]chan []byte{}}
+	go ws.conn.read()
+	return ws.conn, nil
+}
+
+// read reads messages, and delivers the responses to the calls waiting for
+// them, until the connection fails.
+func (conn *wsConn) read() {
+	for {
+		msg, err := conn.readMessage()
+		if err != nil {
+			conn.fail(err)
+			return
+		}
+		var resp struct {
+			ID int64 ` + "`json:\"id\"`" + `
+		}
+		if err := json.Unmarshal(msg, &resp); err != nil {
+			conn.fail(fmt.Errorf("parsing message: %%v", err))
+			return
+		}
+		conn.Lock()
+		ch := conn.pending[resp.ID]
+		delete(conn.pending, resp.ID)
+		conn.Unlock()
+		if ch != nil {
+			ch <- msg
+		}
+	}
+}
+
+// fail closes the connection because of err, for the calls in progress and
+// new calls.
+func (conn *wsConn) fail(err error) {
+	conn.Lock()
+	defer conn.Unlock()
+	if conn.err != nil {
+		return
+	}
+	conn.err = err
+	conn.rwc.Close()
+	for _, ch := range conn.pending {
+		close(ch)
+	}
+	conn.pending = nil
+}
+
+// readMessage returns the payload of the next text or binary message,
+// answering pings.
+func (conn *wsConn) readMessage() ([]byte, error) {
+	var msg []byte
+	for {
+		var h [2]byte
+		if _, err := io.ReadFull(conn.br, h[:]); err != nil {
+			return nil, err
+		}
+		fin, opcode := h[0]&0x80 != 0, h[0]&0x0f
+		n := uint64(h[1] & 0x7f)
+		switch n {
+		case 126:
+			var b [2]byte
+			if _, err := io.ReadFull(conn.br, b[:]); err != nil {
+				return nil, err
+			}
+			n = uint64(binary.BigEndian.Uint16(b[:]))
+		case 127:
+			var b [8]byte
+			if _, err := io.ReadFull(conn.br, b[:]); err != nil {
+				return nil, err
+			}
+			n = binary.BigEndian.Uint64(b[:])
+		}
+		var mask [4]byte
+		if h[1]&0x80 != 0 {
+			if _, err := io.ReadFull(conn.br, mask[:]); err != nil {
+				return nil, err
+			}
+		}
+		if n > 64<<20 {
+			return nil, fmt.Errorf("message too large")
+		}
+		payload := make([]byte, n)
+		if _, err := io.ReadFull(conn.br, payload); err != nil {
+			return nil, err
+		}
+		if h[1]&0x80 != 0 {
+			for i := range payload {
+				payload[i] ^= mask[i%%4]
+			}
+		}
+		switch opcode {
+		case 0x0, 0x1, 0x2:
+			msg = append(msg, payload...)
+			if fin {
+				return msg, nil
+			}
+		case 0x8:
+			return nil, fmt.Errorf("closed by server")
+		case 0x9:
+			if err := conn.writeFrame(0xa, payload); err != nil {
+				return nil, err
+			}
+		}
+	}
+}
+
+// writeFrame writes a single frame with opcode and payload, masked as
+// required for clients.
+func (conn *wsConn) writeFrame(opcode byte, payload []byte) error {
+	buf := []byte{0x80 | opcode}
+	switch n := len(payload); {
+	case n < 126:
+		buf = append(buf, 0x80|byte(n))
+	case n < 1<<16:
+		buf = append(buf, 0x80|126, byte(n>>8), byte(n))
+	default:
+		buf = append(buf, 0x80|127)
+		buf = append(buf, make([]byte, 8)...)
+		binary.BigEndian.PutUint64(buf[len(buf)-8:], uint64(n))
+	}
+	var mask [4]byte
+	if _, err := rand.Read(mask[:]); err != nil {
+		return err
+	}
+	buf = append(buf, mask[:]...)
+	for i, b := range payload {
+		buf = append(buf, b^mask[i%%4])
+	}
+	conn.wmu.Lock()
+	defer conn.wmu.Unlock()
+	_, err := conn.rwc.Write(buf)
+	return err
+}
+
+`
@@ -0,0 +1,32 @@
+package sherpago
+
+import (
+	"github.com/mjl-/sherpadoc"
+)
+
+// zeroTimeCode is the Go code with the helper for leaving out zero timestamps
+// when encoding struct types, see Options.OmitZeroTime. Not used with FastJSON.
+const zeroTimeCode = `// omitZeroTime returns nil for the zero time, for a field with omitempty.
+func omitZeroTime(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
+
+`
+
+// zeroTimeFields returns the fields of struct t with non-nullable timestamps,
+// which are left out of the JSON when zero, with Options.OmitZeroTime.
+func (g *generator) zeroTimeFields(t sherpadoc.Struct) []sherpadoc.Field {
+	if !g.opts.OmitZeroTime {
+		return nil
+	}
+	var l []sherpadoc.Field
+	for _, f := range t.Fields {
+		if len(f.Typewords) == 1 && f.Typewords[0] == "timestamp" {
+			l = append(l, f)
+		}
+	}
+	return l
+}